@@ -29,6 +29,18 @@ func (cc *CtrlC) register() {
 		for _, k := range ds {
 			Storager.Point.Del(k)
 		}
+		// Clear links.
+		ds = ds[:0]
+		Storager.Link.Iter(func(k string, v interface{}) {
+			if l, ok := v.(*schema.Link); ok {
+				if l.Switch == cc.Conn.Id {
+					ds = append(ds, k)
+				}
+			}
+		})
+		for _, k := range ds {
+			Storager.Link.Del(k)
+		}
 		// Remove switch.
 		Storager.Switch.Del(cc.Conn.Id)
 	}
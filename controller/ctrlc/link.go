@@ -1,8 +1,10 @@
 package ctrlc
 
 import (
+	"encoding/json"
 	"github.com/danieldin95/openlan-go/controller/libctrl"
 	"github.com/danieldin95/openlan-go/libol"
+	"github.com/danieldin95/openlan-go/switch/schema"
 )
 
 type Link struct {
@@ -12,10 +14,19 @@ type Link struct {
 
 func (h *Link) AddCtl(id string, m libctrl.Message) error {
 	libol.Cmd("Link.AddCtl %s %s", id, m.Data)
+	l := schema.Link{}
+	if err := json.Unmarshal([]byte(m.Data), &l); err != nil {
+		return err
+	}
+	if l.Switch == "" {
+		l.Switch = id
+	}
+	_ = Storager.Link.Mod(l.Address, &l)
 	return nil
 }
 
 func (h *Link) DelCtl(id string, m libctrl.Message) error {
 	libol.Cmd("Link.DelCtl %s %s", id, m.Data)
+	Storager.Link.Del(m.Data)
 	return nil
 }
@@ -6,6 +6,7 @@ require (
 	github.com/akavel/rsrc v0.8.0 // indirect
 	github.com/coreos/go-systemd/v22 v22.0.0
 	github.com/danieldin95/lightstar v0.0.0-20200401145448-034e11afcf81
+	github.com/golang/snappy v0.0.1
 	github.com/gorilla/mux v1.7.4
 	github.com/pkg/errors v0.9.1
 	github.com/songgao/water v0.0.0-20190725173103-fd331bda3f4b
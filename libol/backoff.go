@@ -0,0 +1,65 @@
+package libol
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// Backoff is exponential with jitter, and retries at once for the first.
+type Backoff struct {
+	Min    time.Duration
+	Max    time.Duration
+	Jitter float64 // random fraction of interval.
+
+	lock     sync.Mutex
+	attempts int
+}
+
+func NewBackoff(min, max time.Duration) *Backoff {
+	if max < min {
+		max = min
+	}
+	return &Backoff{
+		Min:    min,
+		Max:    max,
+		Jitter: 0.2,
+	}
+}
+
+// Next returns the interval before the next attempt.
+func (b *Backoff) Next() time.Duration {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	b.attempts++
+	if b.attempts == 1 {
+		return 0
+	}
+	d := b.Max
+	if shift := uint(b.attempts - 2); shift < 32 {
+		if v := b.Min << shift; v > 0 && v < b.Max {
+			d = v
+		}
+	}
+	if b.Jitter > 0 {
+		j := float64(d) * b.Jitter
+		d += time.Duration(j * (2*rand.Float64() - 1))
+	}
+	if d > b.Max {
+		d = b.Max
+	}
+	return d
+}
+
+func (b *Backoff) Reset() {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.attempts = 0
+}
+
+func (b *Backoff) Attempts() int {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return b.attempts
+}
@@ -0,0 +1,26 @@
+package libol
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestBackoff(t *testing.T) {
+	b := NewBackoff(time.Second, 30*time.Second)
+	assert.Equal(t, time.Duration(0), b.Next(), "at once.")
+	last := time.Duration(0)
+	for i := 0; i < 4; i++ {
+		d := b.Next()
+		base := time.Second << uint(i)
+		assert.True(t, d >= base*8/10 && d <= base*12/10, "jitter %s", d)
+		assert.True(t, d > last, "grow.")
+		last = d
+	}
+	for i := 0; i < 64; i++ {
+		assert.True(t, b.Next() <= b.Max, "max.")
+	}
+	assert.Equal(t, 69, b.Attempts(), "attempts.")
+	b.Reset()
+	assert.Equal(t, time.Duration(0), b.Next(), "reset.")
+}
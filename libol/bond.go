@@ -0,0 +1,280 @@
+package libol
+
+import (
+	"encoding/binary"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Mode of bond to select a path for sending.
+const (
+	BOND_BACKUP     = "active-backup"
+	BOND_ROUNDROBIN = "round-robin"
+	BOND_LOWESTRTT  = "lowest-rtt"
+)
+
+// BONDSEQ is the size of sequence before frame, if reordering enabled.
+const BONDSEQ = 8
+
+// BondPath is a transport session of the bond, and the queue is closed
+// if removed.
+type BondPath struct {
+	Client SocketClient
+	Queue  *SendQueue
+	Write  func(data []byte) error
+}
+
+// Bond binds sessions of one point to a logical session, and sends by
+// mode with sequence if reordering.
+type Bond struct {
+	lock     sync.RWMutex
+	mode     string
+	paths    []*BondPath
+	next     uint32
+	sequence bool
+	txSeq    uint64
+	reorder  *Reorder
+}
+
+// NewBond returns a bond, and the mode is active-backup if unknown.
+func NewBond(mode string, sequence bool) *Bond {
+	if mode != BOND_ROUNDROBIN && mode != BOND_LOWESTRTT {
+		mode = BOND_BACKUP
+	}
+	b := &Bond{
+		mode:    mode,
+		paths:   make([]*BondPath, 0, 4),
+		reorder: NewReorder(64, 20*time.Millisecond),
+	}
+	b.SetSequence(sequence)
+	return b
+}
+
+func (b *Bond) Mode() string {
+	return b.mode
+}
+
+func (b *Bond) Sequence() bool {
+	b.lock.RLock()
+	defer b.lock.RUnlock()
+	return b.sequence
+}
+
+// SetSequence enables the sequence if accepted by peer.
+func (b *Bond) SetSequence(v bool) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.sequence = v
+}
+
+func (b *Bond) Add(path *BondPath) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.paths = append(b.paths, path)
+}
+
+// Remove deletes the path of client by address, and returns the number of
+// paths left.
+func (b *Bond) Remove(addr string) int {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	for i, path := range b.paths {
+		if path.Client.Addr() == addr {
+			if path.Queue != nil {
+				path.Queue.Close()
+			}
+			b.paths = append(b.paths[:i], b.paths[i+1:]...)
+			break
+		}
+	}
+	return len(b.paths)
+}
+
+// Replace the client of a path, which is reconnected to other switch.
+func (b *Bond) Replace(old, client SocketClient) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	for _, path := range b.paths {
+		if path.Client == old {
+			path.Client = client
+		}
+	}
+}
+
+// Primary returns the first path, and nil if none.
+func (b *Bond) Primary() *BondPath {
+	b.lock.RLock()
+	defer b.lock.RUnlock()
+	if len(b.paths) == 0 {
+		return nil
+	}
+	return b.paths[0]
+}
+
+func (b *Bond) Len() int {
+	b.lock.RLock()
+	defer b.lock.RUnlock()
+	return len(b.paths)
+}
+
+// Clients returns clients of all paths.
+func (b *Bond) Clients() []SocketClient {
+	b.lock.RLock()
+	defer b.lock.RUnlock()
+	clients := make([]SocketClient, 0, len(b.paths))
+	for _, path := range b.paths {
+		clients = append(clients, path.Client)
+	}
+	return clients
+}
+
+// Select returns a path authenticated by mode, and nil if none.
+func (b *Bond) Select() *BondPath {
+	b.lock.RLock()
+	defer b.lock.RUnlock()
+
+	ok := make([]*BondPath, 0, len(b.paths))
+	for _, path := range b.paths {
+		if path.Client.Status() == CL_AUEHED {
+			ok = append(ok, path)
+		}
+	}
+	if len(ok) == 0 {
+		return nil
+	}
+	switch b.mode {
+	case BOND_ROUNDROBIN:
+		i := atomic.AddUint32(&b.next, 1)
+		return ok[int(i)%len(ok)]
+	case BOND_LOWESTRTT:
+		best := ok[0]
+		bestRtt, _ := best.Client.Rtt()
+		for _, path := range ok[1:] {
+			// not measured is the worst.
+			if rtt, _ := path.Client.Rtt(); rtt > 0 && (bestRtt == 0 || rtt < bestRtt) {
+				best, bestRtt = path, rtt
+			}
+		}
+		return best
+	}
+	// active-backup, and the first is preferred.
+	return ok[0]
+}
+
+// Write sends data on a selected path, and the data is prefixed by
+// sequence if reordering.
+func (b *Bond) Write(data []byte) error {
+	path := b.Select()
+	if path == nil {
+		return NewErr("no path ready")
+	}
+	if !b.Sequence() {
+		return path.Write(data)
+	}
+	frame := make([]byte, BONDSEQ+len(data))
+	binary.BigEndian.PutUint64(frame, atomic.AddUint64(&b.txSeq, 1))
+	copy(frame[BONDSEQ:], data)
+	return path.Write(frame)
+}
+
+// Input delivers data received from any path, and in order if reordering.
+func (b *Bond) Input(data []byte, deliver func([]byte) error) error {
+	if !b.Sequence() {
+		return deliver(data)
+	}
+	if len(data) < BONDSEQ {
+		return NewErr("too short for sequence")
+	}
+	seq := binary.BigEndian.Uint64(data[:BONDSEQ])
+	return b.reorder.Input(seq, data[BONDSEQ:], deliver)
+}
+
+// Reorder buffers frames after a gap of sequence, until the gap filled, the
+// window full or waited for a timeout.
+type Reorder struct {
+	lock    sync.Mutex
+	next    uint64
+	pending map[uint64][]byte
+	window  int
+	timeout time.Duration
+	timer   *time.Timer
+	deliver func([]byte) error
+}
+
+func NewReorder(window int, timeout time.Duration) *Reorder {
+	return &Reorder{
+		next:    1,
+		pending: make(map[uint64][]byte, window),
+		window:  window,
+		timeout: timeout,
+	}
+}
+
+func (r *Reorder) Input(seq uint64, data []byte, deliver func([]byte) error) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.deliver = deliver
+	if seq < r.next { // late, and delivered at once.
+		return deliver(data)
+	}
+	if seq == r.next {
+		r.next++
+		err := deliver(data)
+		r.flush()
+		return err
+	}
+	frame := make([]byte, len(data))
+	copy(frame, data)
+	r.pending[seq] = frame
+	if len(r.pending) >= r.window {
+		r.skip()
+	} else if r.timer == nil {
+		r.timer = time.AfterFunc(r.timeout, r.onTimeout)
+	}
+	return nil
+}
+
+// flush delivers the pending in order from next.
+func (r *Reorder) flush() {
+	for {
+		data, ok := r.pending[r.next]
+		if !ok {
+			break
+		}
+		delete(r.pending, r.next)
+		r.next++
+		_ = r.deliver(data)
+	}
+	if len(r.pending) == 0 && r.timer != nil {
+		r.timer.Stop()
+		r.timer = nil
+	}
+}
+
+// skip the gap to the lowest pending.
+func (r *Reorder) skip() {
+	var lowest uint64
+	for seq := range r.pending {
+		if lowest == 0 || seq < lowest {
+			lowest = seq
+		}
+	}
+	if lowest > r.next {
+		r.next = lowest
+	}
+	r.flush()
+}
+
+func (r *Reorder) onTimeout() {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.timer = nil
+	if len(r.pending) > 0 {
+		r.skip()
+		if len(r.pending) > 0 && r.timer == nil {
+			r.timer = time.AfterFunc(r.timeout, r.onTimeout)
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package libol
+
+import (
+	"github.com/stretchr/testify/assert"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestBondSelect(t *testing.T) {
+	paths := make([]*BondPath, 0, 2)
+	bond := NewBond(BOND_ROUNDROBIN, false)
+	for i := 0; i < 2; i++ {
+		c0, _ := net.Pipe()
+		client := NewTcpClientFromConn(c0)
+		client.SetStatus(CL_AUEHED)
+		path := &BondPath{Client: client, Write: func(data []byte) error {
+			return nil
+		}}
+		paths = append(paths, path)
+		bond.Add(path)
+	}
+	selected := make(map[*BondPath]int, 2)
+	for i := 0; i < 4; i++ {
+		selected[bond.Select()]++
+	}
+	assert.Equal(t, 2, selected[paths[0]], "round-robin.")
+	assert.Equal(t, 2, selected[paths[1]], "round-robin.")
+
+	backup := NewBond("unknown", false)
+	assert.Equal(t, BOND_BACKUP, backup.Mode(), "default mode.")
+	for _, path := range paths {
+		backup.Add(path)
+	}
+	assert.Equal(t, paths[0], backup.Select(), "active.")
+	paths[0].Client.SetStatus(CL_CLOSED)
+	assert.Equal(t, paths[1], backup.Select(), "backup.")
+	paths[1].Client.SetStatus(CL_CLOSED)
+	assert.Nil(t, backup.Select(), "none.")
+	assert.NotNil(t, backup.Write([]byte("hello")), "no path.")
+}
+
+func TestBondReorder(t *testing.T) {
+	tx := NewBond(BOND_BACKUP, true)
+	rx := NewBond(BOND_BACKUP, true)
+
+	frames := make([][]byte, 0, 4)
+	c0, _ := net.Pipe()
+	client := NewTcpClientFromConn(c0)
+	client.SetStatus(CL_AUEHED)
+	tx.Add(&BondPath{Client: client, Write: func(data []byte) error {
+		frames = append(frames, data)
+		return nil
+	}})
+	for _, v := range []string{"frame 1", "frame 2", "frame 3", "frame 4"} {
+		assert.Nil(t, tx.Write([]byte(v)), "write.")
+	}
+
+	recv := make(chan string, 4)
+	deliver := func(data []byte) error {
+		recv <- string(data)
+		return nil
+	}
+	// received 2, 1, 4 and lost 3.
+	for _, i := range []int{1, 0, 3} {
+		assert.Nil(t, rx.Input(frames[i], deliver), "input.")
+	}
+	assert.Equal(t, "frame 1", <-recv, "in order.")
+	assert.Equal(t, "frame 2", <-recv, "in order.")
+	select {
+	case v := <-recv:
+		t.Errorf("not wait for the gap: %s", v)
+	default:
+	}
+	select {
+	case v := <-recv:
+		assert.Equal(t, "frame 4", v, "skipped the gap.")
+	case <-time.After(time.Second):
+		t.Errorf("not skipped the gap")
+	}
+	assert.NotNil(t, rx.Input([]byte("short"), deliver), "too short.")
+}
@@ -0,0 +1,26 @@
+package libol
+
+import (
+	"sync"
+)
+
+const (
+	POOLBUF = HSIZE + SIZE_MASK + 64 // enough for a frame with crypt.
+	RWBUF   = 32 * 1024
+)
+
+var bufPool = sync.Pool{
+	New: func() interface{} {
+		buf := make([]byte, POOLBUF)
+		return &buf
+	},
+}
+
+// GetBuf returns a buffer from pool, and should be put back by PutBuf.
+func GetBuf() *[]byte {
+	return bufPool.Get().(*[]byte)
+}
+
+func PutBuf(buf *[]byte) {
+	bufPool.Put(buf)
+}
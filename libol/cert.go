@@ -0,0 +1,59 @@
+package libol
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"golang.org/x/net/websocket"
+	"io/ioutil"
+	"net"
+)
+
+// certConn is a stream in the session over tls, and has the certificates
+// and the balancer of the session.
+type certConn struct {
+	net.Conn
+	certs []*x509.Certificate
+	proxy string
+}
+
+// peerCerts returns the verified certificates of the peer by tls.
+func peerCerts(conn net.Conn) []*x509.Certificate {
+	switch c := conn.(type) {
+	case *tls.Conn:
+		return c.ConnectionState().PeerCertificates
+	case *peekConn:
+		return peerCerts(c.Conn)
+	case *proxyConn:
+		return peerCerts(c.Conn)
+	case *certConn:
+		return c.certs
+	case *websocket.Conn:
+		if req := c.Request(); req != nil && req.TLS != nil {
+			return req.TLS.PeerCertificates
+		}
+	}
+	return nil
+}
+
+// CertNames returns the common name, DNS and email names of cert.
+func CertNames(cert *x509.Certificate) []string {
+	names := make([]string, 0, 4)
+	if cert.Subject.CommonName != "" {
+		names = append(names, cert.Subject.CommonName)
+	}
+	names = append(names, cert.DNSNames...)
+	names = append(names, cert.EmailAddresses...)
+	return names
+}
+
+func NewCertPool(caFile string) (*x509.CertPool, error) {
+	pem, err := ioutil.ReadFile(caFile)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, NewErr("no certificate in %s", caFile)
+	}
+	return pool, nil
+}
@@ -0,0 +1,78 @@
+package libol
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"github.com/stretchr/testify/assert"
+	"math/big"
+	"net"
+	"testing"
+	"time"
+)
+
+func newTestCert(t *testing.T, tmpl *x509.Certificate, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.Nil(t, err, "key.")
+	tmpl.NotBefore = time.Now().Add(-time.Hour)
+	tmpl.NotAfter = time.Now().Add(time.Hour)
+	if parent == nil {
+		parent, parentKey = tmpl, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, parent, &key.PublicKey, parentKey)
+	assert.Nil(t, err, "cert.")
+	cert, err := x509.ParseCertificate(der)
+	assert.Nil(t, err, "parse.")
+	return cert, key
+}
+
+func TestPeerCerts(t *testing.T) {
+	ca, caKey := newTestCert(t, &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "openlan ca"},
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}, nil, nil)
+	srv, srvKey := newTestCert(t, &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "switch"},
+		DNSNames:     []string{"switch.openlan.net"},
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}, ca, caKey)
+	cli, cliKey := newTestCert(t, &x509.Certificate{
+		SerialNumber:   big.NewInt(3),
+		Subject:        pkix.Name{CommonName: "hi"},
+		EmailAddresses: []string{"hi@default"},
+		ExtKeyUsage:    []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}, ca, caKey)
+	pool := x509.NewCertPool()
+	pool.AddCert(ca)
+
+	c0, c1 := net.Pipe()
+	server := tls.Server(c0, &tls.Config{
+		Certificates: []tls.Certificate{{Certificate: [][]byte{srv.Raw}, PrivateKey: srvKey}},
+		ClientCAs:    pool,
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+	})
+	client := tls.Client(c1, &tls.Config{
+		Certificates: []tls.Certificate{{Certificate: [][]byte{cli.Raw}, PrivateKey: cliKey}},
+		RootCAs:      pool,
+		ServerName:   "switch.openlan.net",
+	})
+	go func() {
+		_ = client.Handshake()
+	}()
+	assert.Nil(t, server.Handshake(), "handshake.")
+
+	peer := NewTcpClientFromConn(&certConn{Conn: server, certs: peerCerts(&peekConn{Conn: server})})
+	certs := peer.PeerCerts()
+	assert.Equal(t, 1, len(certs), "certs.")
+	assert.Equal(t, []string{"hi", "hi@default"}, CertNames(certs[0]), "names.")
+	assert.Nil(t, NewTcpClientFromConn(c1).PeerCerts(), "not tls.")
+	_ = c0.Close()
+	_ = c1.Close()
+}
@@ -0,0 +1,39 @@
+package libol
+
+import (
+	"github.com/golang/snappy"
+)
+
+const (
+	COMPRESS_SNAPPY = "snappy"
+	COMPRESSMIN     = 64 // too short to shrink.
+)
+
+func IsCompress(algo string) bool {
+	return algo == COMPRESS_SNAPPY
+}
+
+// compress into buf, and returns nil if not shrunk, and the frame should
+// be sent as it.
+func compress(buf, data []byte) []byte {
+	if len(data) < COMPRESSMIN {
+		return nil
+	}
+	out := snappy.Encode(buf, data)
+	if len(out) >= len(data) {
+		return nil
+	}
+	return out
+}
+
+// decompress into buf, and the length is limited by max.
+func decompress(buf, data []byte, max int) ([]byte, error) {
+	size, err := snappy.DecodedLen(data)
+	if err != nil {
+		return nil, err
+	}
+	if size > max || size > len(buf) {
+		return nil, NewErr("decompressed size(%d) too large", size)
+	}
+	return snappy.Decode(buf[:size], data)
+}
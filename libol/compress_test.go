@@ -0,0 +1,51 @@
+package libol
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	"net"
+	"testing"
+)
+
+func TestCompressClientMsg(t *testing.T) {
+	c0, c1 := net.Pipe()
+	client := NewTcpClientFromConn(c0)
+	peer := NewTcpClientFromConn(c1)
+	client.SetCompress(COMPRESS_SNAPPY)
+	peer.SetCompress(COMPRESS_SNAPPY)
+	point, server := newTestCrypts(t, "")
+	client.SetCrypt(point)
+	peer.SetCrypt(server)
+
+	frames := [][]byte{
+		bytes.Repeat([]byte{0x01}, 1024),
+		[]byte("hello openlan frame"),
+		bytes.Repeat([]byte("arp who has"), 100),
+	}
+	go func() {
+		for _, frame := range frames {
+			_ = client.WriteMsg(frame)
+		}
+	}()
+	data := make([]byte, MAXBUF)
+	for _, frame := range frames {
+		n, err := peer.ReadMsg(data)
+		assert.Nil(t, err, "read.")
+		assert.Equal(t, frame, data[:n], "be the same.")
+	}
+	sts := client.Sts()
+	assert.Equal(t, uint64(1), sts.CompressSkip, "skipped.")
+	assert.Equal(t, uint64(1024+1100), sts.CompressIn, "compressed.")
+	assert.True(t, sts.TxRatio() < 0.5, "shrunk.")
+	assert.Equal(t, sts.CompressOut, peer.Sts().DecompressIn, "be the same.")
+
+	// compressed is refused if not negotiated.
+	peer.SetCompress("")
+	go func() {
+		_ = client.WriteMsg(frames[0])
+	}()
+	_, err := peer.ReadMsg(data)
+	assert.NotNil(t, err, "not negotiated.")
+	client.Close()
+	peer.Close()
+}
@@ -0,0 +1,208 @@
+package libol
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"sync"
+)
+
+const (
+	CRYPT_AESGCM = "aes-gcm"
+	CRYPTSEQ     = 0x08
+)
+
+var errReplayed = NewErr("replayed sequence")
+
+// CryptKey is the key pair of X25519 exchanged in login.
+type CryptKey struct {
+	private *ecdh.PrivateKey
+}
+
+func NewCryptKey() (*CryptKey, error) {
+	key, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	return &CryptKey{private: key}, nil
+}
+
+func (k *CryptKey) Public() []byte {
+	return k.private.PublicKey().Bytes()
+}
+
+func (k *CryptKey) Shared(peer []byte) ([]byte, error) {
+	pub, err := ecdh.X25519().NewPublicKey(peer)
+	if err != nil {
+		return nil, err
+	}
+	return k.private.ECDH(pub)
+}
+
+// hkdf is HKDF-SHA256 of RFC 5869 for one block of output.
+func hkdf(secret, salt []byte, info string) []byte {
+	extract := hmac.New(sha256.New, salt)
+	extract.Write(secret)
+	prk := extract.Sum(nil)
+
+	expand := hmac.New(sha256.New, prk)
+	expand.Write([]byte(info))
+	expand.Write([]byte{0x01})
+	return expand.Sum(nil)
+}
+
+// Replay window of the last 64 sequences.
+type replayWindow struct {
+	last   uint64
+	bitmap uint64
+}
+
+func (w *replayWindow) Check(seq uint64) bool {
+	if seq == 0 {
+		return false
+	}
+	if seq > w.last {
+		diff := seq - w.last
+		if diff < 64 {
+			w.bitmap = w.bitmap<<diff | 1
+		} else {
+			w.bitmap = 1
+		}
+		w.last = seq
+		return true
+	}
+	diff := w.last - seq
+	if diff >= 64 {
+		return false
+	}
+	bit := uint64(1) << diff
+	if w.bitmap&bit != 0 {
+		return false
+	}
+	w.bitmap |= bit
+	return true
+}
+
+// Crypt seals and opens frames in a session by AEAD.
+type Crypt struct {
+	algo    string
+	txLock  sync.Mutex
+	tx      cipher.AEAD
+	txSeq   uint64
+	txNonce []byte
+	rxLock  sync.Mutex
+	rx      cipher.AEAD
+	rxNonce []byte
+	window  replayWindow
+}
+
+// NewCrypt derives keys of both directions from the shared secret of
+// ECDH and a pre-shared key, either could be empty but not both.
+func NewCrypt(algo string, shared []byte, psk string, server bool) (*Crypt, error) {
+	if algo != CRYPT_AESGCM {
+		return nil, NewErr("not support crypt %s", algo)
+	}
+	if len(shared) == 0 && psk == "" {
+		return nil, NewErr("no secret for crypt")
+	}
+	secret := append([]byte(psk), shared...)
+	up := hkdf(secret, []byte(psk), "openlan point to switch")
+	down := hkdf(secret, []byte(psk), "openlan switch to point")
+	if server {
+		up, down = down, up
+	}
+	tx, err := newAesGcm(up)
+	if err != nil {
+		return nil, err
+	}
+	rx, err := newAesGcm(down)
+	if err != nil {
+		return nil, err
+	}
+	return &Crypt{
+		algo:    algo,
+		tx:      tx,
+		txNonce: make([]byte, tx.NonceSize()),
+		rx:      rx,
+		rxNonce: make([]byte, rx.NonceSize()),
+	}, nil
+}
+
+func newAesGcm(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func (c *Crypt) Algo() string {
+	return c.algo
+}
+
+// Overhead is length of sequence and tag.
+func (c *Crypt) Overhead() int {
+	return CRYPTSEQ + c.tx.Overhead()
+}
+
+// Seal returns sequence with sealed data.
+func (c *Crypt) Seal(data []byte) []byte {
+	return c.SealTo(make([]byte, 0, len(data)+c.Overhead()), data)
+}
+
+// SealTo appends sequence with sealed data to dst.
+func (c *Crypt) SealTo(dst, data []byte) []byte {
+	c.txLock.Lock()
+	defer c.txLock.Unlock()
+
+	c.txSeq++
+	off := len(dst)
+	var seq [CRYPTSEQ]byte
+	binary.BigEndian.PutUint64(seq[:], c.txSeq)
+	dst = append(dst, seq[:]...)
+	copy(c.txNonce[len(c.txNonce)-CRYPTSEQ:], seq[:])
+	return c.tx.Seal(dst, c.txNonce, data, dst[off:])
+}
+
+// Verify checks the sealed data is newer than all received, and leaves
+// the data and replay window untouched.
+func (c *Crypt) Verify(data []byte) bool {
+	if len(data) < c.Overhead() {
+		return false
+	}
+	c.rxLock.Lock()
+	defer c.rxLock.Unlock()
+
+	seq := data[:CRYPTSEQ]
+	if binary.BigEndian.Uint64(seq) <= c.window.last {
+		return false
+	}
+	copy(c.rxNonce[len(c.rxNonce)-CRYPTSEQ:], seq)
+	_, err := c.rx.Open(nil, c.rxNonce, data[CRYPTSEQ:], seq)
+	return err == nil
+}
+
+// Open verifies and returns the data opened in place, and drops the
+// replayed.
+func (c *Crypt) Open(data []byte) ([]byte, error) {
+	if len(data) < c.Overhead() {
+		return nil, NewErr("too short to open")
+	}
+	c.rxLock.Lock()
+	defer c.rxLock.Unlock()
+
+	seq := data[:CRYPTSEQ]
+	copy(c.rxNonce[len(c.rxNonce)-CRYPTSEQ:], seq)
+	plain, err := c.rx.Open(data[CRYPTSEQ:CRYPTSEQ], c.rxNonce, data[CRYPTSEQ:], seq)
+	if err != nil {
+		return nil, err
+	}
+	if !c.window.Check(binary.BigEndian.Uint64(seq)) {
+		return nil, errReplayed
+	}
+	return plain, nil
+}
@@ -0,0 +1,91 @@
+package libol
+
+import (
+	"github.com/stretchr/testify/assert"
+	"net"
+	"testing"
+)
+
+func newTestCrypts(t *testing.T, psk string) (*Crypt, *Crypt) {
+	pk, err := NewCryptKey()
+	assert.Nil(t, err, "key.")
+	sk, err := NewCryptKey()
+	assert.Nil(t, err, "key.")
+	ps, err := pk.Shared(sk.Public())
+	assert.Nil(t, err, "shared.")
+	ss, err := sk.Shared(pk.Public())
+	assert.Nil(t, err, "shared.")
+	assert.Equal(t, ps, ss, "be the same.")
+
+	point, err := NewCrypt(CRYPT_AESGCM, ps, psk, false)
+	assert.Nil(t, err, "crypt.")
+	server, err := NewCrypt(CRYPT_AESGCM, ss, psk, true)
+	assert.Nil(t, err, "crypt.")
+	return point, server
+}
+
+func TestCryptSealAndOpen(t *testing.T) {
+	point, server := newTestCrypts(t, "hi")
+
+	frame := []byte("hello openlan frame")
+	sealed := point.Seal(frame)
+	replay := append([]byte{}, sealed...)
+	assert.Equal(t, len(frame)+point.Overhead(), len(sealed), "overhead.")
+	data, err := server.Open(sealed)
+	assert.Nil(t, err, "open.")
+	assert.Equal(t, frame, data, "be the same.")
+
+	_, err = server.Open(replay)
+	assert.Equal(t, errReplayed, err, "replayed.")
+	_, err = point.Open(point.Seal(frame))
+	assert.NotNil(t, err, "direction.")
+
+	sealed = point.Seal(frame)
+	sealed[len(sealed)-1] ^= 0x01
+	_, err = server.Open(sealed)
+	assert.NotNil(t, err, "tampered.")
+
+	// other psk can't open.
+	other, _ := newTestCrypts(t, "hello")
+	_, err = server.Open(other.Seal(frame))
+	assert.NotNil(t, err, "psk.")
+}
+
+func TestCryptReplayWindow(t *testing.T) {
+	w := replayWindow{}
+	assert.True(t, w.Check(2), "new.")
+	assert.True(t, w.Check(1), "reorder.")
+	assert.False(t, w.Check(1), "replayed.")
+	assert.True(t, w.Check(100), "jump.")
+	assert.False(t, w.Check(30), "too old.")
+	assert.True(t, w.Check(99), "in window.")
+	assert.False(t, w.Check(0), "zero.")
+}
+
+func TestCryptClientMsg(t *testing.T) {
+	point, server := newTestCrypts(t, "")
+	c0, c1 := net.Pipe()
+	client := NewTcpClientFromConn(c0)
+	peer := NewTcpClientFromConn(c1)
+	client.SetCrypt(point)
+	peer.SetCrypt(server)
+
+	frame := []byte("hello openlan frame")
+	go func() {
+		_ = client.WriteMsg(frame)
+	}()
+	data := make([]byte, MAXBUF)
+	n, err := peer.ReadMsg(data)
+	assert.Nil(t, err, "read.")
+	assert.Equal(t, frame, data[:n], "be the same.")
+
+	// cleartext is refused after crypt enabled.
+	client.SetCrypt(nil)
+	go func() {
+		_ = client.WriteMsg(frame)
+	}()
+	_, err = peer.ReadMsg(data)
+	assert.NotNil(t, err, "cleartext.")
+	client.Close()
+	peer.Close()
+}
@@ -0,0 +1,285 @@
+package libol
+
+import (
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SourceIP returns the ip of address likes 1.2.3.4:1234 or 1.2.3.4:1234#1
+// of stream.
+func SourceIP(addr string) string {
+	if i := strings.Index(addr, "#"); i >= 0 {
+		addr = addr[:i]
+	}
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		return host
+	}
+	return addr
+}
+
+// AddrFilter accepts the address in allow if not empty, and not in deny.
+type AddrFilter struct {
+	Allow []*net.IPNet
+	Deny  []*net.IPNet
+}
+
+// ParseCIDRs parses the list of CIDR or IP address.
+func ParseCIDRs(values []string) ([]*net.IPNet, error) {
+	nets := make([]*net.IPNet, 0, len(values))
+	for _, v := range values {
+		if !strings.Contains(v, "/") {
+			if ip := net.ParseIP(v); ip != nil && ip.To4() != nil {
+				v += "/32"
+			} else {
+				v += "/128"
+			}
+		}
+		_, ipNet, err := net.ParseCIDR(v)
+		if err != nil {
+			return nil, err
+		}
+		nets = append(nets, ipNet)
+	}
+	return nets, nil
+}
+
+func NewAddrFilter(allow, deny []string) (*AddrFilter, error) {
+	f := &AddrFilter{}
+	var err error
+	if f.Allow, err = ParseCIDRs(allow); err != nil {
+		return nil, err
+	}
+	if f.Deny, err = ParseCIDRs(deny); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func containsIP(nets []*net.IPNet, ip net.IP) bool {
+	for _, ipNet := range nets {
+		if ipNet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+func (f *AddrFilter) Permit(ip net.IP) bool {
+	if ip == nil {
+		return len(f.Allow) == 0
+	}
+	if containsIP(f.Deny, ip) {
+		return false
+	}
+	return len(f.Allow) == 0 || containsIP(f.Allow, ip)
+}
+
+// TokenBucket allows rate per second, and burst at most.
+type TokenBucket struct {
+	lock   sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func NewTokenBucket(rate, burst int) *TokenBucket {
+	if burst < rate {
+		burst = rate
+	}
+	return &TokenBucket{
+		rate:   float64(rate),
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   time.Now(),
+	}
+}
+
+func (b *TokenBucket) Allow() bool {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	now := time.Now()
+	b.tokens += now.Sub(b.last).Seconds() * b.rate
+	if b.tokens > b.burst {
+		b.tokens = b.burst
+	}
+	b.last = now
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// Ban is a source banned for login failed repeatedly.
+type Ban struct {
+	Source string
+	Failed int
+	Until  time.Time
+}
+
+// Guard limits clients of all servers by number and rate, and bans the
+// source temporarily if login failed repeatedly.
+type Guard struct {
+	lock         sync.Mutex
+	maxClient    int
+	maxPerSource int
+	bucket       *TokenBucket
+	maxFailed    int
+	banTime      time.Duration
+	clients      int
+	sources      map[string]int
+	failed       map[string]*Ban // counting, and reset after ban time.
+	bans         map[string]*Ban
+}
+
+// NewGuard returns a guard, and the zero is unlimited.
+func NewGuard(maxClient, maxPerSource, rate, burst, maxFailed int, banTime time.Duration) *Guard {
+	g := &Guard{
+		maxClient:    maxClient,
+		maxPerSource: maxPerSource,
+		maxFailed:    maxFailed,
+		banTime:      banTime,
+		sources:      make(map[string]int, 1024),
+		failed:       make(map[string]*Ban, 32),
+		bans:         make(map[string]*Ban, 32),
+	}
+	if rate > 0 {
+		g.bucket = NewTokenBucket(rate, burst)
+	}
+	return g
+}
+
+// banned returns true if not expired, and it is locked by caller.
+func (g *Guard) banned(ip string) bool {
+	ban, ok := g.bans[ip]
+	if !ok {
+		return false
+	}
+	if time.Now().Before(ban.Until) {
+		return true
+	}
+	delete(g.bans, ip)
+	return false
+}
+
+// Accept checks a new connection by ban and rate.
+func (g *Guard) Accept(ip string) error {
+	g.lock.Lock()
+	banned := g.banned(ip)
+	g.lock.Unlock()
+	if banned {
+		return NewErr("%s banned", ip)
+	}
+	if g.bucket != nil && !g.bucket.Allow() {
+		return NewErr("%s exceeded rate", ip)
+	}
+	return nil
+}
+
+// OnClient counts the client, and returns error if exceeded.
+func (g *Guard) OnClient(ip string) error {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+
+	if g.maxClient > 0 && g.clients >= g.maxClient {
+		return NewErr("exceeded %d clients", g.maxClient)
+	}
+	if g.maxPerSource > 0 && g.sources[ip] >= g.maxPerSource {
+		return NewErr("%s exceeded %d clients", ip, g.maxPerSource)
+	}
+	g.clients++
+	g.sources[ip]++
+	return nil
+}
+
+func (g *Guard) OffClient(ip string) {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+
+	if g.clients > 0 {
+		g.clients--
+	}
+	if n := g.sources[ip]; n > 1 {
+		g.sources[ip] = n - 1
+	} else {
+		delete(g.sources, ip)
+	}
+}
+
+// OnFailed counts login failed in ban time, and returns true if banned
+// now.
+func (g *Guard) OnFailed(ip string) bool {
+	if g.maxFailed <= 0 {
+		return false
+	}
+	g.lock.Lock()
+	defer g.lock.Unlock()
+
+	now := time.Now()
+	for source, f := range g.failed {
+		if now.After(f.Until) {
+			delete(g.failed, source)
+		}
+	}
+	f, ok := g.failed[ip]
+	if !ok {
+		f = &Ban{Source: ip, Until: now.Add(g.banTime)}
+		g.failed[ip] = f
+	}
+	f.Failed++
+	if f.Failed < g.maxFailed {
+		return false
+	}
+	g.bans[ip] = &Ban{
+		Source: ip,
+		Failed: f.Failed,
+		Until:  now.Add(g.banTime),
+	}
+	delete(g.failed, ip)
+	return true
+}
+
+// OnSuccess clears login failed of the source.
+func (g *Guard) OnSuccess(ip string) {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	delete(g.failed, ip)
+}
+
+// Bans returns the bans not expired in order of source.
+func (g *Guard) Bans() []Ban {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+
+	bans := make([]Ban, 0, len(g.bans))
+	for ip, ban := range g.bans {
+		if g.banned(ip) {
+			bans = append(bans, *ban)
+		}
+	}
+	sort.Slice(bans, func(i, j int) bool {
+		return bans[i].Source < bans[j].Source
+	})
+	return bans
+}
+
+// Unban clears the ban of source, and all if empty.
+func (g *Guard) Unban(ip string) bool {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+
+	if ip == "" {
+		g.bans = make(map[string]*Ban, 32)
+		return true
+	}
+	if _, ok := g.bans[ip]; !ok {
+		return false
+	}
+	delete(g.bans, ip)
+	return true
+}
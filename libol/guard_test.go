@@ -0,0 +1,53 @@
+package libol
+
+import (
+	"github.com/stretchr/testify/assert"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestAddrFilter(t *testing.T) {
+	f, err := NewAddrFilter([]string{"10.0.0.0/8"}, []string{"10.0.0.1"})
+	assert.Nil(t, err, "new.")
+	assert.True(t, f.Permit(net.ParseIP("10.1.1.1")), "allowed.")
+	assert.False(t, f.Permit(net.ParseIP("10.0.0.1")), "denied.")
+	assert.False(t, f.Permit(net.ParseIP("192.168.1.1")), "not allowed.")
+
+	_, err = NewAddrFilter(nil, []string{"10.0.0.0/40"})
+	assert.NotNil(t, err, "invalid.")
+	assert.Equal(t, "10.0.0.1", SourceIP("10.0.0.1:1234#3"), "stream.")
+}
+
+func TestGuard(t *testing.T) {
+	g := NewGuard(3, 2, 2, 2, 2, time.Minute)
+	assert.Nil(t, g.Accept("10.0.0.1"), "burst.")
+	assert.Nil(t, g.Accept("10.0.0.1"), "burst.")
+	assert.NotNil(t, g.Accept("10.0.0.1"), "rate.")
+
+	assert.Nil(t, g.OnClient("10.0.0.1"), "client.")
+	assert.Nil(t, g.OnClient("10.0.0.1"), "client.")
+	assert.NotNil(t, g.OnClient("10.0.0.1"), "per source.")
+	assert.Nil(t, g.OnClient("10.0.0.2"), "client.")
+	assert.NotNil(t, g.OnClient("10.0.0.3"), "total.")
+	g.OffClient("10.0.0.1")
+	assert.Nil(t, g.OnClient("10.0.0.3"), "client.")
+
+	assert.False(t, g.OnFailed("10.0.0.4"), "failed.")
+	assert.True(t, g.OnFailed("10.0.0.4"), "banned.")
+	bans := g.Bans()
+	assert.Equal(t, 1, len(bans), "bans.")
+	assert.Equal(t, "10.0.0.4", bans[0].Source, "bans.")
+	time.Sleep(600 * time.Millisecond)
+	assert.NotNil(t, g.Accept("10.0.0.4"), "banned.")
+	assert.True(t, g.Unban("10.0.0.4"), "unban.")
+	assert.False(t, g.Unban("10.0.0.4"), "not found.")
+	assert.Nil(t, g.Accept("10.0.0.4"), "unbanned.")
+
+	// failed is reset after ban time.
+	g = NewGuard(0, 0, 0, 0, 2, 200*time.Millisecond)
+	assert.False(t, g.OnFailed("10.0.0.5"), "failed.")
+	time.Sleep(300 * time.Millisecond)
+	assert.False(t, g.OnFailed("10.0.0.5"), "reset.")
+	assert.True(t, g.OnFailed("10.0.0.5"), "banned.")
+}
@@ -0,0 +1,67 @@
+package libol
+
+import (
+	"net"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+// Heartbeat is "ping=" with time of sender, and "pong:" echoes it.
+
+type heartbeat struct {
+	pings  int32 // not answered.
+	conn   net.Conn
+	srtt   int64
+	rttVar int64
+}
+
+// Ping sends a heartbeat, and returns the number of pings not answered
+// before it.
+func (t *connWrapper) Ping() (int, error) {
+	if conn := t.getConn(); t.beat.conn != conn { // reset for new connection.
+		t.beat.conn = conn
+		atomic.StoreInt32(&t.beat.pings, 0)
+	}
+	missed := int(atomic.AddInt32(&t.beat.pings, 1)) - 1
+	body := strconv.FormatInt(time.Now().UnixNano(), 10)
+	return missed, t.WriteReq("ping", body)
+}
+
+// Pong answers the ping with its body.
+func (t *connWrapper) Pong(body string) error {
+	return t.WriteResp("pong", body)
+}
+
+// OnPong updates the smoothed RTT and jitter like RFC 6298.
+func (t *connWrapper) OnPong(body string) {
+	sent, err := strconv.ParseInt(body, 10, 64)
+	if err != nil {
+		Warn("connWrapper.OnPong: %s %s", t, err)
+		return
+	}
+	atomic.StoreInt32(&t.beat.pings, 0)
+	rtt := time.Now().UnixNano() - sent
+	if rtt < 0 {
+		return
+	}
+	srtt := atomic.LoadInt64(&t.beat.srtt)
+	rttVar := atomic.LoadInt64(&t.beat.rttVar)
+	if srtt == 0 {
+		srtt, rttVar = rtt, rtt/2
+	} else {
+		diff := srtt - rtt
+		if diff < 0 {
+			diff = -diff
+		}
+		rttVar = (3*rttVar + diff) / 4
+		srtt = (7*srtt + rtt) / 8
+	}
+	atomic.StoreInt64(&t.beat.srtt, srtt)
+	atomic.StoreInt64(&t.beat.rttVar, rttVar)
+}
+
+// Rtt returns the smoothed RTT and jitter.
+func (t *connWrapper) Rtt() (time.Duration, time.Duration) {
+	return time.Duration(atomic.LoadInt64(&t.beat.srtt)), time.Duration(atomic.LoadInt64(&t.beat.rttVar))
+}
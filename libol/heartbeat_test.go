@@ -0,0 +1,51 @@
+package libol
+
+import (
+	"github.com/stretchr/testify/assert"
+	"net"
+	"testing"
+)
+
+func TestHeartbeatPingPong(t *testing.T) {
+	c0, c1 := net.Pipe()
+	client := NewTcpClientFromConn(c0)
+	peer := NewTcpClientFromConn(c1)
+
+	data := make([]byte, MAXBUF)
+	for i := 0; i < 2; i++ {
+		go func() {
+			_, _ = client.Ping()
+		}()
+		n, err := peer.ReadMsg(data)
+		assert.Nil(t, err, "read.")
+		action, body := NewFrameMessage(data[:n]).CmdAndParams()
+		assert.Equal(t, "ping=", action, "ping.")
+		go func() {
+			_ = peer.Pong(body)
+		}()
+		n, err = client.ReadMsg(data)
+		assert.Nil(t, err, "read.")
+		action, body = NewFrameMessage(data[:n]).CmdAndParams()
+		assert.Equal(t, "pong:", action, "pong.")
+		client.OnPong(body)
+	}
+	rtt, jitter := client.Rtt()
+	assert.True(t, rtt > 0, "rtt.")
+	assert.True(t, jitter >= 0, "jitter.")
+
+	// not answered are counted.
+	go func() {
+		for {
+			if _, err := peer.ReadMsg(data); err != nil {
+				return
+			}
+		}
+	}()
+	for i := 0; i < 3; i++ {
+		missed, err := client.Ping()
+		assert.Nil(t, err, "ping.")
+		assert.Equal(t, i, missed, "missed.")
+	}
+	client.Close()
+	peer.Close()
+}
@@ -3,6 +3,7 @@ package libol
 import (
 	"os/exec"
 	"runtime"
+	"strconv"
 	"strings"
 )
 
@@ -42,6 +43,29 @@ func IpLinkDown(name string) ([]byte, error) {
 	}
 }
 
+func IpLinkMtu(name string, mtu int) ([]byte, error) {
+	switch runtime.GOOS {
+	case "linux":
+		args := []string{
+			"link", "set", "dev", name, "mtu", strconv.Itoa(mtu),
+		}
+		return exec.Command("/usr/sbin/ip", args...).CombinedOutput()
+	case "windows":
+		args := []string{
+			"interface", "ipv4", "set", "subinterface",
+			name, "mtu=" + strconv.Itoa(mtu),
+		}
+		return exec.Command("netsh", args...).CombinedOutput()
+	case "darwin":
+		args := []string{
+			name, "mtu", strconv.Itoa(mtu),
+		}
+		return exec.Command("/sbin/ifconfig", args...).CombinedOutput()
+	default:
+		return nil, NewErr("IpLinkMtu %s not support", runtime.GOOS)
+	}
+}
+
 func IpAddrAdd(name, addr string, opts ...string) ([]byte, error) {
 	switch runtime.GOOS {
 	case "linux":
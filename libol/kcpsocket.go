@@ -1,27 +1,97 @@
 package libol
 
 import (
+	"crypto/sha1"
 	"github.com/xtaci/kcp-go/v5"
+	"golang.org/x/crypto/pbkdf2"
 	"net"
+	"sync/atomic"
 	"time"
 )
 
 type KcpConfig struct {
-	block        kcp.BlockCrypt
-	dataShards   int // default 1024
-	parityShards int // default 3
+	Block        kcp.BlockCrypt
+	DataShards   int // default 1024
+	ParityShards int // default 3
+	NoDelay      int // zero keep the default of kcp.
+	Interval     int
+	Resend       int
+	NoCongestion int
+	SndWnd       int
+	RcvWnd       int
+	Mtu          int
+	TcpRaw       bool // packets over fake tcp by tcpraw.
 }
 
 var defaultKcpConfig = KcpConfig{
-	block:        nil,
-	dataShards:   1024,
-	parityShards: 3,
+	Block:        nil,
+	DataShards:   1024,
+	ParityShards: 3,
+}
+
+const kcpSalt = "openlan-kcp"
+
+// NewKcpBlock returns the block crypt by cipher name, and key derived from
+// the pre-shared key by pbkdf2.
+func NewKcpBlock(cipher, key string) (kcp.BlockCrypt, error) {
+	pass := pbkdf2.Key([]byte(key), []byte(kcpSalt), 4096, 32, sha1.New)
+	switch cipher {
+	case "", "none":
+		return nil, nil
+	case "aes":
+		return kcp.NewAESBlockCrypt(pass)
+	case "aes-128":
+		return kcp.NewAESBlockCrypt(pass[:16])
+	case "aes-192":
+		return kcp.NewAESBlockCrypt(pass[:24])
+	case "salsa20":
+		return kcp.NewSalsa20BlockCrypt(pass)
+	case "blowfish":
+		return kcp.NewBlowfishBlockCrypt(pass)
+	case "twofish":
+		return kcp.NewTwofishBlockCrypt(pass)
+	case "cast5":
+		return kcp.NewCast5BlockCrypt(pass[:16])
+	case "3des":
+		return kcp.NewTripleDESBlockCrypt(pass[:24])
+	case "tea":
+		return kcp.NewTEABlockCrypt(pass[:16])
+	case "xtea":
+		return kcp.NewXTEABlockCrypt(pass[:16])
+	case "sm4":
+		return kcp.NewSM4BlockCrypt(pass[:16])
+	case "xor":
+		return kcp.NewSimpleXORBlockCrypt(pass)
+	}
+	return nil, NewErr("not support cipher %s", cipher)
+}
+
+func (c *KcpConfig) Apply(conn *kcp.UDPSession) {
+	if c.Interval > 0 {
+		conn.SetNoDelay(c.NoDelay, c.Interval, c.Resend, c.NoCongestion)
+	}
+	if c.SndWnd > 0 || c.RcvWnd > 0 {
+		sndWnd, rcvWnd := c.SndWnd, c.RcvWnd
+		if sndWnd == 0 {
+			sndWnd = kcp.IKCP_WND_SND
+		}
+		if rcvWnd == 0 {
+			rcvWnd = kcp.IKCP_WND_RCV
+		}
+		conn.SetWindowSize(sndWnd, rcvWnd)
+	}
+	if c.Mtu > 0 {
+		if !conn.SetMtu(c.Mtu) {
+			Warn("KcpConfig.Apply: invalid mtu %d", c.Mtu)
+		}
+	}
 }
 
 type KcpServer struct {
 	socketServer
 	kcpCfg   *KcpConfig
-	listener *kcp.Listener
+	listener *kcp.Listener // guarded by lock.
+	rawConn  net.PacketConn
 }
 
 func NewKcpServer(listen string, cfg *KcpConfig) *KcpServer {
@@ -47,28 +117,61 @@ func NewKcpServer(listen string, cfg *KcpConfig) *KcpServer {
 }
 
 func (k *KcpServer) Listen() (err error) {
-	k.listener, err = kcp.ListenWithOptions(k.addr, k.kcpCfg.block, k.kcpCfg.dataShards, k.kcpCfg.parityShards)
+	cfg := k.kcpCfg
+	if cfg.TcpRaw {
+		conn, err := ListenTcpRaw(k.addr)
+		if err != nil {
+			return err
+		}
+		listener, err := kcp.ServeConn(cfg.Block, cfg.DataShards, cfg.ParityShards, conn)
+		if err != nil {
+			_ = conn.Close()
+			return err
+		}
+		k.lock.Lock()
+		k.listener = listener
+		k.rawConn = conn
+		k.lock.Unlock()
+		Info("KcpServer.Listen: kcp+tcpraw://%s", k.addr)
+		return nil
+	}
+	listener, err := kcp.ListenWithOptions(k.addr, cfg.Block, cfg.DataShards, cfg.ParityShards)
 	if err != nil {
-		k.listener = nil
 		return err
 	}
+	k.lock.Lock()
+	k.listener = listener
+	k.lock.Unlock()
 	Info("KcpServer.Listen: kcp://%s", k.addr)
 	return nil
 }
 
+func (k *KcpServer) getListener() *kcp.Listener {
+	k.lock.RLock()
+	defer k.lock.RUnlock()
+	return k.listener
+}
+
 func (k *KcpServer) Close() {
-	if k.listener != nil {
-		_ = k.listener.Close()
+	k.lock.Lock()
+	listener, rawConn := k.listener, k.rawConn
+	k.listener, k.rawConn = nil, nil
+	k.lock.Unlock()
+	if listener != nil {
+		_ = listener.Close()
 		Info("KcpServer.Close: %s", k.addr)
-		k.listener = nil
+	}
+	if rawConn != nil {
+		_ = rawConn.Close()
 	}
 }
 
 func (k *KcpServer) Accept() {
 	Debug("KcpServer.Accept")
 
+	var listener *kcp.Listener
 	for {
-		if k.listener != nil {
+		if listener = k.getListener(); listener != nil {
 			break
 		}
 		if err := k.Listen(); err != nil {
@@ -78,18 +181,65 @@ func (k *KcpServer) Accept() {
 	}
 	defer k.Close()
 	for {
-		conn, err := k.listener.Accept()
+		conn, err := listener.AcceptKCP()
 		if err != nil {
 			Error("KcpServer.Accept: %s", err)
 			return
 		}
-		k.sts.AcpCount++
-		k.onClients <- NewKcpClientFromConn(conn)
+		if err := k.permit(conn.RemoteAddr().String()); err != nil {
+			Debug("KcpServer.Accept: %s", err)
+			_ = conn.Close()
+			continue
+		}
+		k.kcpCfg.Apply(conn)
+		atomic.AddInt64(&k.sts.AcpCount, 1)
+		go MuxAccept(conn, k.newClient, k.onClients, k.permit)
 	}
 }
 
+func (k *KcpServer) newClient(conn net.Conn) SocketClient {
+	return NewKcpClientFromConn(conn)
+}
+
 // Client Implement
 
+func DialKcp(addr string, cfg *KcpConfig) (net.Conn, error) {
+	if cfg == nil {
+		cfg = &defaultKcpConfig
+	}
+	if cfg.TcpRaw {
+		raw, err := DialTcpRaw(addr)
+		if err != nil {
+			return nil, err
+		}
+		conn, err := kcp.NewConn(addr, cfg.Block, cfg.DataShards, cfg.ParityShards, raw)
+		if err != nil {
+			_ = raw.Close()
+			return nil, err
+		}
+		cfg.Apply(conn)
+		return &kcpRawConn{UDPSession: conn, raw: raw}, nil
+	}
+	conn, err := kcp.DialWithOptions(addr, cfg.Block, cfg.DataShards, cfg.ParityShards)
+	if err != nil {
+		return nil, err
+	}
+	cfg.Apply(conn)
+	return conn, nil
+}
+
+// kcpRawConn closes the tcpraw connection with session, that kcp not owns.
+type kcpRawConn struct {
+	*kcp.UDPSession
+	raw net.PacketConn
+}
+
+func (c *kcpRawConn) Close() error {
+	err := c.UDPSession.Close()
+	_ = c.raw.Close()
+	return err
+}
+
 type KcpClient struct {
 	socketClient
 	kcpCfg *KcpConfig
@@ -132,15 +282,15 @@ func NewKcpClientFromConn(conn net.Conn) *KcpClient {
 }
 
 func (c *KcpClient) LocalAddr() string {
-	if c.conn != nil {
-		return c.conn.LocalAddr().String()
+	if conn := c.getConn(); conn != nil {
+		return conn.LocalAddr().String()
 	}
 	return c.addr
 }
 
 func (c *KcpClient) Connect() error {
 	c.lock.Lock()
-	if c.conn != nil || c.status == CL_TERMINAL || c.status == CL_UNAUTH {
+	if c.getConn() != nil || c.status == CL_TERMINAL || c.status == CL_UNAUTH {
 		c.lock.Unlock()
 		return nil
 	}
@@ -148,28 +298,30 @@ func (c *KcpClient) Connect() error {
 	c.lock.Unlock()
 
 	Info("KcpClient.Connect: kcp://%s", c.addr)
-	conn, err := kcp.DialWithOptions(c.addr, c.kcpCfg.block, c.kcpCfg.dataShards, c.kcpCfg.dataShards)
-	if err == nil {
-		c.lock.Lock()
-		c.conn = conn
-		c.status = CL_CONNECTED
-		c.lock.Unlock()
-		if c.listener.OnConnected != nil {
-			_ = c.listener.OnConnected(c)
-		}
+	conn, err := DialKcp(c.addr, c.kcpCfg)
+	if err != nil {
+		return err
+	}
+
+	c.lock.Lock()
+	c.setConn(conn)
+	c.status = CL_CONNECTED
+	c.lock.Unlock()
+	if c.listener.OnConnected != nil {
+		_ = c.listener.OnConnected(c)
 	}
 	return nil
 }
 
 func (c *KcpClient) Close() {
 	c.lock.Lock()
-	if c.conn != nil {
+	if conn := c.getConn(); conn != nil {
 		if c.status != CL_TERMINAL {
 			c.status = CL_CLOSED
 		}
 		Info("KcpClient.Close: %s", c.addr)
-		_ = c.conn.Close()
-		c.conn = nil
+		_ = conn.Close()
+		c.setConn(nil)
 		c.private = nil
 		c.lock.Unlock()
 		if c.listener.OnClose != nil {
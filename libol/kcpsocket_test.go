@@ -0,0 +1,23 @@
+package libol
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestNewKcpBlock(t *testing.T) {
+	for _, cipher := range []string{"", "none"} {
+		block, err := NewKcpBlock(cipher, "secret")
+		assert.Nil(t, err, cipher)
+		assert.Nil(t, block, cipher)
+	}
+	for _, cipher := range []string{"aes", "aes-128", "aes-192", "salsa20", "blowfish",
+		"twofish", "cast5", "3des", "tea", "xtea", "sm4", "xor"} {
+		block, err := NewKcpBlock(cipher, "secret")
+		assert.Nil(t, err, cipher)
+		assert.NotNil(t, block, cipher)
+	}
+	block, err := NewKcpBlock("aes-512", "secret")
+	assert.NotNil(t, err, "unknown cipher.")
+	assert.Nil(t, block, "no block.")
+}
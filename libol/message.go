@@ -7,8 +7,16 @@ import (
 )
 
 const (
-	MAXBUF = 4096
-	HSIZE  = 0x04
+	MAXBUF   = SIZE_MASK + 1 // enough for a jumbo frame.
+	HSIZE    = 0x04
+	MAXFRAME = SIZE_MASK - 64 // max size of frame, and left for crypt.
+)
+
+// Flags in the size of header.
+const (
+	FLAG_COMPRESS = 0x8000
+	FLAG_CRYPT    = 0x4000
+	SIZE_MASK     = 0x3fff
 )
 
 func GetHeaderLen() int {
@@ -101,10 +109,14 @@ func (c *ControlMessage) Encode() []byte {
 }
 
 func BuildMessage(data []byte) []byte {
+	return BuildMessageWith(data, 0)
+}
+
+func BuildMessageWith(data []byte, flags uint16) []byte {
 	size := len(data)
 	buf := make([]byte, HSIZE+size)
 	copy(buf[0:2], MAGIC)
-	binary.BigEndian.PutUint16(buf[2:4], uint16(size))
+	binary.BigEndian.PutUint16(buf[2:4], uint16(size)|flags)
 	copy(buf[HSIZE:], data)
 	return buf
 }
@@ -0,0 +1,279 @@
+package libol
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/xtaci/smux"
+	"net"
+	"sync"
+	"time"
+)
+
+// A multiplexed session carries many streams on one transport connection,
+// and each stream is used as a socket client for one network.
+
+type MuxDial func() (net.Conn, error)
+
+// peekConn is a connection with buffered reader, so that the first bytes
+// could be peeked before choosing the framing.
+type peekConn struct {
+	net.Conn
+	reader *bufio.Reader
+}
+
+func (c *peekConn) Read(b []byte) (int, error) {
+	return c.reader.Read(b)
+}
+
+// MuxAccept detects the first byte of a new connection. The plain frame
+// always starts with magic 0xff, and else it is a smux session with the
+// version as first byte, then every stream in it is a new client, and
+// checked by permit as a new connection except the first one.
+func MuxAccept(conn net.Conn, newClient func(conn net.Conn) SocketClient, onClients chan SocketClient,
+	permit func(addr string) error) {
+	pc := &peekConn{Conn: conn, reader: bufio.NewReader(conn)}
+	_ = conn.SetReadDeadline(time.Now().Add(30 * time.Second))
+	head, err := pc.reader.Peek(1)
+	_ = conn.SetReadDeadline(time.Time{})
+	if err != nil {
+		Warn("MuxAccept: %s %s", conn.RemoteAddr(), err)
+		_ = conn.Close()
+		return
+	}
+	if head[0] == MAGIC[0] {
+		onClients <- newClient(pc)
+		return
+	}
+
+	cfg := smux.DefaultConfig()
+	cfg.Version = int(head[0])
+	if err := smux.VerifyConfig(cfg); err != nil {
+		Warn("MuxAccept: %s %s", conn.RemoteAddr(), err)
+		_ = conn.Close()
+		return
+	}
+	session, err := smux.Server(pc, cfg)
+	if err != nil {
+		Error("MuxAccept: %s %s", conn.RemoteAddr(), err)
+		_ = conn.Close()
+		return
+	}
+	Info("MuxAccept: %s session with version %d", conn.RemoteAddr(), cfg.Version)
+	defer session.Close()
+	certs := peerCerts(conn)
+	proxy := proxyAddr(conn)
+	for first := true; ; first = false {
+		stream, err := session.AcceptStream()
+		if err != nil {
+			Info("MuxAccept: %s %s", conn.RemoteAddr(), err)
+			return
+		}
+		if !first && permit != nil {
+			if err := permit(conn.RemoteAddr().String()); err != nil {
+				Debug("MuxAccept: %s#%d %s", conn.RemoteAddr(), stream.ID(), err)
+				_ = stream.Close()
+				continue
+			}
+		}
+		var sc net.Conn = stream
+		if certs != nil || proxy != "" {
+			sc = &certConn{Conn: stream, certs: certs, proxy: proxy}
+		}
+		client := newClient(sc)
+		client.SetAddr(fmt.Sprintf("%s#%d", conn.RemoteAddr(), stream.ID()))
+		onClients <- client
+	}
+}
+
+// Session Pool
+
+type muxSession struct {
+	session *smux.Session
+	refs    int
+}
+
+type muxPool struct {
+	lock     sync.Mutex
+	sessions map[string]*muxSession
+}
+
+var muxSessions = muxPool{
+	sessions: make(map[string]*muxSession, 32),
+}
+
+// Open returns a new stream on the session of key, and dials a session if
+// not existed or closed. The dialing is out of lock, so one slow switch
+// never blocks the points to others.
+func (p *muxPool) Open(key string, dial MuxDial) (*smux.Session, *smux.Stream, error) {
+	s := p.get(key)
+	if s == nil {
+		conn, err := dial()
+		if err != nil {
+			return nil, nil, err
+		}
+		session, err := smux.Client(conn, nil)
+		if err != nil {
+			_ = conn.Close()
+			return nil, nil, err
+		}
+		s = p.add(key, session)
+	}
+	stream, err := s.session.OpenStream()
+	if err != nil {
+		p.lock.Lock()
+		if o, ok := p.sessions[key]; ok && o == s {
+			delete(p.sessions, key)
+		}
+		p.lock.Unlock()
+		_ = s.session.Close()
+		return nil, nil, err
+	}
+	return s.session, stream, nil
+}
+
+// get returns the session of key referred, or nil if not existed or closed.
+func (p *muxPool) get(key string) *muxSession {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	s, ok := p.sessions[key]
+	if !ok || s.session.IsClosed() {
+		return nil
+	}
+	s.refs++
+	return s
+}
+
+// add saves the session dialed, and returns the existed one instead if
+// dialed by other meanwhile.
+func (p *muxPool) add(key string, session *smux.Session) *muxSession {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if s, ok := p.sessions[key]; ok && !s.session.IsClosed() {
+		_ = session.Close()
+		s.refs++
+		return s
+	}
+	Info("muxPool.Open: new session %s", key)
+	s := &muxSession{session: session, refs: 1}
+	p.sessions[key] = s
+	return s
+}
+
+// Release closes the session when no streams on it.
+func (p *muxPool) Release(key string, session *smux.Session) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	s, ok := p.sessions[key]
+	if !ok || s.session != session {
+		_ = session.Close()
+		return
+	}
+	s.refs--
+	if s.refs <= 0 {
+		Info("muxPool.Release: close session %s", key)
+		_ = s.session.Close()
+		delete(p.sessions, key)
+	}
+}
+
+// Client Implement
+
+type MuxClient struct {
+	socketClient
+	key     string
+	dial    MuxDial
+	session *smux.Session
+}
+
+// NewMuxClient returns a client as stream, and the clients with same key
+// share one session dialed by dial.
+func NewMuxClient(key, addr string, dial MuxDial) *MuxClient {
+	c := &MuxClient{
+		key:  key,
+		dial: dial,
+		socketClient: socketClient{
+			addr:    addr,
+			NewTime: time.Now().Unix(),
+			connWrapper: connWrapper{
+				maxSize: 1514,
+				minSize: 15,
+			},
+			status: CL_INIT,
+		},
+	}
+	c.connect = c.Connect
+	return c
+}
+
+func (c *MuxClient) LocalAddr() string {
+	if conn := c.getConn(); conn != nil {
+		return conn.LocalAddr().String()
+	}
+	return c.addr
+}
+
+func (c *MuxClient) Connect() error {
+	c.lock.Lock()
+	if c.getConn() != nil || c.status == CL_TERMINAL || c.status == CL_UNAUTH {
+		c.lock.Unlock()
+		return nil
+	}
+	c.status = CL_CONNECTING
+	c.lock.Unlock()
+
+	Info("MuxClient.Connect: %s", c.key)
+	session, stream, err := muxSessions.Open(c.key, c.dial)
+	if err != nil {
+		return err
+	}
+
+	c.lock.Lock()
+	c.setConn(stream)
+	c.session = session
+	c.status = CL_CONNECTED
+	c.lock.Unlock()
+	if c.listener.OnConnected != nil {
+		_ = c.listener.OnConnected(c)
+	}
+	return nil
+}
+
+func (c *MuxClient) Close() {
+	c.lock.Lock()
+	if conn := c.getConn(); conn != nil {
+		if c.status != CL_TERMINAL {
+			c.status = CL_CLOSED
+		}
+		Info("MuxClient.Close: %s", c.key)
+		_ = conn.Close()
+		muxSessions.Release(c.key, c.session)
+		c.setConn(nil)
+		c.session = nil
+		c.private = nil
+		c.lock.Unlock()
+		if c.listener.OnClose != nil {
+			_ = c.listener.OnClose(c)
+		}
+	} else {
+		c.lock.Unlock()
+	}
+}
+
+func (c *MuxClient) Terminal() {
+	c.SetStatus(CL_TERMINAL)
+	c.Close()
+}
+
+func (c *MuxClient) SetStatus(v uint8) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.status != v {
+		if c.listener.OnStatus != nil {
+			c.listener.OnStatus(c, c.status, v)
+		}
+		c.status = v
+	}
+}
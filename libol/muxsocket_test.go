@@ -0,0 +1,95 @@
+package libol
+
+import (
+	"github.com/stretchr/testify/assert"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestMuxClientAndServer(t *testing.T) {
+	server := NewTcpServer("127.0.0.1:18083", nil)
+	frames := make(chan string, 8)
+	go server.Accept()
+	go server.Loop(ServerListener{
+		OnClient: func(client SocketClient) error {
+			client.SetStatus(CL_CONNECTED)
+			return nil
+		},
+		ReadAt: func(client SocketClient, p []byte) error {
+			frames <- string(p)
+			return client.WriteMsg(p)
+		},
+	})
+
+	dial := func() (net.Conn, error) {
+		return DialTcp("127.0.0.1:18083", nil, nil)
+	}
+	key := "tcp://127.0.0.1:18083"
+	clients := []SocketClient{
+		NewMuxClient(key, "127.0.0.1:18083", dial),
+		NewMuxClient(key, "127.0.0.1:18083", dial),
+		NewTcpClient("127.0.0.1:18083", nil),
+	}
+	data := make([]byte, MAXBUF)
+	for _, client := range clients {
+		assert.Nil(t, client.Connect(), "connect.")
+		frame := "hello openlan frame from " + client.LocalAddr()
+		assert.Nil(t, client.WriteMsg([]byte(frame)), "write.")
+		select {
+		case recv := <-frames:
+			assert.Equal(t, frame, recv, "be the same.")
+		case <-time.After(3 * time.Second):
+			t.Fatal("server not received.")
+		}
+		n, err := client.ReadMsg(data)
+		assert.Nil(t, err, "read.")
+		assert.Equal(t, frame, string(data[:n]), "be the same.")
+	}
+	// streams share one session.
+	assert.Equal(t, 1, len(muxSessions.sessions), "one session.")
+	assert.Equal(t, 2, muxSessions.sessions[key].refs, "two streams.")
+
+	for _, client := range clients {
+		client.Close()
+	}
+	assert.Equal(t, 0, len(muxSessions.sessions), "released.")
+	server.Close()
+}
+
+func TestMuxStreamGuard(t *testing.T) {
+	server := NewTcpServer("127.0.0.1:18084", nil)
+	server.SetGuard(NewGuard(0, 1, 0, 0, 0, 0))
+	go server.Accept()
+	go server.Loop(ServerListener{
+		OnClient: func(client SocketClient) error {
+			client.SetStatus(CL_CONNECTED)
+			return nil
+		},
+		ReadAt: func(client SocketClient, p []byte) error {
+			return client.WriteMsg(p)
+		},
+	})
+
+	dial := func() (net.Conn, error) {
+		return DialTcp("127.0.0.1:18084", nil, nil)
+	}
+	key := "tcp://127.0.0.1:18084"
+	first := NewMuxClient(key, "127.0.0.1:18084", dial)
+	second := NewMuxClient(key, "127.0.0.1:18084", dial)
+	data := make([]byte, MAXBUF)
+	assert.Nil(t, first.Connect(), "connect.")
+	assert.Nil(t, first.WriteMsg([]byte("hello openlan frame first")), "write.")
+	_, err := first.ReadMsg(data)
+	assert.Nil(t, err, "read.")
+
+	// the second stream from the same source exceeds the limit.
+	assert.Nil(t, second.Connect(), "connect.")
+	_ = second.WriteMsg([]byte("hello openlan frame second"))
+	_, err = second.ReadMsg(data)
+	assert.NotNil(t, err, "closed by server.")
+
+	first.Close()
+	second.Close()
+	server.Close()
+}
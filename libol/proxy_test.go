@@ -0,0 +1,188 @@
+package libol
+
+import (
+	"bufio"
+	"crypto/tls"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"testing"
+	"time"
+)
+
+func newTestEcho(t *testing.T) net.Listener {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err, "listen.")
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				_, _ = io.Copy(conn, conn)
+				_ = conn.Close()
+			}()
+		}
+	}()
+	return ln
+}
+
+func newTestProxy(t *testing.T, handshake func(conn net.Conn) (string, error)) net.Listener {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err, "listen.")
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				addr, err := handshake(conn)
+				if err != nil {
+					return
+				}
+				peer, err := net.Dial("tcp", addr)
+				if err != nil {
+					return
+				}
+				defer peer.Close()
+				go func() {
+					_, _ = io.Copy(peer, conn)
+				}()
+				_, _ = io.Copy(conn, peer)
+			}()
+		}
+	}()
+	return ln
+}
+
+func testProxyEcho(t *testing.T, proxy *Proxy, addr string) {
+	conn, err := DialTcp(addr, nil, proxy)
+	assert.Nil(t, err, "dial.")
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	_, err = conn.Write([]byte("hello openlan"))
+	assert.Nil(t, err, "write.")
+	data := make([]byte, 13)
+	_, err = io.ReadFull(conn, data)
+	assert.Nil(t, err, "read.")
+	assert.Equal(t, "hello openlan", string(data), "echo.")
+}
+
+func TestProxyConnect(t *testing.T) {
+	echo := newTestEcho(t)
+	defer echo.Close()
+	ln := newTestProxy(t, func(conn net.Conn) (string, error) {
+		req, err := http.ReadRequest(bufio.NewReader(conn))
+		if err != nil {
+			return "", err
+		}
+		user, pass, _ := (&http.Request{Header: http.Header{
+			"Authorization": req.Header["Proxy-Authorization"],
+		}}).BasicAuth()
+		if req.Method != "CONNECT" || user != "hi" || pass != "pass" {
+			_, _ = conn.Write([]byte("HTTP/1.1 407 Proxy Authentication Required\r\n\r\n"))
+			return "", NewErr("auth")
+		}
+		_, _ = conn.Write([]byte("HTTP/1.1 200 Connection established\r\n\r\n"))
+		return req.Host, nil
+	})
+	defer ln.Close()
+
+	proxy, err := NewProxy("http://hi:pass@" + ln.Addr().String())
+	assert.Nil(t, err, "proxy.")
+	testProxyEcho(t, proxy, echo.Addr().String())
+
+	proxy.Password = "wrong"
+	_, err = DialTcp(echo.Addr().String(), nil, proxy)
+	assert.NotNil(t, err, "auth.")
+}
+
+func TestProxySocks5(t *testing.T) {
+	echo := newTestEcho(t)
+	defer echo.Close()
+	ln := newTestProxy(t, func(conn net.Conn) (string, error) {
+		head := make([]byte, 2)
+		if _, err := io.ReadFull(conn, head); err != nil {
+			return "", err
+		}
+		methods := make([]byte, head[1])
+		_, _ = io.ReadFull(conn, methods)
+		_, _ = conn.Write([]byte{0x05, 0x02})
+		auth := make([]byte, 2)
+		_, _ = io.ReadFull(conn, auth)
+		user := make([]byte, auth[1])
+		_, _ = io.ReadFull(conn, user)
+		_, _ = io.ReadFull(conn, auth[:1])
+		pass := make([]byte, auth[0])
+		_, _ = io.ReadFull(conn, pass)
+		if string(user) != "hi" || string(pass) != "pass" {
+			_, _ = conn.Write([]byte{0x01, 0x01})
+			return "", NewErr("auth")
+		}
+		_, _ = conn.Write([]byte{0x01, 0x00})
+		req := make([]byte, 4+4+2)
+		if _, err := io.ReadFull(conn, req); err != nil || req[3] != 0x01 {
+			return "", NewErr("request")
+		}
+		_, _ = conn.Write([]byte{0x05, 0x00, 0x00, 0x01, 0, 0, 0, 0, 0, 0})
+		ip := net.IP(req[4:8])
+		port := int(req[8])<<8 | int(req[9])
+		return (&net.TCPAddr{IP: ip, Port: port}).String(), nil
+	})
+	defer ln.Close()
+
+	proxy, err := NewProxy("socks5://hi:pass@" + ln.Addr().String())
+	assert.Nil(t, err, "proxy.")
+	testProxyEcho(t, proxy, echo.Addr().String())
+}
+
+func TestProxyFromEnv(t *testing.T) {
+	for _, name := range []string{"HTTPS_PROXY", "https_proxy", "ALL_PROXY", "all_proxy", "NO_PROXY", "no_proxy"} {
+		old, ok := os.LookupEnv(name)
+		_ = os.Unsetenv(name)
+		if ok {
+			defer os.Setenv(name, old)
+		} else {
+			defer os.Unsetenv(name)
+		}
+	}
+	assert.Nil(t, ProxyFromEnv(), "not set.")
+
+	_ = os.Setenv("ALL_PROXY", "socks5://127.0.0.1")
+	_ = os.Setenv("NO_PROXY", "localhost, .openlan.net")
+	proxy := ProxyFromEnv()
+	assert.Equal(t, "socks5://127.0.0.1:1080", proxy.String(), "all proxy.")
+	assert.False(t, proxy.UseFor("localhost:10002"), "no proxy.")
+	assert.False(t, proxy.UseFor("sw.openlan.net:10002"), "no proxy.")
+	assert.True(t, proxy.UseFor("openlan.org:10002"), "proxy.")
+
+	_ = os.Setenv("HTTPS_PROXY", "proxy.local:3128")
+	assert.Equal(t, "http://proxy.local:3128", ProxyFromEnv().String(), "https proxy.")
+}
+
+func TestDialTlsTimeout(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err, "listen.")
+	defer ln.Close()
+	go func() {
+		conn, err := ln.Accept()
+		if err == nil {
+			defer conn.Close()
+			time.Sleep(3 * time.Second) // never handshake.
+		}
+	}()
+
+	conn, err := net.Dial("tcp", ln.Addr().String())
+	assert.Nil(t, err, "dial.")
+	start := time.Now()
+	_, err = DialTls(conn, ln.Addr().String(), &tls.Config{}, 200*time.Millisecond)
+	assert.NotNil(t, err, "timeout.")
+	assert.True(t, time.Since(start) < 2*time.Second, "in deadline.")
+}
@@ -0,0 +1,193 @@
+package libol
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// signature of PROXY protocol v2.
+var proxyV2Sig = []byte{0x0D, 0x0A, 0x0D, 0x0A, 0x00, 0x0D, 0x0A, 0x51, 0x55, 0x49, 0x54, 0x0A}
+
+// ProxyProtocol reads the PROXY header v1 or v2 sent by load balancer, and
+// only from the trusted if not empty.
+type ProxyProtocol struct {
+	Trusted []*net.IPNet
+	Timeout time.Duration
+}
+
+// NewProxyProtocol parses trusted by CIDR or IP address, and none is an
+// error since any client could forge its address.
+func NewProxyProtocol(trusted []string) (*ProxyProtocol, error) {
+	if len(trusted) == 0 {
+		return nil, NewErr("no trusted balancer")
+	}
+	nets, err := ParseCIDRs(trusted)
+	if err != nil {
+		return nil, err
+	}
+	return &ProxyProtocol{
+		Trusted: nets,
+		Timeout: 10 * time.Second,
+	}, nil
+}
+
+// Trust returns true if the address can send PROXY header, and none is
+// trusted if empty.
+func (p *ProxyProtocol) Trust(addr net.Addr) bool {
+	tcpAddr, ok := addr.(*net.TCPAddr)
+	if !ok {
+		return false
+	}
+	return containsIP(p.Trusted, tcpAddr.IP)
+}
+
+// Accept reads the header from trusted connection, and the returned has
+// the address of client as remote. The untrusted is returned as it is.
+func (p *ProxyProtocol) Accept(conn net.Conn) (net.Conn, error) {
+	if !p.Trust(conn.RemoteAddr()) {
+		Debug("ProxyProtocol.Accept: %s not trusted", conn.RemoteAddr())
+		return conn, nil
+	}
+	reader := bufio.NewReader(conn)
+	if p.Timeout > 0 {
+		_ = conn.SetReadDeadline(time.Now().Add(p.Timeout))
+	}
+	src, err := ReadProxyHeader(reader)
+	_ = conn.SetReadDeadline(time.Time{})
+	if err != nil {
+		return nil, err
+	}
+	pc := &proxyConn{
+		Conn:   conn,
+		reader: reader,
+		remote: conn.RemoteAddr(),
+		proxy:  conn.RemoteAddr(),
+	}
+	if src != nil { // not LOCAL or UNKNOWN.
+		pc.remote = src
+	}
+	return pc, nil
+}
+
+// ReadProxyHeader returns the source address in header, and nil if the
+// connection is from the balancer itself.
+func ReadProxyHeader(reader *bufio.Reader) (net.Addr, error) {
+	head, err := reader.Peek(len(proxyV2Sig))
+	if err != nil {
+		return nil, err
+	}
+	if bytes.Equal(head, proxyV2Sig) {
+		return readProxyV2(reader)
+	}
+	if bytes.HasPrefix(head, []byte("PROXY ")) {
+		return readProxyV1(reader)
+	}
+	return nil, NewErr("no PROXY header")
+}
+
+func readProxyV1(reader *bufio.Reader) (net.Addr, error) {
+	line := make([]byte, 0, 108)
+	for len(line) < 107 {
+		b, err := reader.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		line = append(line, b)
+		if b == '\n' {
+			break
+		}
+	}
+	if !bytes.HasSuffix(line, []byte("\r\n")) {
+		return nil, NewErr("PROXY v1 too long")
+	}
+	fields := strings.Fields(string(line[:len(line)-2]))
+	if len(fields) >= 2 && fields[1] == "UNKNOWN" {
+		return nil, nil
+	}
+	if len(fields) != 6 || (fields[1] != "TCP4" && fields[1] != "TCP6") {
+		return nil, NewErr("PROXY v1 invalid %q", line)
+	}
+	ip := net.ParseIP(fields[2])
+	port, err := strconv.Atoi(fields[4])
+	if ip == nil || err != nil || port < 0 || port > 65535 {
+		return nil, NewErr("PROXY v1 invalid source %s:%s", fields[2], fields[4])
+	}
+	return &net.TCPAddr{IP: ip, Port: port}, nil
+}
+
+func readProxyV2(reader *bufio.Reader) (net.Addr, error) {
+	head := make([]byte, 16)
+	if err := readFull(reader, head); err != nil {
+		return nil, err
+	}
+	if head[12]>>4 != 0x02 {
+		return nil, NewErr("PROXY v2 invalid version %d", head[12]>>4)
+	}
+	body := make([]byte, binary.BigEndian.Uint16(head[14:16]))
+	if err := readFull(reader, body); err != nil {
+		return nil, err
+	}
+	switch head[12] & 0x0F {
+	case 0x00: // LOCAL
+		return nil, nil
+	case 0x01: // PROXY
+	default:
+		return nil, NewErr("PROXY v2 invalid command %d", head[12]&0x0F)
+	}
+	switch head[13] >> 4 {
+	case 0x01: // AF_INET
+		if len(body) < 12 {
+			return nil, NewErr("PROXY v2 too short for ipv4")
+		}
+		return &net.TCPAddr{IP: net.IP(body[0:4]), Port: int(binary.BigEndian.Uint16(body[8:10]))}, nil
+	case 0x02: // AF_INET6
+		if len(body) < 36 {
+			return nil, NewErr("PROXY v2 too short for ipv6")
+		}
+		return &net.TCPAddr{IP: net.IP(body[0:16]), Port: int(binary.BigEndian.Uint16(body[32:34]))}, nil
+	}
+	return nil, nil // AF_UNSPEC or AF_UNIX.
+}
+
+// proxyConn has the address of client in PROXY header as remote, and the
+// address of balancer as proxy.
+type proxyConn struct {
+	net.Conn
+	reader *bufio.Reader
+	remote net.Addr
+	proxy  net.Addr
+}
+
+func (c *proxyConn) Read(b []byte) (int, error) {
+	if c.reader != nil {
+		return c.reader.Read(b)
+	}
+	return c.Conn.Read(b)
+}
+
+func (c *proxyConn) RemoteAddr() net.Addr {
+	return c.remote
+}
+
+// wrap keeps the addresses over other connection, likes tls.
+func (c *proxyConn) wrap(conn net.Conn) net.Conn {
+	return &proxyConn{Conn: conn, remote: c.remote, proxy: c.proxy}
+}
+
+// proxyAddr returns the address of balancer, and empty if not proxied.
+func proxyAddr(conn net.Conn) string {
+	switch c := conn.(type) {
+	case *proxyConn:
+		return c.proxy.String()
+	case *peekConn:
+		return proxyAddr(c.Conn)
+	case *certConn:
+		return c.proxy
+	}
+	return ""
+}
@@ -0,0 +1,90 @@
+package libol
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"net"
+	"testing"
+)
+
+func TestProxyHeaderV1(t *testing.T) {
+	r := bufio.NewReader(bytes.NewBufferString("PROXY TCP4 192.168.1.10 10.0.0.1 56324 10002\r\nhello"))
+	src, err := ReadProxyHeader(r)
+	assert.Nil(t, err, "v1.")
+	assert.Equal(t, "192.168.1.10:56324", src.String(), "source.")
+	rest, _ := ioutil.ReadAll(r)
+	assert.Equal(t, "hello", string(rest), "payload.")
+
+	r = bufio.NewReader(bytes.NewBufferString("PROXY UNKNOWN\r\n"))
+	src, err = ReadProxyHeader(r)
+	assert.Nil(t, err, "unknown.")
+	assert.Nil(t, src, "unknown.")
+
+	r = bufio.NewReader(bytes.NewBufferString("PROXY TCP4 192.168.1.10\r\n"))
+	_, err = ReadProxyHeader(r)
+	assert.NotNil(t, err, "invalid.")
+
+	r = bufio.NewReader(bytes.NewBufferString("\xff\xff\x00\x10hello openlan frame"))
+	_, err = ReadProxyHeader(r)
+	assert.NotNil(t, err, "no header.")
+}
+
+func TestProxyHeaderV2(t *testing.T) {
+	body := make([]byte, 12)
+	copy(body[0:4], net.ParseIP("172.16.0.5").To4())
+	copy(body[4:8], net.ParseIP("10.0.0.1").To4())
+	binary.BigEndian.PutUint16(body[8:10], 40000)
+	binary.BigEndian.PutUint16(body[10:12], 10002)
+
+	header := append([]byte{}, proxyV2Sig...)
+	header = append(header, 0x21, 0x11, 0x00, byte(len(body)))
+	header = append(header, body...)
+	r := bufio.NewReader(bytes.NewReader(append(header, "hello"...)))
+	src, err := ReadProxyHeader(r)
+	assert.Nil(t, err, "v2.")
+	assert.Equal(t, "172.16.0.5:40000", src.String(), "source.")
+	rest, _ := ioutil.ReadAll(r)
+	assert.Equal(t, "hello", string(rest), "payload.")
+
+	local := append([]byte{}, proxyV2Sig...)
+	local = append(local, 0x20, 0x00, 0x00, 0x00)
+	src, err = ReadProxyHeader(bufio.NewReader(bytes.NewReader(local)))
+	assert.Nil(t, err, "local.")
+	assert.Nil(t, src, "local.")
+}
+
+func TestProxyProtocolTrust(t *testing.T) {
+	p, err := NewProxyProtocol([]string{"10.0.0.0/8", "192.168.1.1"})
+	assert.Nil(t, err, "new.")
+	assert.True(t, p.Trust(&net.TCPAddr{IP: net.ParseIP("10.1.2.3")}), "cidr.")
+	assert.True(t, p.Trust(&net.TCPAddr{IP: net.ParseIP("192.168.1.1")}), "ip.")
+	assert.False(t, p.Trust(&net.TCPAddr{IP: net.ParseIP("192.168.1.2")}), "untrusted.")
+
+	_, err = NewProxyProtocol([]string{"10.0.0.0/33"})
+	assert.NotNil(t, err, "invalid.")
+
+	_, err = NewProxyProtocol(nil)
+	assert.NotNil(t, err, "none trusted.")
+	assert.False(t, (&ProxyProtocol{}).Trust(&net.TCPAddr{IP: net.ParseIP("10.1.2.3")}), "empty.")
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err, "listen.")
+	defer ln.Close()
+	c1, err := net.Dial("tcp", ln.Addr().String())
+	assert.Nil(t, err, "dial.")
+	defer c1.Close()
+	c0, err := ln.Accept()
+	assert.Nil(t, err, "accept.")
+	defer c0.Close()
+	pp, _ := NewProxyProtocol([]string{"127.0.0.1"})
+	go func() {
+		_, _ = c1.Write([]byte("PROXY TCP4 192.168.1.10 10.0.0.1 56324 10002\r\n"))
+	}()
+	conn, err := pp.Accept(c0)
+	assert.Nil(t, err, "accept.")
+	assert.Equal(t, "192.168.1.10:56324", conn.RemoteAddr().String(), "remote.")
+	assert.Equal(t, c1.LocalAddr().String(), proxyAddr(conn), "proxy.")
+}
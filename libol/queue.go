@@ -0,0 +1,124 @@
+package libol
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Policy of queue if full.
+const (
+	QUEUE_TAILDROP   = "tail-drop"
+	QUEUE_HEADDROP   = "head-drop"
+	QUEUE_DISCONNECT = "disconnect"
+)
+
+// SendQueue is bounded egress of a client, and written by a dedicated
+// goroutine, so a slow client not blocks the reader of tap.
+type SendQueue struct {
+	client  SocketClient
+	frames  chan []byte
+	policy  string
+	timeout time.Duration // blocked before disconnect.
+	drops   uint64
+	done    chan bool
+	once    sync.Once
+}
+
+func NewSendQueue(client SocketClient, length int, policy string, timeout time.Duration) *SendQueue {
+	if length <= 0 {
+		length = 1024
+	}
+	return &SendQueue{
+		client:  client,
+		frames:  make(chan []byte, length),
+		policy:  policy,
+		timeout: timeout,
+		done:    make(chan bool),
+	}
+}
+
+func (q *SendQueue) String() string {
+	return q.client.String()
+}
+
+// Push copies data into queue, and returns error if the queue closed, or
+// blocked too long by disconnect policy.
+func (q *SendQueue) Push(data []byte) error {
+	select {
+	case <-q.done:
+		return NewErr("%s queue closed", q)
+	default:
+	}
+	frame := make([]byte, len(data))
+	copy(frame, data)
+	select {
+	case q.frames <- frame:
+		return nil
+	default:
+	}
+	switch q.policy {
+	case QUEUE_HEADDROP:
+		select {
+		case <-q.frames:
+			atomic.AddUint64(&q.drops, 1)
+		default:
+		}
+		select {
+		case q.frames <- frame:
+		default:
+			atomic.AddUint64(&q.drops, 1)
+		}
+	case QUEUE_DISCONNECT:
+		timer := time.NewTimer(q.timeout)
+		defer timer.Stop()
+		select {
+		case q.frames <- frame:
+		case <-q.done:
+			return NewErr("%s queue closed", q)
+		case <-timer.C:
+			atomic.AddUint64(&q.drops, 1)
+			q.Close()
+			return NewErr("%s blocked %s", q, q.timeout)
+		}
+	default:
+		atomic.AddUint64(&q.drops, 1)
+	}
+	return nil
+}
+
+// Loop writes frames to client, and flushes if no more in queue.
+func (q *SendQueue) Loop() {
+	Debug("SendQueue.Loop: %s", q)
+	defer Debug("SendQueue.Loop: %s exit", q)
+	for {
+		select {
+		case <-q.done:
+			return
+		case frame := <-q.frames:
+			err := q.client.WriteMsg(frame)
+			if err == nil && len(q.frames) == 0 {
+				err = q.client.Flush()
+			}
+			if err != nil {
+				Error("SendQueue.Loop: %s %s", q, err)
+				q.Close()
+				return
+			}
+		}
+	}
+}
+
+func (q *SendQueue) Close() {
+	q.once.Do(func() {
+		close(q.done)
+	})
+}
+
+func (q *SendQueue) Depth() int {
+	return len(q.frames)
+}
+
+func (q *SendQueue) Drops() uint64 {
+	return atomic.LoadUint64(&q.drops)
+}
@@ -0,0 +1,41 @@
+package libol
+
+import (
+	"github.com/stretchr/testify/assert"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestSendQueuePolicy(t *testing.T) {
+	c0, c1 := net.Pipe()
+	client := NewTcpClientFromConn(c0)
+	peer := NewTcpClientFromConn(c1)
+	defer client.Close()
+	defer peer.Close()
+
+	tail := NewSendQueue(client, 2, QUEUE_TAILDROP, 0)
+	head := NewSendQueue(client, 2, QUEUE_HEADDROP, 0)
+	for _, v := range []string{"hello openlan frame 1", "hello openlan frame 2", "hello openlan frame 3"} {
+		assert.Nil(t, tail.Push([]byte(v)), "tail.")
+		assert.Nil(t, head.Push([]byte(v)), "head.")
+	}
+	assert.Equal(t, 2, tail.Depth(), "depth.")
+	assert.Equal(t, uint64(1), tail.Drops(), "drops.")
+	assert.Equal(t, uint64(1), head.Drops(), "drops.")
+
+	go head.Loop()
+	data := make([]byte, MAXBUF)
+	for _, v := range []string{"hello openlan frame 2", "hello openlan frame 3"} {
+		n, err := peer.ReadMsg(data)
+		assert.Nil(t, err, "read.")
+		assert.Equal(t, v, string(data[:n]), "head dropped.")
+	}
+	head.Close()
+	assert.NotNil(t, head.Push([]byte("hello openlan frame 4")), "closed.")
+
+	block := NewSendQueue(client, 1, QUEUE_DISCONNECT, 10*time.Millisecond)
+	assert.Nil(t, block.Push([]byte("hello openlan frame 1")), "block.")
+	assert.NotNil(t, block.Push([]byte("hello openlan frame 2")), "disconnect.")
+	assert.NotNil(t, block.Push([]byte("hello openlan frame 3")), "closed.")
+}
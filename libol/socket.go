@@ -1,10 +1,13 @@
 package libol
 
 import (
-	"bytes"
+	"bufio"
+	"crypto/x509"
 	"encoding/binary"
+	"io"
 	"net"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -19,10 +22,45 @@ const (
 )
 
 type ClientSts struct {
-	TxOkay  uint64
-	RxOkay  uint64
-	TxError uint64
-	Dropped uint64
+	TxOkay        uint64
+	RxOkay        uint64
+	TxError       uint64
+	Dropped       uint64
+	CompressIn    uint64 // bytes before compressed.
+	CompressOut   uint64 // bytes after compressed.
+	CompressSkip  uint64 // frames not shrunk.
+	DecompressIn  uint64
+	DecompressOut uint64
+}
+
+// load returns a copy, since updated atomically by reader and writers.
+func (s *ClientSts) load() ClientSts {
+	return ClientSts{
+		TxOkay:        atomic.LoadUint64(&s.TxOkay),
+		RxOkay:        atomic.LoadUint64(&s.RxOkay),
+		TxError:       atomic.LoadUint64(&s.TxError),
+		Dropped:       atomic.LoadUint64(&s.Dropped),
+		CompressIn:    atomic.LoadUint64(&s.CompressIn),
+		CompressOut:   atomic.LoadUint64(&s.CompressOut),
+		CompressSkip:  atomic.LoadUint64(&s.CompressSkip),
+		DecompressIn:  atomic.LoadUint64(&s.DecompressIn),
+		DecompressOut: atomic.LoadUint64(&s.DecompressOut),
+	}
+}
+
+// TxRatio is ratio of compressed bytes to raw bytes, and 0 if none.
+func (s ClientSts) TxRatio() float64 {
+	if s.CompressIn == 0 {
+		return 0
+	}
+	return float64(s.CompressOut) / float64(s.CompressIn)
+}
+
+func (s ClientSts) RxRatio() float64 {
+	if s.DecompressOut == 0 {
+		return 0
+	}
+	return float64(s.DecompressIn) / float64(s.DecompressOut)
 }
 
 type ClientListener struct {
@@ -36,6 +74,7 @@ type SocketClient interface {
 	Connect() error
 	Close()
 	WriteMsg(data []byte) error
+	Flush() error
 	ReadMsg(data []byte) (int, error)
 	WriteReq(action string, body string) error
 	WriteResp(action string, body string) error
@@ -56,27 +95,24 @@ type SocketClient interface {
 	SetAddr(addr string)
 	Sts() ClientSts
 	SetListener(listener ClientListener)
-}
-
-func readFull(conn net.Conn, buf []byte) error {
-	if conn == nil {
+	Crypt() *Crypt
+	SetCrypt(c *Crypt)
+	Compress() string
+	SetCompress(algo string)
+	Ping() (int, error)
+	Pong(body string) error
+	OnPong(body string)
+	Rtt() (time.Duration, time.Duration)
+	PeerCerts() []*x509.Certificate
+	ProxyAddr() string
+}
+
+func readFull(r io.Reader, buf []byte) error {
+	if r == nil {
 		return NewErr("connection is nil")
 	}
-	offset := 0
-	left := len(buf)
-	Log("readFull: %d", len(buf))
-	for left > 0 {
-		tmp := make([]byte, left)
-		n, err := conn.Read(tmp)
-		if err != nil {
-			return err
-		}
-		copy(buf[offset:], tmp)
-		offset += n
-		left -= n
-	}
-	Log("readFull: Data %x", buf)
-	return nil
+	_, err := io.ReadFull(r, buf)
+	return err
 }
 
 func writeFull(conn net.Conn, buf []byte) error {
@@ -86,12 +122,8 @@ func writeFull(conn net.Conn, buf []byte) error {
 	offset := 0
 	size := len(buf)
 	left := size - offset
-	Log("writeFull: %d", size)
-	Log("writeFull: Data %x", buf)
 	for left > 0 {
-		tmp := buf[offset:]
-		Log("writeFull: tmp %d", len(tmp))
-		n, err := conn.Write(tmp)
+		n, err := conn.Write(buf[offset:])
 		if err != nil {
 			return err
 		}
@@ -101,77 +133,302 @@ func writeFull(conn net.Conn, buf []byte) error {
 	return nil
 }
 
+const (
+	FLUSHSIZE = 16 * 1024
+)
+
 type connWrapper struct {
-	conn    net.Conn
-	sts     ClientSts
-	maxSize int
-	minSize int
-	connect func() error
+	sts      ClientSts
+	clock    sync.RWMutex
+	conn     net.Conn // guarded by clock, since closed by others.
+	maxSize  int
+	minSize  int
+	connect  func() error
+	crypt    atomic.Value
+	compress atomic.Value
+	// reading is in one goroutine, and buffers are reused.
+	reader *bufio.Reader
+	rconn  net.Conn
+	rbuf   []byte
+	// writing is buffered while others are waiting to write, and flushed
+	// by the last one or enough bytes.
+	wwait   int32
+	wlock   sync.Mutex
+	writer  *bufio.Writer
+	wconn   net.Conn
+	werr    error
+	noDelay bool // write frame at once, such as datagram.
+	beat    heartbeat
+}
+
+func (t *connWrapper) getConn() net.Conn {
+	t.clock.RLock()
+	defer t.clock.RUnlock()
+	return t.conn
+}
+
+func (t *connWrapper) setConn(conn net.Conn) {
+	t.clock.Lock()
+	defer t.clock.Unlock()
+	t.conn = conn
+}
+
+// PeerCerts returns the certificates verified in tls handshake.
+func (t *connWrapper) PeerCerts() []*x509.Certificate {
+	conn := t.getConn()
+	if conn == nil {
+		return nil
+	}
+	return peerCerts(conn)
+}
+
+// ProxyAddr returns the balancer sent PROXY header, and empty if not.
+func (t *connWrapper) ProxyAddr() string {
+	conn := t.getConn()
+	if conn == nil {
+		return ""
+	}
+	return proxyAddr(conn)
+}
+
+func (t *connWrapper) String() string {
+	if conn := t.getConn(); conn != nil {
+		return conn.RemoteAddr().String()
+	}
+	return ""
 }
 
 func (t *connWrapper) IsOk() bool {
-	return t.conn != nil
+	return t.getConn() != nil
+}
+
+func (t *connWrapper) Crypt() *Crypt {
+	if c, ok := t.crypt.Load().(*Crypt); ok {
+		return c
+	}
+	return nil
+}
+
+// SetCrypt enables crypt for frames after, and nil to disable.
+func (t *connWrapper) SetCrypt(c *Crypt) {
+	t.crypt.Store(c)
+}
+
+func (t *connWrapper) Compress() string {
+	if c, ok := t.compress.Load().(string); ok {
+		return c
+	}
+	return ""
+}
+
+// SetCompress enables compression for frames after, and "" to disable.
+func (t *connWrapper) SetCompress(algo string) {
+	t.compress.Store(algo)
+}
+
+// encode builds the frame with header into buf.
+func (t *connWrapper) encode(buf, data []byte) ([]byte, error) {
+	var flags uint16
+	payload := data
+	if IsCompress(t.Compress()) {
+		zbuf := GetBuf()
+		defer PutBuf(zbuf)
+		if out := compress(*zbuf, data); out != nil {
+			atomic.AddUint64(&t.sts.CompressIn, uint64(len(data)))
+			atomic.AddUint64(&t.sts.CompressOut, uint64(len(out)))
+			payload = out
+			flags |= FLAG_COMPRESS
+		} else {
+			atomic.AddUint64(&t.sts.CompressSkip, 1)
+		}
+	}
+	frame := buf[:HSIZE]
+	if c := t.Crypt(); c != nil {
+		frame = c.SealTo(frame, payload)
+		flags |= FLAG_CRYPT
+	} else {
+		frame = append(frame, payload...)
+	}
+	size := len(frame) - HSIZE
+	if size > SIZE_MASK {
+		return nil, NewErr("%s: too large(%d)", t, size)
+	}
+	copy(frame[:2], MAGIC)
+	binary.BigEndian.PutUint16(frame[2:4], uint16(size)|flags)
+	return frame, nil
+}
+
+func (t *connWrapper) write(frame []byte) error {
+	atomic.AddInt32(&t.wwait, 1)
+	t.wlock.Lock()
+	defer t.wlock.Unlock()
+	last := atomic.AddInt32(&t.wwait, -1) == 0
+
+	conn := t.getConn()
+	if conn == nil {
+		return NewErr("connection is nil")
+	}
+	if t.noDelay {
+		return writeFull(conn, frame)
+	}
+	if t.wconn != conn {
+		if t.writer == nil {
+			t.writer = bufio.NewWriterSize(conn, RWBUF)
+		} else {
+			t.writer.Reset(conn)
+		}
+		t.wconn = conn
+		t.werr = nil
+	}
+	if t.werr != nil {
+		return t.werr
+	}
+	if _, err := t.writer.Write(frame); err != nil {
+		t.werr = err
+		return err
+	}
+	if last || t.writer.Buffered() >= FLUSHSIZE {
+		return t.flushLocked()
+	}
+	return nil
+}
+
+func (t *connWrapper) flushLocked() error {
+	if t.writer == nil || t.werr != nil {
+		return t.werr
+	}
+	if t.writer.Buffered() > 0 {
+		if err := t.writer.Flush(); err != nil {
+			t.werr = err
+			atomic.AddUint64(&t.sts.TxError, 1)
+		}
+	}
+	return t.werr
+}
+
+// Flush writes the buffered frames now.
+func (t *connWrapper) Flush() error {
+	t.wlock.Lock()
+	defer t.wlock.Unlock()
+	return t.flushLocked()
 }
 
 func (t *connWrapper) WriteMsg(data []byte) error {
 	if err := t.connect(); err != nil {
-		t.sts.Dropped++
+		atomic.AddUint64(&t.sts.Dropped, 1)
 		return err
 	}
-	buf := BuildMessage(data)
-	if err := writeFull(t.conn, buf); err != nil {
-		t.sts.TxError++
+	buf := GetBuf()
+	defer PutBuf(buf)
+	frame, err := t.encode(*buf, data)
+	if err != nil {
+		atomic.AddUint64(&t.sts.Dropped, 1)
 		return err
 	}
-	t.sts.TxOkay += uint64(len(data))
+	if err := t.write(frame); err != nil {
+		atomic.AddUint64(&t.sts.TxError, 1)
+		return err
+	}
+	atomic.AddUint64(&t.sts.TxOkay, uint64(len(data)))
 	return nil
 }
 
 func (t *connWrapper) ReadMsg(data []byte) (int, error) {
-	Log("connWrapper.ReadMsg: %s", t)
-
-	if !t.IsOk() {
+	conn := t.getConn()
+	if conn == nil {
 		return -1, NewErr("%s: not okay", t)
 	}
+	if t.rconn != conn {
+		if t.reader == nil {
+			t.reader = bufio.NewReaderSize(conn, RWBUF)
+		} else {
+			t.reader.Reset(conn)
+		}
+		t.rconn = conn
+	}
 
+	crypt := t.Crypt()
+	overhead := 0
+	if crypt != nil {
+		overhead = crypt.Overhead()
+	}
 	hl := GetHeaderLen()
-	buffer := make([]byte, hl+t.maxSize)
-	h := buffer[:hl]
-	if err := readFull(t.conn, h); err != nil {
+	if len(t.rbuf) < hl+t.maxSize+overhead {
+		t.rbuf = make([]byte, hl+t.maxSize+overhead)
+	}
+	h := t.rbuf[:hl]
+	if err := readFull(t.reader, h); err != nil {
 		return -1, err
 	}
-	magic := GetMagic()
-	if !bytes.Equal(h[0:2], magic) {
+	if h[0] != MAGIC[0] || h[1] != MAGIC[1] {
 		return -1, NewErr("%s: wrong magic", t)
 	}
 
-	size := binary.BigEndian.Uint16(h[2:4])
-	if int(size) > t.maxSize || int(size) < t.minSize {
+	flags := binary.BigEndian.Uint16(h[2:4])
+	size := flags & SIZE_MASK
+	if (flags&FLAG_CRYPT != 0) != (crypt != nil) {
+		return -1, NewErr("%s: wrong crypt flag(%x)", t, flags)
+	}
+	minSize := t.minSize
+	if flags&FLAG_COMPRESS != 0 {
+		if !IsCompress(t.Compress()) {
+			return -1, NewErr("%s: wrong compress flag(%x)", t, flags)
+		}
+		minSize = 1
+	}
+	if int(size) > t.maxSize+overhead || int(size) < minSize+overhead {
 		return -1, NewErr("%s: wrong size(%d)", t, size)
 	}
-	d := buffer[hl : hl+int(size)]
-	if err := readFull(t.conn, d); err != nil {
+	d := t.rbuf[hl : hl+int(size)]
+	if err := readFull(t.reader, d); err != nil {
 		return -1, err
 	}
+	if crypt != nil {
+		plain, err := crypt.Open(d)
+		if err == errReplayed {
+			atomic.AddUint64(&t.sts.Dropped, 1)
+			return 0, nil
+		}
+		if err != nil {
+			return -1, NewErr("%s: %s", t, err)
+		}
+		d = plain
+	}
+	if flags&FLAG_COMPRESS != 0 {
+		out, err := decompress(data, d, t.maxSize)
+		if err != nil {
+			return -1, NewErr("%s: %s", t, err)
+		}
+		atomic.AddUint64(&t.sts.DecompressIn, uint64(len(d)))
+		atomic.AddUint64(&t.sts.DecompressOut, uint64(len(out)))
+		atomic.AddUint64(&t.sts.RxOkay, uint64(len(out)))
+		return len(out), nil
+	}
 
-	copy(data, d)
-	t.sts.RxOkay += uint64(size)
+	n := copy(data, d)
+	atomic.AddUint64(&t.sts.RxOkay, uint64(n))
 
-	return len(d), nil
+	return n, nil
 }
 
 func (t *connWrapper) WriteReq(action string, body string) error {
 	m := NewControlMessage(action, "= ", body)
 	data := m.Encode()
 	Log("connWrapper.WriteReq: %d %s", len(data), data[6:])
-	return t.WriteMsg(data)
+	if err := t.WriteMsg(data); err != nil {
+		return err
+	}
+	return t.Flush()
 }
 
 func (t *connWrapper) WriteResp(action string, body string) error {
 	m := NewControlMessage(action, ": ", body)
 	data := m.Encode()
 	Log("connWrapper.WriteResp: %d %s", len(data), data[6:])
-	return t.WriteMsg(data)
+	if err := t.WriteMsg(data); err != nil {
+		return err
+	}
+	return t.Flush()
 }
 
 type socketClient struct {
@@ -258,7 +515,7 @@ func (s *socketClient) Have(state uint8) bool {
 }
 
 func (s *socketClient) Sts() ClientSts {
-	return s.sts
+	return s.sts.load()
 }
 
 func (s *socketClient) SetListener(listener ClientListener) {
@@ -273,6 +530,7 @@ type ServerSts struct {
 	DrpCount int64
 	AcpCount int64
 	ClsCount int64
+	RejCount int64 // rejected by filter or guard.
 }
 
 type ServerListener struct {
@@ -293,17 +551,48 @@ type SocketServer interface {
 	String() string
 	Addr() string
 	Sts() ServerSts
+	SetFilter(filter *AddrFilter)
+	SetGuard(guard *Guard)
 }
 
 type socketServer struct {
+	sts        ServerSts // first for 64-bit atomic alignment.
 	lock       sync.RWMutex
-	sts        ServerSts
 	addr       string
 	maxClient  int
 	clients    map[SocketClient]bool
 	onClients  chan SocketClient
 	offClients chan SocketClient
 	close      func()
+	filter     *AddrFilter
+	guard      *Guard
+}
+
+// SetFilter permits new connections by source address.
+func (t *socketServer) SetFilter(filter *AddrFilter) {
+	t.filter = filter
+}
+
+// SetGuard limits clients by number and rate, and it may be shared by
+// other servers.
+func (t *socketServer) SetGuard(guard *Guard) {
+	t.guard = guard
+}
+
+// permit checks a new connection from the address by filter and guard.
+func (t *socketServer) permit(addr string) error {
+	ip := SourceIP(addr)
+	if t.filter != nil && !t.filter.Permit(net.ParseIP(ip)) {
+		atomic.AddInt64(&t.sts.RejCount, 1)
+		return NewErr("%s not permitted", ip)
+	}
+	if t.guard != nil {
+		if err := t.guard.Accept(ip); err != nil {
+			atomic.AddInt64(&t.sts.RejCount, 1)
+			return err
+		}
+	}
+	return nil
 }
 
 func (t *socketServer) OffClient(client SocketClient) {
@@ -315,6 +604,20 @@ func (t *socketServer) OffClient(client SocketClient) {
 
 func (t *socketServer) doOnClient(call ServerListener, client SocketClient) {
 	Debug("socketServer.doOnClient: %s", client.Addr())
+	if len(t.clients) >= t.maxClient {
+		Warn("socketServer.doOnClient: %s exceeded %d clients", client, t.maxClient)
+		atomic.AddInt64(&t.sts.RejCount, 1)
+		client.Close()
+		return
+	}
+	if t.guard != nil {
+		if err := t.guard.OnClient(SourceIP(client.Addr())); err != nil {
+			Warn("socketServer.doOnClient: %s", err)
+			atomic.AddInt64(&t.sts.RejCount, 1)
+			client.Close()
+			return
+		}
+	}
 	t.clients[client] = true
 	if call.OnClient != nil {
 		_ = call.OnClient(client)
@@ -327,12 +630,15 @@ func (t *socketServer) doOnClient(call ServerListener, client SocketClient) {
 func (t *socketServer) doOffClient(call ServerListener, client SocketClient) {
 	Debug("socketServer.doOffClient: %s", client.Addr())
 	if ok := t.clients[client]; ok {
-		t.sts.ClsCount++
+		atomic.AddInt64(&t.sts.ClsCount, 1)
 		if call.OnClose != nil {
 			_ = call.OnClose(client)
 		}
 		client.Close()
 		delete(t.clients, client)
+		if t.guard != nil {
+			t.guard.OffClient(SourceIP(client.Addr()))
+		}
 	}
 }
 
@@ -362,7 +668,7 @@ func (t *socketServer) Read(client SocketClient, ReadAt ReadClient) {
 		if length <= 0 {
 			continue
 		}
-		t.sts.RxCount++
+		atomic.AddInt64(&t.sts.RxCount, 1)
 		Log("socketServer.Read: length: %d ", length)
 		Log("socketServer.Read: data  : %x", data[:length])
 		if err := ReadAt(client, data[:length]); err != nil {
@@ -387,5 +693,12 @@ func (t *socketServer) String() string {
 }
 
 func (t *socketServer) Sts() ServerSts {
-	return t.sts
+	return ServerSts{
+		RxCount:  atomic.LoadInt64(&t.sts.RxCount),
+		TxCount:  atomic.LoadInt64(&t.sts.TxCount),
+		DrpCount: atomic.LoadInt64(&t.sts.DrpCount),
+		AcpCount: atomic.LoadInt64(&t.sts.AcpCount),
+		ClsCount: atomic.LoadInt64(&t.sts.ClsCount),
+		RejCount: atomic.LoadInt64(&t.sts.RejCount),
+	}
 }
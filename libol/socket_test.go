@@ -0,0 +1,209 @@
+package libol
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net"
+	"testing"
+	"time"
+)
+
+// legacyReadMsg is framing before buffers pooled, as a baseline.
+func legacyReadMsg(conn net.Conn, data []byte) (int, error) {
+	readFull := func(buf []byte) error {
+		offset := 0
+		left := len(buf)
+		for left > 0 {
+			tmp := make([]byte, left)
+			n, err := conn.Read(tmp)
+			if err != nil {
+				return err
+			}
+			copy(buf[offset:], tmp)
+			offset += n
+			left -= n
+		}
+		return nil
+	}
+	buffer := make([]byte, HSIZE+1514)
+	h := buffer[:HSIZE]
+	if err := readFull(h); err != nil {
+		return -1, err
+	}
+	if !bytes.Equal(h[0:2], MAGIC) {
+		return -1, NewErr("wrong magic")
+	}
+	size := binary.BigEndian.Uint16(h[2:4])
+	d := buffer[HSIZE : HSIZE+int(size)]
+	if err := readFull(d); err != nil {
+		return -1, err
+	}
+	copy(data, d)
+	return len(d), nil
+}
+
+func newTestTcpPair(b *testing.B) (net.Conn, net.Conn) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer listener.Close()
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		conn, _ := listener.Accept()
+		accepted <- conn
+	}()
+	conn, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		b.Fatal(err)
+	}
+	return conn, <-accepted
+}
+
+func benchFrames(b *testing.B, write func([]byte) error, flush func() error, read func([]byte) (int, error)) {
+	frame := bytes.Repeat([]byte{0x5a}, 512)
+	done := make(chan error, 1)
+	go func() {
+		data := make([]byte, MAXBUF)
+		for i := 0; i < b.N; i++ {
+			if _, err := read(data); err != nil {
+				done <- err
+				return
+			}
+		}
+		done <- nil
+	}()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	start := time.Now()
+	for i := 0; i < b.N; i++ {
+		if err := write(frame); err != nil {
+			b.Fatal(err)
+		}
+	}
+	if err := flush(); err != nil {
+		b.Fatal(err)
+	}
+	if err := <-done; err != nil {
+		b.Fatal(err)
+	}
+	b.ReportMetric(float64(b.N)/time.Since(start).Seconds(), "frames/s")
+}
+
+func BenchmarkFrameLegacy(b *testing.B) {
+	c0, c1 := newTestTcpPair(b)
+	defer c0.Close()
+	defer c1.Close()
+	benchFrames(b, func(data []byte) error {
+		return writeFull(c0, BuildMessage(data))
+	}, func() error {
+		return nil
+	}, func(data []byte) (int, error) {
+		return legacyReadMsg(c1, data)
+	})
+}
+
+func BenchmarkFrame(b *testing.B) {
+	c0, c1 := newTestTcpPair(b)
+	client := NewTcpClientFromConn(c0)
+	peer := NewTcpClientFromConn(c1)
+	defer client.Close()
+	defer peer.Close()
+	benchFrames(b, client.WriteMsg, client.Flush, peer.ReadMsg)
+}
+
+func BenchmarkFrameNoDelay(b *testing.B) {
+	c0, c1 := newTestTcpPair(b)
+	client := NewTcpClientFromConn(c0)
+	client.noDelay = true
+	peer := NewTcpClientFromConn(c1)
+	defer client.Close()
+	defer peer.Close()
+	benchFrames(b, client.WriteMsg, client.Flush, peer.ReadMsg)
+}
+
+func BenchmarkFrameCrypt(b *testing.B) {
+	c0, c1 := newTestTcpPair(b)
+	client := NewTcpClientFromConn(c0)
+	peer := NewTcpClientFromConn(c1)
+	defer client.Close()
+	defer peer.Close()
+	pk, _ := NewCryptKey()
+	sk, _ := NewCryptKey()
+	shared, _ := pk.Shared(sk.Public())
+	point, _ := NewCrypt(CRYPT_AESGCM, shared, "", false)
+	server, _ := NewCrypt(CRYPT_AESGCM, shared, "", true)
+	client.SetCrypt(point)
+	peer.SetCrypt(server)
+	benchFrames(b, client.WriteMsg, client.Flush, peer.ReadMsg)
+}
+
+func TestWriteMsgCoalesced(t *testing.T) {
+	c0, c1 := net.Pipe()
+	client := NewTcpClientFromConn(c0)
+	peer := NewTcpClientFromConn(c1)
+	defer client.Close()
+	defer peer.Close()
+
+	frame := []byte("hello openlan frame")
+	// coalesced while others writing, and flushed by the last one
+	// without calling Flush.
+	for i := 0; i < 8; i++ {
+		go func() {
+			_ = client.WriteMsg(frame)
+		}()
+	}
+	data := make([]byte, MAXBUF)
+	for i := 0; i < 8; i++ {
+		_ = c1.SetReadDeadline(time.Now().Add(time.Second))
+		n, err := peer.ReadMsg(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(frame, data[:n]) {
+			t.Fatalf("wrong frame %x", data[:n])
+		}
+	}
+}
+
+func TestWriteMsgJumbo(t *testing.T) {
+	c0, c1 := net.Pipe()
+	client := NewTcpClientFromConn(c0)
+	peer := NewTcpClientFromConn(c1)
+	defer client.Close()
+	defer peer.Close()
+	client.SetMaxSize(9216)
+	peer.SetMaxSize(9216)
+	pk, _ := NewCryptKey()
+	sk, _ := NewCryptKey()
+	shared, _ := pk.Shared(sk.Public())
+	point, _ := NewCrypt(CRYPT_AESGCM, shared, "", false)
+	server, _ := NewCrypt(CRYPT_AESGCM, shared, "", true)
+	client.SetCrypt(point)
+	peer.SetCrypt(server)
+
+	frame := bytes.Repeat([]byte{0x5a}, 9216)
+	go func() {
+		_ = client.WriteMsg(frame)
+		_ = client.Flush()
+	}()
+	data := make([]byte, MAXBUF)
+	n, err := peer.ReadMsg(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(frame, data[:n]) {
+		t.Fatalf("wrong jumbo frame %d", n)
+	}
+
+	// refused if larger than max size.
+	peer.SetMaxSize(1514)
+	go func() {
+		_ = client.WriteMsg(frame)
+		_ = client.Flush()
+	}()
+	if _, err := peer.ReadMsg(data); err == nil {
+		t.Fatal("jumbo frame accepted")
+	}
+}
@@ -0,0 +1,293 @@
+package libol
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"os"
+	"sync"
+)
+
+// Store saves the values by bucket and key, and is loaded again after
+// restart.
+type Store interface {
+	Put(bucket, key string, value interface{}) error
+	Del(bucket, key string) error
+	Iter(bucket string, call func(key string, value []byte))
+	Close() error
+}
+
+type storeRecord struct {
+	Op     string          `json:"op"` // put or del.
+	Bucket string          `json:"bucket"`
+	Key    string          `json:"key"`
+	Value  json.RawMessage `json:"value,omitempty"`
+}
+
+// storeLog is the file of log, and is replaced by test to fail in writing.
+type storeLog interface {
+	io.WriteCloser
+	Sync() error
+	Truncate(size int64) error
+}
+
+// FileStore keeps a snapshot of JSON, and appends the changes to a log
+// until compacted into the snapshot again. The snapshot is replaced by
+// rename, and the broken tail of log is dropped when opened or failed in
+// writing.
+type FileStore struct {
+	MaxLogs int
+
+	lock   sync.Mutex
+	dir    string
+	data   map[string]map[string]json.RawMessage
+	log    storeLog
+	logs   int
+	offset int64 // size of records written.
+	closed bool
+}
+
+func NewFileStore(dir string) (*FileStore, error) {
+	s := &FileStore{
+		MaxLogs: 1024,
+		dir:     dir,
+		data:    make(map[string]map[string]json.RawMessage, 8),
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	s.loadSnapshot()
+	if err := s.loadLog(); err != nil {
+		return nil, err
+	}
+	if err := s.compact(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *FileStore) snapshotFile() string {
+	return s.dir + "/state.json"
+}
+
+func (s *FileStore) logFile() string {
+	return s.dir + "/state.log"
+}
+
+// loadSnapshot moves the corrupted snapshot aside, and starts from empty.
+func (s *FileStore) loadSnapshot() {
+	file := s.snapshotFile()
+	if _, err := os.Stat(file); os.IsNotExist(err) {
+		return
+	}
+	if err := UnmarshalLoad(&s.data, file); err != nil {
+		Error("FileStore.loadSnapshot: %s", err)
+		s.data = make(map[string]map[string]json.RawMessage, 8)
+		if err := os.Rename(file, file+".corrupt"); err != nil {
+			Error("FileStore.loadSnapshot: %s", err)
+		}
+	}
+}
+
+// loadLog replays the records in log, and stops at the first broken one
+// that is written partly before crashed.
+func (s *FileStore) loadLog() error {
+	f, err := os.Open(s.logFile())
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	reader := bufio.NewReader(f)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err == io.EOF {
+			if len(line) > 0 {
+				Warn("FileStore.loadLog: drop partial %q", line)
+			}
+			return nil
+		} else if err != nil {
+			return err
+		}
+		r := storeRecord{}
+		if err := json.Unmarshal(line, &r); err != nil {
+			Warn("FileStore.loadLog: drop since %q: %s", line, err)
+			return nil
+		}
+		s.apply(&r)
+	}
+}
+
+func (s *FileStore) apply(r *storeRecord) {
+	switch r.Op {
+	case "put":
+		bucket, ok := s.data[r.Bucket]
+		if !ok {
+			bucket = make(map[string]json.RawMessage, 32)
+			s.data[r.Bucket] = bucket
+		}
+		bucket[r.Key] = r.Value
+	case "del":
+		if bucket, ok := s.data[r.Bucket]; ok {
+			delete(bucket, r.Key)
+		}
+	}
+}
+
+// compact writes the snapshot to a temporary file and renames it, then
+// starts an empty log.
+func (s *FileStore) compact() error {
+	file := s.snapshotFile()
+	tmp := file + ".tmp"
+	data, err := json.Marshal(s.data)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(tmp, os.O_WRONLY|os.O_TRUNC|os.O_CREATE, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, file); err != nil {
+		return err
+	}
+	if err := syncDir(s.dir); err != nil {
+		return err
+	}
+	if s.log != nil {
+		_ = s.log.Close()
+		s.log = nil
+	}
+	log, err := os.OpenFile(s.logFile(), os.O_WRONLY|os.O_TRUNC|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	s.log = log
+	s.logs = 0
+	s.offset = 0
+	return nil
+}
+
+// syncDir flushes the directory, so the file renamed is not lost after
+// crashed.
+func syncDir(dir string) error {
+	f, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return f.Sync()
+}
+
+// truncate drops the record written partly, otherwise the records after
+// it are not loaded again. The log is compacted if not truncated.
+func (s *FileStore) truncate() {
+	err := s.log.Truncate(s.offset)
+	if err == nil {
+		return
+	}
+	Error("FileStore.truncate: %s", err)
+	if err := s.compact(); err != nil {
+		Error("FileStore.truncate: %s", err)
+	}
+}
+
+func (s *FileStore) append(r *storeRecord) error {
+	data, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+	if s.log == nil {
+		return NewErr("FileStore.append: log not opened")
+	}
+	if _, err := s.log.Write(data); err != nil {
+		s.truncate()
+		return err
+	}
+	if err := s.log.Sync(); err != nil {
+		s.truncate()
+		return err
+	}
+	s.apply(r)
+	s.offset += int64(len(data))
+	s.logs++
+	if s.MaxLogs > 0 && s.logs >= s.MaxLogs {
+		return s.compact()
+	}
+	return nil
+}
+
+// Put saves the value in JSON, and is ignored after closed.
+func (s *FileStore) Put(bucket, key string, value interface{}) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.closed {
+		return nil
+	}
+	if old, ok := s.data[bucket][key]; ok && string(old) == string(data) {
+		return nil
+	}
+	return s.append(&storeRecord{Op: "put", Bucket: bucket, Key: key, Value: data})
+}
+
+// Del deletes the value, and is ignored after closed, so the values are
+// kept when the clients are closed after the store.
+func (s *FileStore) Del(bucket, key string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.closed {
+		return nil
+	}
+	if _, ok := s.data[bucket][key]; !ok {
+		return nil
+	}
+	return s.append(&storeRecord{Op: "del", Bucket: bucket, Key: key})
+}
+
+func (s *FileStore) Iter(bucket string, call func(key string, value []byte)) {
+	s.lock.Lock()
+	values := make(map[string][]byte, len(s.data[bucket]))
+	for k, v := range s.data[bucket] {
+		values[k] = v
+	}
+	s.lock.Unlock()
+
+	for k, v := range values {
+		call(k, v)
+	}
+}
+
+func (s *FileStore) Close() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.closed {
+		return nil
+	}
+	s.closed = true
+	err := s.compact()
+	if s.log != nil {
+		_ = s.log.Close()
+		s.log = nil
+	}
+	return err
+}
@@ -0,0 +1,114 @@
+package libol
+
+import (
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func storeKeys(s Store, bucket string) map[string]string {
+	values := make(map[string]string, 4)
+	s.Iter(bucket, func(key string, value []byte) {
+		values[key] = string(value)
+	})
+	return values
+}
+
+func TestFileStore_Reopen(t *testing.T) {
+	dir, err := ioutil.TempDir("", "store")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	s, err := NewFileStore(dir)
+	assert.Nil(t, err)
+	assert.Nil(t, s.Put("lease", "u1", "10.0.0.2"))
+	assert.Nil(t, s.Put("lease", "u2", "10.0.0.3"))
+	assert.Nil(t, s.Del("lease", "u1"))
+	// crashed without closing, and the log is replayed.
+	s1, err := NewFileStore(dir)
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]string{"u2": `"10.0.0.3"`}, storeKeys(s1, "lease"))
+	assert.Nil(t, s1.Close())
+	// ignored after closed.
+	assert.Nil(t, s1.Del("lease", "u2"))
+	s2, err := NewFileStore(dir)
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]string{"u2": `"10.0.0.3"`}, storeKeys(s2, "lease"))
+}
+
+func TestFileStore_Compact(t *testing.T) {
+	dir, err := ioutil.TempDir("", "store")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	s, err := NewFileStore(dir)
+	assert.Nil(t, err)
+	s.MaxLogs = 2
+	assert.Nil(t, s.Put("user", "a", 1))
+	assert.Nil(t, s.Put("user", "b", 2))
+	assert.Equal(t, 0, s.logs)
+	info, err := os.Stat(dir + "/state.log")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), info.Size())
+	s1, err := NewFileStore(dir)
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]string{"a": "1", "b": "2"}, storeKeys(s1, "user"))
+}
+
+func TestFileStore_Recover(t *testing.T) {
+	dir, err := ioutil.TempDir("", "store")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	s, err := NewFileStore(dir)
+	assert.Nil(t, err)
+	assert.Nil(t, s.Put("user", "a", 1))
+	// written partly before crashed.
+	f, err := os.OpenFile(dir+"/state.log", os.O_WRONLY|os.O_APPEND, 0600)
+	assert.Nil(t, err)
+	_, _ = f.Write([]byte(`{"op":"put","bucket":"user","ke`))
+	_ = f.Close()
+	s1, err := NewFileStore(dir)
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]string{"a": "1"}, storeKeys(s1, "user"))
+
+	// corrupted snapshot is moved aside.
+	assert.Nil(t, ioutil.WriteFile(dir+"/state.json", []byte("{bad"), 0600))
+	assert.Nil(t, ioutil.WriteFile(dir+"/state.log", nil, 0600))
+	s2, err := NewFileStore(dir)
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]string{}, storeKeys(s2, "user"))
+	_, err = os.Stat(dir + "/state.json.corrupt")
+	assert.Nil(t, err)
+}
+
+// brokenLog writes the half of data, and fails.
+type brokenLog struct {
+	*os.File
+}
+
+func (l *brokenLog) Write(data []byte) (int, error) {
+	n, _ := l.File.Write(data[:len(data)/2])
+	return n, NewErr("disk full")
+}
+
+func TestFileStore_WriteFailed(t *testing.T) {
+	dir, err := ioutil.TempDir("", "store")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	s, err := NewFileStore(dir)
+	assert.Nil(t, err)
+	assert.Nil(t, s.Put("user", "a", 1))
+	file := s.log
+	s.log = &brokenLog{File: file.(*os.File)}
+	assert.NotNil(t, s.Put("user", "b", 2))
+	s.log = file
+	assert.Nil(t, s.Put("user", "c", 3))
+	assert.Equal(t, map[string]string{"a": "1", "c": "3"}, storeKeys(s, "user"))
+	// crashed without closing, and the records after failed are loaded.
+	s1, err := NewFileStore(dir)
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]string{"a": "1", "c": "3"}, storeKeys(s1, "user"))
+}
@@ -0,0 +1,34 @@
+package libol
+
+import (
+	"github.com/xtaci/tcpraw"
+	"net"
+	"os"
+)
+
+// tcpRawError tells that raw socket needs privileges.
+func tcpRawError(err error) error {
+	if op, ok := err.(*net.OpError); ok {
+		err = op.Err
+	}
+	if os.IsPermission(err) {
+		return NewErr("tcpraw needs root or CAP_NET_RAW: %s", err)
+	}
+	return NewErr("tcpraw: %s", err)
+}
+
+func ListenTcpRaw(addr string) (net.PacketConn, error) {
+	conn, err := tcpraw.Listen("tcp", addr)
+	if err != nil {
+		return nil, tcpRawError(err)
+	}
+	return conn, nil
+}
+
+func DialTcpRaw(addr string) (net.PacketConn, error) {
+	conn, err := tcpraw.Dial("tcp", addr)
+	if err != nil {
+		return nil, tcpRawError(err)
+	}
+	return conn, nil
+}
@@ -3,6 +3,7 @@ package libol
 import (
 	"crypto/tls"
 	"net"
+	"sync/atomic"
 	"time"
 )
 
@@ -10,8 +11,9 @@ import (
 
 type TcpServer struct {
 	socketServer
-	tlsCfg   *tls.Config
-	listener net.Listener
+	tlsCfg     *tls.Config
+	listener   net.Listener // guarded by lock.
+	proxyProto *ProxyProtocol
 }
 
 func NewTcpServer(listen string, cfg *tls.Config) *TcpServer {
@@ -33,38 +35,50 @@ func NewTcpServer(listen string, cfg *tls.Config) *TcpServer {
 	return t
 }
 
+// SetProxyProtocol reads PROXY header before tls handshake if not nil.
+func (t *TcpServer) SetProxyProtocol(p *ProxyProtocol) {
+	t.proxyProto = p
+}
+
 func (t *TcpServer) Listen() (err error) {
+	listener, err := net.Listen("tcp", t.addr)
+	if err != nil {
+		return err
+	}
+	t.lock.Lock()
+	t.listener = listener
+	t.lock.Unlock()
 	if t.tlsCfg != nil {
-		t.listener, err = tls.Listen("tcp", t.addr, t.tlsCfg)
-		if err != nil {
-			t.listener = nil
-			return err
-		}
 		Info("TcpServer.Listen: tls://%s", t.addr)
 	} else {
-		t.listener, err = net.Listen("tcp", t.addr)
-		if err != nil {
-			t.listener = nil
-			return err
-		}
 		Info("TcpServer.Listen: tcp://%s", t.addr)
 	}
 	return nil
 }
 
+func (t *TcpServer) getListener() net.Listener {
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+	return t.listener
+}
+
 func (t *TcpServer) Close() {
-	if t.listener != nil {
-		_ = t.listener.Close()
+	t.lock.Lock()
+	listener := t.listener
+	t.listener = nil
+	t.lock.Unlock()
+	if listener != nil {
+		_ = listener.Close()
 		Info("TcpServer.Close: %s", t.addr)
-		t.listener = nil
 	}
 }
 
 func (t *TcpServer) Accept() {
 	Debug("TcpServer.Accept")
 
+	var listener net.Listener
 	for {
-		if t.listener != nil {
+		if listener = t.getListener(); listener != nil {
 			break
 		}
 		if err := t.Listen(); err != nil {
@@ -74,21 +88,89 @@ func (t *TcpServer) Accept() {
 	}
 	defer t.Close()
 	for {
-		conn, err := t.listener.Accept()
+		conn, err := listener.Accept()
 		if err != nil {
 			Error("TcpServer.Accept: %s", err)
 			return
 		}
-		t.sts.AcpCount++
-		t.onClients <- NewTcpClientFromConn(conn)
+		atomic.AddInt64(&t.sts.AcpCount, 1)
+		go t.accept(conn)
+	}
+}
+
+func (t *TcpServer) accept(conn net.Conn) {
+	if t.proxyProto != nil {
+		pc, err := t.proxyProto.Accept(conn)
+		if err != nil {
+			Warn("TcpServer.accept: %s %s", conn.RemoteAddr(), err)
+			_ = conn.Close()
+			return
+		}
+		conn = pc
+	}
+	if err := t.permit(conn.RemoteAddr().String()); err != nil {
+		Debug("TcpServer.accept: %s", err)
+		_ = conn.Close()
+		return
+	}
+	if t.tlsCfg != nil {
+		if pc, ok := conn.(*proxyConn); ok {
+			conn = pc.wrap(tls.Server(pc, t.tlsCfg))
+		} else {
+			conn = tls.Server(conn, t.tlsCfg)
+		}
 	}
+	MuxAccept(conn, t.newClient, t.onClients, t.permit)
+}
+
+func (t *TcpServer) newClient(conn net.Conn) SocketClient {
+	return NewTcpClientFromConn(conn)
 }
 
 // Client Implement
 
+func DialTcp(addr string, cfg *tls.Config, proxy *Proxy) (net.Conn, error) {
+	if proxy == nil || !proxy.UseFor(addr) {
+		if cfg != nil {
+			return tls.Dial("tcp", addr, cfg)
+		}
+		return net.Dial("tcp", addr)
+	}
+	conn, err := proxy.Dial(addr)
+	if err != nil {
+		return nil, err
+	}
+	if cfg != nil {
+		return DialTls(conn, addr, cfg, proxy.Timeout)
+	}
+	return conn, nil
+}
+
+// DialTcpFrom binds the local address if not empty, and it is ignored if
+// dial by proxy.
+func DialTcpFrom(local, addr string, cfg *tls.Config, proxy *Proxy) (net.Conn, error) {
+	if local == "" || (proxy != nil && proxy.UseFor(addr)) {
+		return DialTcp(addr, cfg, proxy)
+	}
+	if _, _, err := net.SplitHostPort(local); err != nil {
+		local = net.JoinHostPort(local, "0")
+	}
+	laddr, err := net.ResolveTCPAddr("tcp", local)
+	if err != nil {
+		return nil, err
+	}
+	dialer := &net.Dialer{LocalAddr: laddr}
+	if cfg != nil {
+		return tls.DialWithDialer(dialer, "tcp", addr, cfg)
+	}
+	return dialer.Dial("tcp", addr)
+}
+
 type TcpClient struct {
 	socketClient
 	tlsCfg *tls.Config
+	proxy  *Proxy
+	local  string
 }
 
 func NewTcpClient(addr string, cfg *tls.Config) *TcpClient {
@@ -125,22 +207,18 @@ func NewTcpClientFromConn(conn net.Conn) *TcpClient {
 }
 
 func (t *TcpClient) LocalAddr() string {
-	if t.conn != nil {
-		return t.conn.LocalAddr().String()
+	if conn := t.getConn(); conn != nil {
+		return conn.LocalAddr().String()
 	}
 	return t.addr
 }
 
 func (t *TcpClient) Connect() error {
 	t.lock.Lock()
-	if t.conn != nil || t.status == CL_TERMINAL || t.status == CL_UNAUTH {
+	if t.getConn() != nil || t.status == CL_TERMINAL || t.status == CL_UNAUTH {
 		t.lock.Unlock()
 		return nil
 	}
-	if t.conn != nil {
-		_ = t.conn.Close()
-		t.conn = nil
-	}
 	t.status = CL_CONNECTING
 	t.lock.Unlock()
 
@@ -150,16 +228,10 @@ func (t *TcpClient) Connect() error {
 		Info("TcpClient.Connect: tcp://%s", t.addr)
 	}
 
-	var err error
-	var conn net.Conn
-	if t.tlsCfg != nil {
-		conn, err = tls.Dial("tcp", t.addr, t.tlsCfg)
-	} else {
-		conn, err = net.Dial("tcp", t.addr)
-	}
+	conn, err := DialTcpFrom(t.local, t.addr, t.tlsCfg, t.proxy)
 	if err == nil {
 		t.lock.Lock()
-		t.conn = conn
+		t.setConn(conn)
 		t.status = CL_CONNECTED
 		t.lock.Unlock()
 		if t.listener.OnConnected != nil {
@@ -169,15 +241,25 @@ func (t *TcpClient) Connect() error {
 	return err
 }
 
+// SetProxy dials by the proxy if not nil.
+func (t *TcpClient) SetProxy(proxy *Proxy) {
+	t.proxy = proxy
+}
+
+// SetLocal binds the address of an interface to connect.
+func (t *TcpClient) SetLocal(addr string) {
+	t.local = addr
+}
+
 func (t *TcpClient) Close() {
 	t.lock.Lock()
-	if t.conn != nil {
+	if conn := t.getConn(); conn != nil {
 		if t.status != CL_TERMINAL {
 			t.status = CL_CLOSED
 		}
 		Info("TcpClient.Close: %s", t.addr)
-		_ = t.conn.Close()
-		t.conn = nil
+		_ = conn.Close()
+		t.setConn(nil)
 		t.private = nil
 		t.lock.Unlock()
 		if t.listener.OnClose != nil {
@@ -1,3 +1,705 @@
 package libol
 
-// TODO implement socket interface.
+import (
+	"encoding/binary"
+	"io"
+	"math/rand"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Every datagram starts with one byte of kind and four bytes of session id,
+// and the session id survives NAT rebinding when the source port changes.
+// The probe is echoed by server without any session.
+const (
+	UDPHSIZE = 0x05
+	UDPDATA  = 0x00
+	UDPOPEN  = 0x01
+	UDPKEEP  = 0x02
+	UDPRESET = 0x03
+	UDPPROBE = 0x04
+)
+
+type UdpConfig struct {
+	Keepalive time.Duration // default 10s
+	Timeout   time.Duration // default 60s
+	// sessions opened but not authenticated yet.
+	Pending          int           // default 128
+	PendingPerSource int           // default 8
+	PendingTimeout   time.Duration // default 5s
+}
+
+var defaultUdpConfig = UdpConfig{
+	Keepalive:        10 * time.Second,
+	Timeout:          60 * time.Second,
+	Pending:          128,
+	PendingPerSource: 8,
+	PendingTimeout:   5 * time.Second,
+}
+
+func (c *UdpConfig) Right() {
+	if c.Keepalive == 0 {
+		c.Keepalive = defaultUdpConfig.Keepalive
+	}
+	if c.Timeout == 0 {
+		c.Timeout = defaultUdpConfig.Timeout
+	}
+	if c.Pending == 0 {
+		c.Pending = defaultUdpConfig.Pending
+	}
+	if c.PendingPerSource == 0 {
+		c.PendingPerSource = defaultUdpConfig.PendingPerSource
+	}
+	if c.PendingTimeout == 0 {
+		c.PendingTimeout = defaultUdpConfig.PendingTimeout
+	}
+}
+
+// udpConn emulates a stream connection on a datagram socket.
+type udpConn struct {
+	lock    sync.RWMutex
+	conn    *net.UDPConn
+	remote  *net.UDPAddr // nil if conn is connected.
+	session uint32
+	readQ   chan []byte // datagrams dispatched by server.
+	buffer  []byte
+	pending []byte
+	done    chan struct{}
+	once    sync.Once
+	seen    int64
+	onClose func(c *udpConn)
+}
+
+func newUdpConn(conn *net.UDPConn, remote *net.UDPAddr, session uint32) *udpConn {
+	c := &udpConn{
+		conn:    conn,
+		remote:  remote,
+		session: session,
+		done:    make(chan struct{}),
+		seen:    time.Now().Unix(),
+	}
+	if remote != nil {
+		c.readQ = make(chan []byte, 1024)
+	} else {
+		c.buffer = make([]byte, 65536)
+	}
+	return c
+}
+
+func (c *udpConn) next() ([]byte, error) {
+	if c.readQ != nil {
+		select {
+		case data := <-c.readQ:
+			return data, nil
+		case <-c.done:
+			return nil, io.EOF
+		}
+	}
+	for {
+		n, err := c.conn.Read(c.buffer)
+		if err != nil {
+			return nil, err
+		}
+		if n < UDPHSIZE || binary.BigEndian.Uint32(c.buffer[1:5]) != c.session {
+			continue
+		}
+		switch c.buffer[0] {
+		case UDPDATA:
+			return c.buffer[UDPHSIZE:n], nil
+		case UDPRESET:
+			return nil, NewErr("session %08x reset by peer", c.session)
+		}
+	}
+}
+
+func (c *udpConn) Read(b []byte) (int, error) {
+	for len(c.pending) == 0 {
+		data, err := c.next()
+		if err != nil {
+			return 0, err
+		}
+		c.pending = data
+	}
+	n := copy(b, c.pending)
+	c.pending = c.pending[n:]
+	return n, nil
+}
+
+func (c *udpConn) writeKind(kind byte, b []byte) (int, error) {
+	buf := make([]byte, UDPHSIZE+len(b))
+	buf[0] = kind
+	binary.BigEndian.PutUint32(buf[1:5], c.session)
+	copy(buf[UDPHSIZE:], b)
+	if remote := c.Remote(); remote != nil {
+		return c.conn.WriteToUDP(buf, remote)
+	}
+	return c.conn.Write(buf)
+}
+
+func (c *udpConn) Write(b []byte) (int, error) {
+	select {
+	case <-c.done:
+		return 0, io.ErrClosedPipe
+	default:
+	}
+	if _, err := c.writeKind(UDPDATA, b); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+func (c *udpConn) keepalive(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.done:
+			return
+		case <-ticker.C:
+			if _, err := c.writeKind(UDPKEEP, nil); err != nil {
+				Warn("udpConn.keepalive: %s", err)
+			}
+		}
+	}
+}
+
+func (c *udpConn) Close() error {
+	c.once.Do(func() {
+		close(c.done)
+		if c.readQ == nil {
+			_ = c.conn.Close()
+		}
+		if c.onClose != nil {
+			c.onClose(c)
+		}
+	})
+	return nil
+}
+
+func (c *udpConn) Remote() *net.UDPAddr {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	return c.remote
+}
+
+func (c *udpConn) SetRemote(addr *net.UDPAddr) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.remote = addr
+}
+
+func (c *udpConn) LocalAddr() net.Addr {
+	return c.conn.LocalAddr()
+}
+
+func (c *udpConn) RemoteAddr() net.Addr {
+	if remote := c.Remote(); remote != nil {
+		return remote
+	}
+	return c.conn.RemoteAddr()
+}
+
+func (c *udpConn) SetDeadline(t time.Time) error {
+	if c.readQ != nil {
+		return nil
+	}
+	return c.conn.SetDeadline(t)
+}
+
+func (c *udpConn) SetReadDeadline(t time.Time) error {
+	if c.readQ != nil {
+		return nil
+	}
+	return c.conn.SetReadDeadline(t)
+}
+
+func (c *udpConn) SetWriteDeadline(t time.Time) error {
+	if c.readQ != nil {
+		return nil
+	}
+	return c.conn.SetWriteDeadline(t)
+}
+
+// Server Implement
+
+type udpSession struct {
+	conn   *udpConn
+	client *UdpClient
+	opened int64 // unix nano.
+}
+
+// pending is opened but not authenticated.
+func (s *udpSession) pending() bool {
+	return s.client.Status() != CL_AUEHED
+}
+
+type UdpServer struct {
+	socketServer
+	udpCfg   *UdpConfig
+	conn     *net.UDPConn // guarded by lock.
+	sessions map[uint32]*udpSession
+	remotes  map[string]*udpSession
+}
+
+func NewUdpServer(listen string, cfg *UdpConfig) *UdpServer {
+	t := &UdpServer{
+		udpCfg: cfg,
+		socketServer: socketServer{
+			addr:       listen,
+			sts:        ServerSts{},
+			maxClient:  1024,
+			clients:    make(map[SocketClient]bool, 1024),
+			onClients:  make(chan SocketClient, 4),
+			offClients: make(chan SocketClient, 8),
+		},
+		sessions: make(map[uint32]*udpSession, 1024),
+		remotes:  make(map[string]*udpSession, 1024),
+	}
+	if t.udpCfg == nil {
+		t.udpCfg = &defaultUdpConfig
+	} else {
+		cfg := *t.udpCfg
+		cfg.Right()
+		t.udpCfg = &cfg
+	}
+	t.close = t.Close
+	if err := t.Listen(); err != nil {
+		Debug("NewUdpServer: %s", err)
+	}
+	return t
+}
+
+func (t *UdpServer) Listen() (err error) {
+	addr, err := net.ResolveUDPAddr("udp", t.addr)
+	if err != nil {
+		return err
+	}
+	conn, err := net.ListenUDP("udp", addr)
+	if err != nil {
+		return err
+	}
+	t.lock.Lock()
+	t.conn = conn
+	t.lock.Unlock()
+	Info("UdpServer.Listen: udp://%s", t.addr)
+	return nil
+}
+
+func (t *UdpServer) getConn() *net.UDPConn {
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+	return t.conn
+}
+
+func (t *UdpServer) Close() {
+	t.lock.Lock()
+	conn := t.conn
+	t.conn = nil
+	t.lock.Unlock()
+	if conn != nil {
+		_ = conn.Close()
+		Info("UdpServer.Close: %s", t.addr)
+	}
+}
+
+func (t *UdpServer) reset(addr *net.UDPAddr, session uint32) {
+	conn := t.getConn()
+	if conn == nil {
+		return
+	}
+	buf := make([]byte, UDPHSIZE)
+	buf[0] = UDPRESET
+	binary.BigEndian.PutUint32(buf[1:5], session)
+	_, _ = conn.WriteToUDP(buf, addr)
+}
+
+// echo replies the probe if permitted by filter, and never by guard since
+// nothing is allocated for it.
+func (t *UdpServer) echo(conn *net.UDPConn, addr *net.UDPAddr, probe []byte) {
+	if t.filter != nil && !t.filter.Permit(addr.IP) {
+		atomic.AddInt64(&t.sts.RejCount, 1)
+		return
+	}
+	_, _ = conn.WriteToUDP(probe, addr)
+}
+
+func (t *UdpServer) onClose(c *udpConn) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if s, ok := t.sessions[c.session]; ok && s.conn == c {
+		delete(t.sessions, c.session)
+	}
+	remote := c.Remote().String()
+	if s, ok := t.remotes[remote]; ok && s.conn == c {
+		delete(t.remotes, remote)
+	}
+}
+
+func (t *UdpServer) opened(session uint32) bool {
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+	_, ok := t.sessions[session]
+	return ok
+}
+
+// trusted checks the datagram from another address is sent by the peer
+// authenticated: it must open by the crypt key of session, or only the
+// source port is changed if crypt is disabled.
+func (s *udpSession) trusted(addr *net.UDPAddr, kind byte, data []byte) bool {
+	if s.client.Status() != CL_AUEHED {
+		return false
+	}
+	if crypt := s.client.Crypt(); crypt != nil {
+		hl := GetHeaderLen()
+		return kind == UDPDATA && len(data) > hl && crypt.Verify(data[hl:])
+	}
+	return addr.IP.Equal(s.conn.Remote().IP)
+}
+
+// find session by remote address, and rebinding it if trusted.
+func (t *UdpServer) find(addr *net.UDPAddr, session uint32, kind byte, data []byte) (*udpSession, bool) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	remote := addr.String()
+	if s, ok := t.remotes[remote]; ok && s.conn.session == session {
+		return s, true
+	}
+	s, ok := t.sessions[session]
+	if !ok {
+		return nil, false
+	}
+	if !s.trusted(addr, kind, data) {
+		return s, false
+	}
+	Info("UdpServer.find: %08x rebinding %s to %s", session, s.conn.Remote(), remote)
+	if o, ok := t.remotes[s.conn.Remote().String()]; ok && o == s {
+		delete(t.remotes, s.conn.Remote().String())
+	}
+	s.conn.SetRemote(addr)
+	t.remotes[remote] = s
+	return s, true
+}
+
+// limit checks the pending sessions globally and from the source,
+// and must be called with lock held.
+func (t *UdpServer) limit(addr *net.UDPAddr) error {
+	total, source := 0, 0
+	for _, s := range t.sessions {
+		if !s.pending() {
+			continue
+		}
+		total++
+		if s.conn.Remote().IP.Equal(addr.IP) {
+			source++
+		}
+	}
+	if total >= t.udpCfg.Pending {
+		return NewErr("too many pending sessions")
+	}
+	if source >= t.udpCfg.PendingPerSource {
+		return NewErr("too many pending sessions from %s", addr.IP)
+	}
+	return nil
+}
+
+func (t *UdpServer) open(addr *net.UDPAddr, session uint32) (*udpSession, error) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if s, ok := t.sessions[session]; ok {
+		return s, nil
+	}
+	if t.conn == nil {
+		return nil, NewErr("server closed")
+	}
+	if err := t.limit(addr); err != nil {
+		return nil, err
+	}
+	conn := newUdpConn(t.conn, addr, session)
+	conn.onClose = t.onClose
+	s := &udpSession{
+		conn:   conn,
+		client: NewUdpClientFromConn(conn),
+		opened: time.Now().UnixNano(),
+	}
+	t.sessions[session] = s
+	t.remotes[addr.String()] = s
+	return s, nil
+}
+
+func (t *UdpServer) expire() {
+	interval := t.udpCfg.Keepalive
+	if t.udpCfg.PendingTimeout < interval {
+		interval = t.udpCfg.PendingTimeout
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		if t.getConn() == nil {
+			return
+		}
+		now := time.Now()
+		deadline := now.Add(-t.udpCfg.Timeout).Unix()
+		pending := now.Add(-t.udpCfg.PendingTimeout).UnixNano()
+		expired := make([]*UdpClient, 0, 32)
+		t.lock.RLock()
+		for _, s := range t.sessions {
+			if atomic.LoadInt64(&s.conn.seen) < deadline {
+				expired = append(expired, s.client)
+			} else if s.opened < pending && s.pending() {
+				expired = append(expired, s.client)
+			}
+		}
+		t.lock.RUnlock()
+		for _, client := range expired {
+			Warn("UdpServer.expire: %s", client)
+			t.OffClient(client)
+		}
+	}
+}
+
+func (t *UdpServer) Accept() {
+	Debug("UdpServer.Accept")
+
+	var conn *net.UDPConn
+	for {
+		if conn = t.getConn(); conn != nil {
+			break
+		}
+		if err := t.Listen(); err != nil {
+			Warn("UdpServer.Accept: %s", err)
+		}
+		time.Sleep(time.Second * 5)
+	}
+	defer t.Close()
+	go t.expire()
+
+	buf := make([]byte, 65536)
+	for {
+		n, addr, err := conn.ReadFromUDP(buf)
+		if err != nil {
+			Error("UdpServer.Accept: %s", err)
+			return
+		}
+		if n < UDPHSIZE {
+			continue
+		}
+		kind := buf[0]
+		session := binary.BigEndian.Uint32(buf[1:5])
+		if kind == UDPPROBE {
+			t.echo(conn, addr, buf[:UDPHSIZE])
+			continue
+		}
+		if kind == UDPOPEN {
+			if !t.opened(session) {
+				if err := t.permit(addr.String()); err != nil {
+					Debug("UdpServer.Accept: %s", err)
+					t.reset(addr, session)
+					continue
+				}
+			}
+			s, err := t.open(addr, session)
+			if err != nil {
+				Debug("UdpServer.Accept: %s", err)
+				t.reset(addr, session)
+				continue
+			}
+			if s.client.Status() == CL_INIT {
+				s.client.SetStatus(CL_CONNECTING)
+				atomic.AddInt64(&t.sts.AcpCount, 1)
+				t.onClients <- s.client
+			}
+			continue
+		}
+		s, ok := t.find(addr, session, kind, buf[UDPHSIZE:n])
+		if s == nil {
+			t.reset(addr, session)
+			continue
+		}
+		if !ok {
+			Debug("UdpServer.Accept: %08x untrusted from %s", session, addr)
+			atomic.AddInt64(&t.sts.DrpCount, 1)
+			continue
+		}
+		atomic.StoreInt64(&s.conn.seen, time.Now().Unix())
+		if kind != UDPDATA {
+			continue
+		}
+		data := make([]byte, n-UDPHSIZE)
+		copy(data, buf[UDPHSIZE:n])
+		select {
+		case s.conn.readQ <- data:
+		default:
+			atomic.AddInt64(&t.sts.DrpCount, 1)
+		}
+	}
+}
+
+// ProbeUdp sends a probe to the server, and returns nil if echoed in
+// timeout. The reset is also accepted, since sent by the server not known
+// the probe.
+func ProbeUdp(addr string, timeout time.Duration) error {
+	raddr, err := net.ResolveUDPAddr("udp", addr)
+	if err != nil {
+		return err
+	}
+	conn, err := net.DialUDP("udp", nil, raddr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	session := rand.Uint32()
+	buf := make([]byte, UDPHSIZE)
+	buf[0] = UDPPROBE
+	binary.BigEndian.PutUint32(buf[1:5], session)
+	if _, err := conn.Write(buf); err != nil {
+		return err
+	}
+	_ = conn.SetReadDeadline(time.Now().Add(timeout))
+	data := make([]byte, 64)
+	for {
+		n, err := conn.Read(data)
+		if err != nil {
+			return err
+		}
+		if n < UDPHSIZE || binary.BigEndian.Uint32(data[1:5]) != session {
+			continue
+		}
+		if data[0] == UDPPROBE || data[0] == UDPRESET {
+			return nil
+		}
+	}
+}
+
+// Client Implement
+
+type UdpClient struct {
+	socketClient
+	udpCfg *UdpConfig
+}
+
+func NewUdpClient(addr string, cfg *UdpConfig) *UdpClient {
+	c := &UdpClient{
+		udpCfg: cfg,
+		socketClient: socketClient{
+			addr:    addr,
+			NewTime: time.Now().Unix(),
+			connWrapper: connWrapper{
+				maxSize: 1514,
+				minSize: 15,
+				noDelay: true, // one frame in a datagram.
+			},
+			status: CL_INIT,
+		},
+	}
+	c.connect = c.Connect
+	if c.udpCfg == nil {
+		c.udpCfg = &defaultUdpConfig
+	}
+	return c
+}
+
+func NewUdpClientFromConn(conn *udpConn) *UdpClient {
+	c := &UdpClient{
+		socketClient: socketClient{
+			addr: conn.RemoteAddr().String(),
+			connWrapper: connWrapper{
+				conn:    conn,
+				maxSize: 1514,
+				minSize: 15,
+				noDelay: true,
+			},
+			NewTime: time.Now().Unix(),
+		},
+	}
+	c.connect = c.Connect
+	return c
+}
+
+func (c *UdpClient) LocalAddr() string {
+	if conn := c.getConn(); conn != nil {
+		return conn.LocalAddr().String()
+	}
+	return c.addr
+}
+
+// Connect dials again if closed, and the client accepted by server never
+// dials since no config to connect.
+func (c *UdpClient) Connect() error {
+	c.lock.Lock()
+	if c.getConn() != nil || c.status == CL_TERMINAL || c.status == CL_UNAUTH {
+		c.lock.Unlock()
+		return nil
+	}
+	if c.udpCfg == nil {
+		c.lock.Unlock()
+		return NewErr("%s: accepted by server", c)
+	}
+	c.status = CL_CONNECTING
+	c.lock.Unlock()
+
+	Info("UdpClient.Connect: udp://%s", c.addr)
+	addr, err := net.ResolveUDPAddr("udp", c.addr)
+	if err != nil {
+		return err
+	}
+	udp, err := net.DialUDP("udp", nil, addr)
+	if err != nil {
+		return err
+	}
+	conn := newUdpConn(udp, nil, rand.Uint32())
+	if _, err := conn.writeKind(UDPOPEN, nil); err != nil {
+		_ = conn.Close()
+		return err
+	}
+	go conn.keepalive(c.udpCfg.Keepalive)
+
+	c.lock.Lock()
+	c.setConn(conn)
+	c.status = CL_CONNECTED
+	c.lock.Unlock()
+	if c.listener.OnConnected != nil {
+		_ = c.listener.OnConnected(c)
+	}
+	return nil
+}
+
+func (c *UdpClient) Close() {
+	c.lock.Lock()
+	if conn := c.getConn(); conn != nil {
+		if c.status != CL_TERMINAL {
+			c.status = CL_CLOSED
+		}
+		Info("UdpClient.Close: %s", c.addr)
+		c.setConn(nil)
+		c.private = nil
+		c.lock.Unlock()
+		// closed out of lock, and server looks up status in its lock.
+		_ = conn.Close()
+		if c.listener.OnClose != nil {
+			_ = c.listener.OnClose(c)
+		}
+	} else {
+		c.lock.Unlock()
+	}
+}
+
+func (c *UdpClient) Terminal() {
+	c.SetStatus(CL_TERMINAL)
+	c.Close()
+}
+
+func (c *UdpClient) SetStatus(v uint8) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.status != v {
+		if c.listener.OnStatus != nil {
+			c.listener.OnStatus(c, c.status, v)
+		}
+		c.status = v
+	}
+}
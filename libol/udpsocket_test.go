@@ -0,0 +1,136 @@
+package libol
+
+import (
+	"github.com/stretchr/testify/assert"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestUdpClientAndServer(t *testing.T) {
+	server := NewUdpServer("127.0.0.1:0", nil)
+	addr := server.getConn().LocalAddr().(*net.UDPAddr)
+	frames := make(chan string, 8)
+	go server.Accept()
+	go server.Loop(ServerListener{
+		OnClient: func(client SocketClient) error {
+			client.SetStatus(CL_CONNECTED)
+			return nil
+		},
+		ReadAt: func(client SocketClient, p []byte) error {
+			frames <- string(p)
+			return client.WriteMsg(p)
+		},
+	})
+
+	client := NewUdpClient(addr.String(), nil)
+	assert.Nil(t, client.Connect(), "connect.")
+	frame := "hello openlan frame"
+	assert.Nil(t, client.WriteMsg([]byte(frame)), "write.")
+
+	select {
+	case data := <-frames:
+		assert.Equal(t, frame, data, "be the same.")
+	case <-time.After(3 * time.Second):
+		t.Fatal("server not received.")
+	}
+	data := make([]byte, MAXBUF)
+	n, err := client.ReadMsg(data)
+	assert.Nil(t, err, "read.")
+	assert.Equal(t, frame, string(data[:n]), "be the same.")
+
+	// same session from another source port is dropped until authenticated.
+	conn := client.getConn().(*udpConn)
+	other, err := net.DialUDP("udp", nil, addr)
+	assert.Nil(t, err, "dial.")
+	rebind := newUdpConn(other, nil, conn.session)
+	_, _ = rebind.Write(BuildMessage([]byte(frame + " rebind")))
+	select {
+	case <-frames:
+		t.Fatal("untrusted received.")
+	case <-time.After(500 * time.Millisecond):
+	}
+	server.lock.RLock()
+	s := server.sessions[conn.session]
+	server.lock.RUnlock()
+	assert.Equal(t, client.LocalAddr(), s.conn.Remote().String(), "not rebinding.")
+
+	s.client.SetStatus(CL_AUEHED)
+	_, _ = rebind.Write(BuildMessage([]byte(frame + " rebind")))
+	select {
+	case data := <-frames:
+		assert.Equal(t, frame+" rebind", data, "be the same.")
+	case <-time.After(3 * time.Second):
+		t.Fatal("server not received.")
+	}
+	assert.Equal(t, other.LocalAddr().String(), s.conn.Remote().String(), "rebinding.")
+
+	// unknown session is reset.
+	reset := newUdpConn(other, nil, conn.session+1)
+	_, _ = reset.Write(BuildMessage([]byte(frame)))
+	_, err = reset.Read(data)
+	assert.NotNil(t, err, "reset.")
+
+	// accepted client never dials after closed.
+	s.client.Close()
+	assert.NotNil(t, s.client.WriteMsg([]byte(frame)), "write after closed.")
+	assert.NotNil(t, s.client.Connect(), "connect.")
+
+	client.Close()
+	server.Close()
+}
+
+func TestUdpServerPending(t *testing.T) {
+	cfg := &UdpConfig{PendingPerSource: 2, PendingTimeout: 200 * time.Millisecond}
+	server := NewUdpServer("127.0.0.1:0", cfg)
+	addr := server.getConn().LocalAddr().(*net.UDPAddr)
+	go server.Accept()
+	go server.Loop(ServerListener{})
+
+	sessions := func() int {
+		server.lock.RLock()
+		defer server.lock.RUnlock()
+		return len(server.sessions)
+	}
+	conns := make([]*udpConn, 0, 3)
+	for i := 0; i < 3; i++ {
+		other, err := net.DialUDP("udp", nil, addr)
+		assert.Nil(t, err, "dial.")
+		conn := newUdpConn(other, nil, uint32(i+1))
+		_, _ = conn.writeKind(UDPOPEN, nil)
+		conns = append(conns, conn)
+	}
+	// the third from the same source is reset.
+	data := make([]byte, MAXBUF)
+	_, err := conns[2].Read(data)
+	assert.NotNil(t, err, "reset.")
+	assert.Equal(t, 2, sessions(), "pending.")
+
+	// not authenticated in time, and expired.
+	time.Sleep(600 * time.Millisecond)
+	assert.Equal(t, 0, sessions(), "expired.")
+
+	for _, conn := range conns {
+		_ = conn.Close()
+	}
+	server.Close()
+}
+
+func TestUdpServerProbe(t *testing.T) {
+	server := NewUdpServer("127.0.0.1:0", nil)
+	addr := server.getConn().LocalAddr().String()
+	go server.Accept()
+	defer server.Close()
+
+	assert.Nil(t, ProbeUdp(addr, time.Second), "echoed.")
+	server.lock.RLock()
+	assert.Equal(t, 0, len(server.sessions), "no session.")
+	server.lock.RUnlock()
+
+	denied := NewUdpServer("127.0.0.1:0", nil)
+	denied.SetFilter(&AddrFilter{Deny: []*net.IPNet{{IP: net.IPv4(127, 0, 0, 1), Mask: net.CIDRMask(32, 32)}}})
+	go denied.Accept()
+	defer denied.Close()
+	addr = denied.getConn().LocalAddr().String()
+	assert.NotNil(t, ProbeUdp(addr, 500*time.Millisecond), "denied.")
+}
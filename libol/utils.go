@@ -132,6 +132,11 @@ func PrettyTime(t int64) string {
 	return fmt.Sprintf("%dd%dh", days, hours%24)
 }
 
+// Milliseconds returns d in milliseconds with fraction.
+func Milliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
 func PrettyBytes(b uint64) string {
 	split := func(_v uint64, _m uint64) (i uint64, d int) {
 		v := float64(_v%_m) / float64(_m)
@@ -0,0 +1,298 @@
+package libol
+
+import (
+	"crypto/tls"
+	"golang.org/x/net/websocket"
+	"net"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+type WebConfig struct {
+	Path   string // default /olan/ws
+	TlsCfg *tls.Config
+	Proxy  *Proxy
+}
+
+var defaultWebConfig = WebConfig{
+	Path: "/olan/ws",
+}
+
+// Server Implement
+
+type WebServer struct {
+	socketServer
+	webCfg   *WebConfig
+	listener net.Listener // guarded by lock.
+}
+
+func NewWebServer(listen string, cfg *WebConfig) *WebServer {
+	t := &WebServer{
+		webCfg: cfg,
+		socketServer: socketServer{
+			addr:       listen,
+			sts:        ServerSts{},
+			maxClient:  1024,
+			clients:    make(map[SocketClient]bool, 1024),
+			onClients:  make(chan SocketClient, 4),
+			offClients: make(chan SocketClient, 8),
+		},
+	}
+	if t.webCfg == nil {
+		t.webCfg = &defaultWebConfig
+	}
+	if t.webCfg.Path == "" {
+		t.webCfg.Path = defaultWebConfig.Path
+	}
+	t.close = t.Close
+	if err := t.Listen(); err != nil {
+		Debug("NewWebServer: %s", err)
+	}
+	return t
+}
+
+func (t *WebServer) Listen() (err error) {
+	listener, err := net.Listen("tcp", t.addr)
+	if err != nil {
+		return err
+	}
+	if t.webCfg.TlsCfg != nil {
+		listener = tls.NewListener(listener, t.webCfg.TlsCfg)
+		Info("WebServer.Listen: wss://%s%s", t.addr, t.webCfg.Path)
+	} else {
+		Info("WebServer.Listen: ws://%s%s", t.addr, t.webCfg.Path)
+	}
+	t.lock.Lock()
+	t.listener = listener
+	t.lock.Unlock()
+	return nil
+}
+
+func (t *WebServer) getListener() net.Listener {
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+	return t.listener
+}
+
+func (t *WebServer) Close() {
+	t.lock.Lock()
+	listener := t.listener
+	t.listener = nil
+	t.lock.Unlock()
+	if listener != nil {
+		_ = listener.Close()
+		Info("WebServer.Close: %s", t.addr)
+	}
+}
+
+func (t *WebServer) Path() string {
+	return t.webCfg.Path
+}
+
+// Handler could be mounted on other http server, and feeds the same clients.
+func (t *WebServer) Handler() http.Handler {
+	return websocket.Server{
+		Handler: t.handle,
+		Handshake: func(config *websocket.Config, r *http.Request) error {
+			return nil // no origin for points.
+		},
+	}
+}
+
+func (t *WebServer) handle(ws *websocket.Conn) {
+	if err := t.permit(ws.Request().RemoteAddr); err != nil {
+		Debug("WebServer.handle: %s", err)
+		_ = ws.Close()
+		return
+	}
+	ws.PayloadType = websocket.BinaryFrame
+	client := NewWebClientFromConn(ws)
+	atomic.AddInt64(&t.sts.AcpCount, 1)
+	t.onClients <- client
+	<-client.done // hold request until client closed.
+}
+
+func (t *WebServer) Accept() {
+	Debug("WebServer.Accept")
+
+	var listener net.Listener
+	for {
+		if listener = t.getListener(); listener != nil {
+			break
+		}
+		if err := t.Listen(); err != nil {
+			Warn("WebServer.Accept: %s", err)
+		}
+		time.Sleep(time.Second * 5)
+	}
+	defer t.Close()
+	mux := http.NewServeMux()
+	mux.Handle(t.webCfg.Path, t.Handler())
+	server := &http.Server{Handler: mux}
+	if err := server.Serve(listener); err != nil {
+		Error("WebServer.Accept: %s", err)
+	}
+}
+
+// Client Implement
+
+type WebClient struct {
+	socketClient
+	webCfg *WebConfig
+	done   chan bool
+}
+
+func NewWebClient(addr string, cfg *WebConfig) *WebClient {
+	c := &WebClient{
+		webCfg: cfg,
+		socketClient: socketClient{
+			addr:    addr,
+			NewTime: time.Now().Unix(),
+			connWrapper: connWrapper{
+				maxSize: 1514,
+				minSize: 15,
+			},
+			status: CL_INIT,
+		},
+		done: make(chan bool),
+	}
+	c.connect = c.Connect
+	if c.webCfg == nil {
+		c.webCfg = &defaultWebConfig
+	}
+	if c.webCfg.Path == "" {
+		c.webCfg.Path = defaultWebConfig.Path
+	}
+	return c
+}
+
+func NewWebClientFromConn(conn *websocket.Conn) *WebClient {
+	c := &WebClient{
+		socketClient: socketClient{
+			addr: conn.Request().RemoteAddr,
+			connWrapper: connWrapper{
+				conn:    conn,
+				maxSize: 1514,
+				minSize: 15,
+			},
+			NewTime: time.Now().Unix(),
+		},
+		done: make(chan bool),
+	}
+	c.connect = c.Connect
+	return c
+}
+
+func (c *WebClient) LocalAddr() string {
+	if conn := c.getConn(); conn != nil {
+		return conn.LocalAddr().String()
+	}
+	return c.addr
+}
+
+// Url is empty for the client accepted by server.
+func (c *WebClient) Url() string {
+	if c.webCfg == nil {
+		return ""
+	}
+	if c.webCfg.TlsCfg != nil {
+		return "wss://" + c.addr + c.webCfg.Path
+	}
+	return "ws://" + c.addr + c.webCfg.Path
+}
+
+// Connect dials again if closed, and the client accepted by server never
+// dials since no config to connect.
+func (c *WebClient) Connect() error {
+	c.lock.Lock()
+	if c.getConn() != nil || c.status == CL_TERMINAL || c.status == CL_UNAUTH {
+		c.lock.Unlock()
+		return nil
+	}
+	if c.webCfg == nil {
+		c.lock.Unlock()
+		return NewErr("%s: accepted by server", c)
+	}
+	c.status = CL_CONNECTING
+	c.lock.Unlock()
+
+	url := c.Url()
+	Info("WebClient.Connect: %s", url)
+	config, err := websocket.NewConfig(url, url)
+	if err != nil {
+		return err
+	}
+	config.TlsConfig = c.webCfg.TlsCfg
+	conn, err := c.dial(config)
+	if err != nil {
+		return err
+	}
+	conn.PayloadType = websocket.BinaryFrame
+
+	c.lock.Lock()
+	c.setConn(conn)
+	c.status = CL_CONNECTED
+	c.lock.Unlock()
+	if c.listener.OnConnected != nil {
+		_ = c.listener.OnConnected(c)
+	}
+	return nil
+}
+
+func (c *WebClient) dial(config *websocket.Config) (*websocket.Conn, error) {
+	proxy := c.webCfg.Proxy
+	if proxy == nil || !proxy.UseFor(c.addr) {
+		return websocket.DialConfig(config)
+	}
+	conn, err := DialTcp(c.addr, c.webCfg.TlsCfg, proxy)
+	if err != nil {
+		return nil, err
+	}
+	ws, err := websocket.NewClient(config, conn)
+	if err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	return ws, nil
+}
+
+func (c *WebClient) Close() {
+	c.lock.Lock()
+	if conn := c.getConn(); conn != nil {
+		if c.status != CL_TERMINAL {
+			c.status = CL_CLOSED
+		}
+		Info("WebClient.Close: %s", c.addr)
+		_ = conn.Close()
+		c.setConn(nil)
+		c.private = nil
+		select {
+		case <-c.done:
+		default:
+			close(c.done)
+		}
+		c.lock.Unlock()
+		if c.listener.OnClose != nil {
+			_ = c.listener.OnClose(c)
+		}
+	} else {
+		c.lock.Unlock()
+	}
+}
+
+func (c *WebClient) Terminal() {
+	c.SetStatus(CL_TERMINAL)
+	c.Close()
+}
+
+func (c *WebClient) SetStatus(v uint8) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.status != v {
+		if c.listener.OnStatus != nil {
+			c.listener.OnStatus(c, c.status, v)
+		}
+		c.status = v
+	}
+}
@@ -0,0 +1,51 @@
+package libol
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestWebClientAndServer(t *testing.T) {
+	server := NewWebServer("127.0.0.1:0", nil)
+	addr := server.getListener().Addr().String()
+	frames := make(chan string, 8)
+	accepted := make(chan SocketClient, 1)
+	go server.Accept()
+	go server.Loop(ServerListener{
+		OnClient: func(client SocketClient) error {
+			client.SetStatus(CL_CONNECTED)
+			accepted <- client
+			return nil
+		},
+		ReadAt: func(client SocketClient, p []byte) error {
+			frames <- string(p)
+			return client.WriteMsg(p)
+		},
+	})
+
+	client := NewWebClient(addr, nil)
+	assert.Nil(t, client.Connect(), "connect.")
+	frame := "hello openlan frame"
+	assert.Nil(t, client.WriteMsg([]byte(frame)), "write.")
+
+	select {
+	case data := <-frames:
+		assert.Equal(t, frame, data, "be the same.")
+	case <-time.After(3 * time.Second):
+		t.Fatal("server not received.")
+	}
+	data := make([]byte, MAXBUF)
+	n, err := client.ReadMsg(data)
+	assert.Nil(t, err, "read.")
+	assert.Equal(t, frame, string(data[:n]), "be the same.")
+
+	// accepted client never dials after closed.
+	s := <-accepted
+	s.Close()
+	assert.NotNil(t, s.WriteMsg([]byte(frame)), "write after closed.")
+	assert.Equal(t, "", s.(*WebClient).Url(), "no url.")
+
+	client.Close()
+	server.Close()
+}
@@ -1,8 +1,10 @@
 package config
 
 import (
+	"crypto/tls"
 	"fmt"
 	"github.com/danieldin95/openlan-go/libol"
+	"net"
 	"os"
 	"strings"
 )
@@ -17,6 +19,247 @@ type Http struct {
 	Public string `json:"public,omitempty" yaml:"public,omitempty"`
 }
 
+type Crypt struct {
+	Algo   string `json:"algo,omitempty" yaml:"algo,omitempty"` // aes-gcm.
+	Secret string `json:"secret,omitempty" yaml:"secret,omitempty"`
+}
+
+type Heartbeat struct {
+	Interval int `json:"interval,omitempty" yaml:"interval,omitempty"` // seconds.
+	Missed   int `json:"missed,omitempty" yaml:"missed,omitempty"`     // close after missed pings.
+}
+
+func (h *Heartbeat) Right() {
+	if h.Interval == 0 {
+		h.Interval = 10
+	}
+	if h.Missed == 0 {
+		h.Missed = 3
+	}
+}
+
+type Queue struct {
+	Length  int    `json:"length,omitempty" yaml:"length,omitempty"`   // frames.
+	Policy  string `json:"policy,omitempty" yaml:"policy,omitempty"`   // tail-drop, head-drop or disconnect.
+	Timeout int    `json:"timeout,omitempty" yaml:"timeout,omitempty"` // seconds blocked before disconnect.
+}
+
+func (q *Queue) Right() {
+	if q.Length == 0 {
+		q.Length = 1024
+	}
+	if q.Policy == "" {
+		q.Policy = libol.QUEUE_TAILDROP
+	}
+	if q.Timeout == 0 {
+		q.Timeout = 5
+	}
+}
+
+type Backoff struct {
+	Interval int `json:"interval,omitempty" yaml:"interval,omitempty"` // seconds after the first retry.
+	Max      int `json:"max,omitempty" yaml:"max,omitempty"`           // seconds.
+}
+
+func (b *Backoff) Right() {
+	if b.Interval == 0 {
+		b.Interval = 1
+	}
+	if b.Max == 0 {
+		b.Max = 60
+	}
+}
+
+type Endpoint struct {
+	Addr     string `json:"connection" yaml:"connection"`
+	Protocol string `json:"protocol,omitempty" yaml:"protocol,omitempty"` // same as point if empty.
+	Weight   int    `json:"weight,omitempty" yaml:"weight,omitempty"`
+	Local    string `json:"local,omitempty" yaml:"local,omitempty"` // address to bind for tcp and tls.
+}
+
+type Bond struct {
+	Mode     string     `json:"mode,omitempty" yaml:"mode,omitempty"` // active-backup, round-robin or lowest-rtt.
+	Sequence bool       `json:"sequence,omitempty" yaml:"sequence,omitempty"`
+	Paths    []Endpoint `json:"paths" yaml:"paths"` // more sessions, and connection is the same as point if empty.
+}
+
+func (b *Bond) Right() {
+	if b.Mode == "" {
+		b.Mode = "active-backup"
+	}
+}
+
+type Failover struct {
+	Mode     string `json:"mode,omitempty" yaml:"mode,omitempty"`         // ordered or weighted.
+	Probe    int    `json:"probe,omitempty" yaml:"probe,omitempty"`       // seconds between probes.
+	HoldDown int    `json:"holddown,omitempty" yaml:"holddown,omitempty"` // seconds preferred stable before fail back.
+}
+
+func (f *Failover) Right() {
+	if f.Mode == "" {
+		f.Mode = "ordered"
+	}
+	if f.Probe == 0 {
+		f.Probe = 10
+	}
+	if f.HoldDown == 0 {
+		f.HoldDown = 60
+	}
+}
+
+type Proxy struct {
+	Url      string `json:"url,omitempty" yaml:"url,omitempty"` // http://host:3128 or socks5://host:1080, and none if empty.
+	Username string `json:"username,omitempty" yaml:"username,omitempty"`
+	Password string `json:"password,omitempty" yaml:"password,omitempty"`
+}
+
+// NewProxy returns proxy from HTTPS_PROXY or ALL_PROXY if not configured,
+// and an error if the url is invalid.
+func NewProxy(c *Proxy) (*libol.Proxy, error) {
+	if c == nil {
+		return libol.ProxyFromEnv(), nil
+	}
+	if c.Url == "" {
+		return nil, nil
+	}
+	p, err := libol.NewProxy(c.Url)
+	if err != nil {
+		return nil, err
+	}
+	if c.Username != "" {
+		p.Username = c.Username
+		p.Password = c.Password
+	}
+	return p, nil
+}
+
+type Cert struct {
+	Dir        string `json:"dir"`
+	CrtFile    string `json:"crt" yaml:"crt"`
+	KeyFile    string `json:"key" yaml:"key"`
+	CaFile     string `json:"ca,omitempty" yaml:"ca,omitempty"`                 // bundle to verify peer.
+	ServerName string `json:"serverName,omitempty" yaml:"serverName,omitempty"` // verified by point, and host of connection if empty.
+	ClientAuth string `json:"clientAuth,omitempty" yaml:"clientAuth,omitempty"` // optional or require by switch if has ca.
+}
+
+func (c *Cert) Right() {
+	if c.Dir == "" {
+		return
+	}
+	c.CrtFile = fmt.Sprintf("%s/crt.pem", c.Dir)
+	c.KeyFile = fmt.Sprintf("%s/private.key", c.Dir)
+	if c.CaFile == "" {
+		caFile := fmt.Sprintf("%s/ca.pem", c.Dir)
+		if _, err := os.Stat(caFile); err == nil {
+			c.CaFile = caFile
+		}
+	}
+}
+
+// ServerTls returns nil if not key pair, and verifies certificate of
+// client if ca configured.
+func (c *Cert) ServerTls() (*tls.Config, error) {
+	if c.KeyFile == "" || c.CrtFile == "" {
+		return nil, nil
+	}
+	cer, err := tls.LoadX509KeyPair(c.CrtFile, c.KeyFile)
+	if err != nil {
+		return nil, err
+	}
+	conf := &tls.Config{Certificates: []tls.Certificate{cer}}
+	if c.CaFile != "" {
+		pool, err := libol.NewCertPool(c.CaFile)
+		if err != nil {
+			return nil, err
+		}
+		conf.ClientCAs = pool
+		conf.ClientAuth = tls.VerifyClientCertIfGiven
+		if c.ClientAuth == "require" {
+			conf.ClientAuth = tls.RequireAndVerifyClientCert
+		}
+	}
+	return conf, nil
+}
+
+// ClientTls verifies the switch by ca, or by system if no ca, and sends
+// the certificate of key pair if configured. It returns an error if the
+// ca or key pair configured is not loaded, and never falls back to system.
+// The key pair is optional in dir, since the point may save ca only.
+func (c *Cert) ClientTls(addr string) (*tls.Config, error) {
+	conf := &tls.Config{ServerName: c.ServerName}
+	if conf.ServerName == "" {
+		conf.ServerName, _, _ = net.SplitHostPort(addr)
+	}
+	if c.CaFile != "" {
+		pool, err := libol.NewCertPool(c.CaFile)
+		if err != nil {
+			return nil, err
+		}
+		conf.RootCAs = pool
+	}
+	if c.Dir != "" {
+		_, crtErr := os.Stat(c.CrtFile)
+		_, keyErr := os.Stat(c.KeyFile)
+		if os.IsNotExist(crtErr) && os.IsNotExist(keyErr) {
+			return conf, nil
+		}
+	}
+	if c.KeyFile != "" && c.CrtFile != "" {
+		cer, err := tls.LoadX509KeyPair(c.CrtFile, c.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		conf.Certificates = []tls.Certificate{cer}
+	}
+	return conf, nil
+}
+
+type Kcp struct {
+	Cipher       string `json:"cipher,omitempty" yaml:"cipher,omitempty"` // aes, salsa20 and none etc.
+	Key          string `json:"key,omitempty" yaml:"key,omitempty"`
+	DataShards   int    `json:"data-shards,omitempty" yaml:"data-shards,omitempty"`
+	ParityShards int    `json:"parity-shards,omitempty" yaml:"parity-shards,omitempty"`
+	NoDelay      int    `json:"nodelay,omitempty" yaml:"nodelay,omitempty"`
+	Interval     int    `json:"interval,omitempty" yaml:"interval,omitempty"`
+	Resend       int    `json:"resend,omitempty" yaml:"resend,omitempty"`
+	NoCongestion int    `json:"nc,omitempty" yaml:"nc,omitempty"`
+	SndWnd       int    `json:"sndwnd,omitempty" yaml:"sndwnd,omitempty"`
+	RcvWnd       int    `json:"rcvwnd,omitempty" yaml:"rcvwnd,omitempty"`
+	Mtu          int    `json:"mtu,omitempty" yaml:"mtu,omitempty"`
+}
+
+// NewKcpConfig returns the kcp config for protocol kcp or kcp+tcpraw, and
+// an error if the cipher or key is invalid.
+func NewKcpConfig(protocol string, k *Kcp) (*libol.KcpConfig, error) {
+	if k == nil {
+		k = &Kcp{}
+	}
+	block, err := libol.NewKcpBlock(k.Cipher, k.Key)
+	if err != nil {
+		return nil, err
+	}
+	c := &libol.KcpConfig{
+		Block:        block,
+		DataShards:   k.DataShards,
+		ParityShards: k.ParityShards,
+		NoDelay:      k.NoDelay,
+		Interval:     k.Interval,
+		Resend:       k.Resend,
+		NoCongestion: k.NoCongestion,
+		SndWnd:       k.SndWnd,
+		RcvWnd:       k.RcvWnd,
+		Mtu:          k.Mtu,
+		TcpRaw:       protocol == "kcp+tcpraw",
+	}
+	if c.DataShards == 0 {
+		c.DataShards = 1024
+	}
+	if c.ParityShards == 0 {
+		c.ParityShards = 3
+	}
+	return c, nil
+}
+
 func RightAddr(listen *string, port int) {
 	values := strings.Split(*listen, ":")
 	if len(values) == 1 {
@@ -0,0 +1,121 @@
+package config
+
+import (
+	"github.com/danieldin95/openlan-go/libol"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestNewKcpConfig(t *testing.T) {
+	c, err := NewKcpConfig("kcp", nil)
+	assert.Nil(t, err, "default.")
+	assert.Nil(t, c.Block, "no cipher.")
+	assert.Equal(t, 1024, c.DataShards, "default data shards.")
+	assert.Equal(t, 3, c.ParityShards, "default parity shards.")
+	assert.False(t, c.TcpRaw, "kcp.")
+
+	k := &Kcp{
+		Cipher:       "aes",
+		Key:          "secret",
+		DataShards:   10,
+		ParityShards: 2,
+		NoDelay:      1,
+		Interval:     20,
+		Resend:       2,
+		NoCongestion: 1,
+		SndWnd:       512,
+		RcvWnd:       1024,
+		Mtu:          1350,
+	}
+	c, err = NewKcpConfig("kcp+tcpraw", k)
+	assert.Nil(t, err, "aes.")
+	assert.NotNil(t, c.Block, "aes.")
+	assert.Equal(t, 10, c.DataShards, "data shards.")
+	assert.Equal(t, 2, c.ParityShards, "parity shards.")
+	assert.Equal(t, 1, c.NoDelay, "nodelay.")
+	assert.Equal(t, 20, c.Interval, "interval.")
+	assert.Equal(t, 2, c.Resend, "resend.")
+	assert.Equal(t, 1, c.NoCongestion, "nc.")
+	assert.Equal(t, 512, c.SndWnd, "sndwnd.")
+	assert.Equal(t, 1024, c.RcvWnd, "rcvwnd.")
+	assert.Equal(t, 1350, c.Mtu, "mtu.")
+	assert.True(t, c.TcpRaw, "tcpraw.")
+
+	c, err = NewKcpConfig("kcp", &Kcp{Cipher: "unknown"})
+	assert.NotNil(t, err, "unknown cipher.")
+	assert.Nil(t, c, "refused.")
+
+	p := &Point{Kcp: &Kcp{Cipher: "unknown"}}
+	assert.NotNil(t, p.Validate(), "invalid point.")
+}
+
+func TestNewProxy(t *testing.T) {
+	p, err := NewProxy(&Proxy{Url: "http://127.0.0.1:3128", Username: "hi"})
+	assert.Nil(t, err, "http.")
+	assert.Equal(t, "hi", p.Username, "username.")
+
+	p, err = NewProxy(&Proxy{Url: "ftp://127.0.0.1:21"})
+	assert.NotNil(t, err, "invalid.")
+	assert.Nil(t, p, "refused.")
+
+	c := &Point{Proxy: &Proxy{Url: "ftp://127.0.0.1:21"}}
+	assert.NotNil(t, c.Validate(), "invalid point.")
+}
+
+func TestCertClientTls(t *testing.T) {
+	c := &Cert{}
+	conf, err := c.ClientTls("switch.openlan.net:10002")
+	assert.Nil(t, err, "system.")
+	assert.Nil(t, conf.RootCAs, "system roots.")
+	assert.Equal(t, "switch.openlan.net", conf.ServerName, "server name.")
+
+	c = &Cert{CaFile: "/not/existed/ca.pem"}
+	conf, err = c.ClientTls("switch.openlan.net:10002")
+	assert.NotNil(t, err, "ca not loaded.")
+	assert.Nil(t, conf, "no fallback.")
+
+	p := &Point{Cert: c}
+	assert.NotNil(t, p.Validate(), "invalid point.")
+
+	c = &Cert{CrtFile: "/not/existed/crt.pem", KeyFile: "/not/existed/private.key"}
+	conf, err = c.ClientTls("switch.openlan.net:10002")
+	assert.NotNil(t, err, "key pair not loaded.")
+	assert.Nil(t, conf, "not sent.")
+
+	c = &Cert{Dir: "/not/existed"}
+	c.Right()
+	conf, err = c.ClientTls("switch.openlan.net:10002")
+	assert.Nil(t, err, "key pair optional in dir.")
+	assert.Nil(t, conf.Certificates, "not sent.")
+}
+
+func TestSwitchDelNetwork(t *testing.T) {
+	dir, err := ioutil.TempDir("", "switch")
+	assert.Nil(t, err, "temp dir.")
+	defer os.RemoveAll(dir)
+
+	c := &Switch{SaveFile: filepath.Join(dir, "switch.json")}
+	assert.Nil(t, c.DelNetwork("example"), "not existed.")
+
+	data := `{"alias": "hi", "unknown": {"a": 1}, "network": [{"name": "example"}, {"name": "other", "unknown": 2}]}`
+	assert.Nil(t, ioutil.WriteFile(c.SaveFile, []byte(data), 0600), "write.")
+	stat, _ := os.Stat(c.SaveFile)
+	assert.Nil(t, c.DelNetwork("not-existed"), "not changed.")
+	after, _ := os.Stat(c.SaveFile)
+	assert.Equal(t, stat.ModTime(), after.ModTime(), "not written.")
+
+	assert.Nil(t, c.DelNetwork("example"), "deleted.")
+	saved := make(map[string]interface{})
+	assert.Nil(t, libol.UnmarshalLoad(&saved, c.SaveFile), "load.")
+	assert.Equal(t, "hi", saved["alias"], "kept.")
+	assert.Equal(t, map[string]interface{}{"a": float64(1)}, saved["unknown"], "unknown kept.")
+	nets := saved["network"].([]interface{})
+	assert.Equal(t, 1, len(nets), "deleted.")
+	assert.Equal(t, map[string]interface{}{"name": "other", "unknown": float64(2)}, nets[0], "unknown kept.")
+
+	assert.Nil(t, ioutil.WriteFile(c.SaveFile, []byte("{"), 0600), "write.")
+	assert.NotNil(t, c.DelNetwork("example"), "broken.")
+}
@@ -15,23 +15,35 @@ type Interface struct {
 }
 
 type Point struct {
-	Alias    string    `json:"name,omitempty" yaml:"name,omitempty"`
-	Network  string    `json:"network,omitempty" yaml:"network,omitempty"`
-	Addr     string    `json:"connection" yaml:"connection"`
-	Username string    `json:"username,omitempty" yaml:"username,omitempty"`
-	Password string    `json:"password,omitempty" yaml:"password,omitempty"`
-	Protocol string    `json:"protocol,omitempty" yaml:"protocol,omitempty"`
-	If       Interface `json:"interface" yaml:"interface"`
-	Log      Log       `json:"log" yaml:"log"`
-	Http     *Http     `json:"http,omitempty" yaml:"http,omitempty"`
-	Allowed  bool      `json:"-" yaml:"-"`
-	SaveFile string    `json:"-" yaml:"-"`
+	Alias     string     `json:"name,omitempty" yaml:"name,omitempty"`
+	Network   string     `json:"network,omitempty" yaml:"network,omitempty"`
+	Addr      string     `json:"connection" yaml:"connection"`
+	Endpoints []Endpoint `json:"endpoints,omitempty" yaml:"endpoints,omitempty"` // to fail over, and Addr is used if empty.
+	Failover  *Failover  `json:"failover,omitempty" yaml:"failover,omitempty"`
+	Bond      *Bond      `json:"bond,omitempty" yaml:"bond,omitempty"`         // bind more sessions to one point.
+	Proxy     *Proxy     `json:"proxy,omitempty" yaml:"proxy,omitempty"`       // for tcp, tls, ws and wss.
+	Cert      *Cert      `json:"cert,omitempty" yaml:"cert,omitempty"`         // verify switch, and by system if nil.
+	Insecure  bool       `json:"insecure,omitempty" yaml:"insecure,omitempty"` // not verify switch if no cert.
+	Username  string     `json:"username,omitempty" yaml:"username,omitempty"`
+	Password  string     `json:"password,omitempty" yaml:"password,omitempty"`
+	Protocol  string     `json:"protocol,omitempty" yaml:"protocol,omitempty"`
+	Kcp       *Kcp       `json:"kcp,omitempty" yaml:"kcp,omitempty"`
+	Mux       bool       `json:"mux,omitempty" yaml:"mux,omitempty"` // share one connection with other points to same switch.
+	Crypt     *Crypt     `json:"crypt,omitempty" yaml:"crypt,omitempty"`
+	Compress  string     `json:"compress,omitempty" yaml:"compress,omitempty"` // snappy.
+	Heartbeat *Heartbeat `json:"heartbeat,omitempty" yaml:"heartbeat,omitempty"`
+	Backoff   *Backoff   `json:"backoff,omitempty" yaml:"backoff,omitempty"` // of reconnecting.
+	If        Interface  `json:"interface" yaml:"interface"`
+	Log       Log        `json:"log" yaml:"log"`
+	Http      *Http      `json:"http,omitempty" yaml:"http,omitempty"`
+	Allowed   bool       `json:"-" yaml:"-"`
+	SaveFile  string     `json:"-" yaml:"-"`
 }
 
 var pointDef = Point{
 	Alias:    "",
 	Addr:     "openlan.net",
-	Protocol: "tls", // tcp, tls, ws and wss etc.
+	Protocol: "tls", // tcp, tls, kcp, kcp+tcpraw, udp, ws and wss etc.
 	Log: Log{
 		File:    "./point.log",
 		Verbose: libol.INFO,
@@ -83,6 +95,29 @@ func (c *Point) Right() {
 		c.Alias = GetAlias()
 	}
 	RightAddr(&c.Addr, 10002)
+	if c.Cert != nil {
+		c.Cert.Right()
+	}
+	for i := range c.Endpoints {
+		ep := &c.Endpoints[i]
+		RightAddr(&ep.Addr, 10002)
+		if ep.Protocol == "" {
+			ep.Protocol = c.Protocol
+		}
+	}
+	if c.Bond != nil {
+		c.Bond.Right()
+		for i := range c.Bond.Paths {
+			ep := &c.Bond.Paths[i]
+			if ep.Addr == "" {
+				ep.Addr = c.Addr
+			}
+			RightAddr(&ep.Addr, 10002)
+			if ep.Protocol == "" {
+				ep.Protocol = c.Protocol
+			}
+		}
+	}
 	if runtime.GOOS == "darwin" {
 		c.If.Provider = "tun"
 	}
@@ -98,6 +133,74 @@ func (c *Point) Default() {
 	if c.If.Mtu == 0 {
 		c.If.Mtu = pointDef.If.Mtu
 	}
+	if c.If.Mtu > libol.MAXFRAME {
+		libol.Warn("Point.Default: mtu %d clamped to %d", c.If.Mtu, libol.MAXFRAME)
+		c.If.Mtu = libol.MAXFRAME
+	}
+	if c.Heartbeat == nil {
+		c.Heartbeat = &Heartbeat{}
+	}
+	c.Heartbeat.Right()
+	if c.Backoff == nil {
+		c.Backoff = &Backoff{}
+	}
+	c.Backoff.Right()
+	if c.Failover == nil {
+		c.Failover = &Failover{}
+	}
+	c.Failover.Right()
+}
+
+// Validate returns an error if the point should not connect by this
+// config.
+func (c *Point) Validate() error {
+	for _, protocol := range c.protocols() {
+		switch protocol {
+		case "", "tcp", "tls", "kcp", "kcp+tcpraw", "udp", "ws", "wss":
+		default:
+			return libol.NewErr("protocol %s not supported", protocol)
+		}
+	}
+	if c.Crypt != nil && c.Crypt.Algo != "" && c.Crypt.Algo != libol.CRYPT_AESGCM {
+		return libol.NewErr("crypt %s not supported", c.Crypt.Algo)
+	}
+	if c.Kcp != nil {
+		if _, err := libol.NewKcpBlock(c.Kcp.Cipher, c.Kcp.Key); err != nil {
+			return libol.NewErr("kcp %s", err)
+		}
+	}
+	if c.Cert != nil {
+		if _, err := c.Cert.ClientTls(c.Addr); err != nil {
+			return libol.NewErr("cert %s", err)
+		}
+	}
+	if c.Proxy != nil {
+		if _, err := NewProxy(c.Proxy); err != nil {
+			return libol.NewErr("proxy %s", err)
+		}
+	}
+	if c.Mux {
+		for _, protocol := range c.protocols() {
+			if protocol == "udp" || protocol == "ws" || protocol == "wss" {
+				libol.Warn("Point.Validate: mux not supported by %s, and ignored", protocol)
+			}
+		}
+	}
+	return nil
+}
+
+// protocols returns all protocols of endpoints and bond paths.
+func (c *Point) protocols() []string {
+	protocols := []string{c.Protocol}
+	for _, ep := range c.Endpoints {
+		protocols = append(protocols, ep.Protocol)
+	}
+	if c.Bond != nil {
+		for _, ep := range c.Bond.Paths {
+			protocols = append(protocols, ep.Protocol)
+		}
+	}
+	return protocols
 }
 
 func (c *Point) Load() error {
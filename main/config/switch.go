@@ -1,9 +1,11 @@
 package config
 
 import (
+	"encoding/json"
 	"flag"
 	"fmt"
 	"github.com/danieldin95/openlan-go/libol"
+	"os"
 	"path/filepath"
 )
 
@@ -15,9 +17,20 @@ type Bridge struct {
 }
 
 type IpSubnet struct {
-	Start   string `json:"start"`
-	End     string `json:"end"`
-	Netmask string `json:"netmask"`
+	Start     string        `json:"start"`
+	End       string        `json:"end"`
+	Netmask   string        `json:"netmask"`
+	LeaseTime int           `json:"leaseTime,omitempty" yaml:"leaseTime,omitempty"` // seconds.
+	Grace     int           `json:"grace,omitempty" yaml:"grace,omitempty"`         // seconds kept after point closed, and freed at once if negative.
+	Exclude   []string      `json:"exclude,omitempty" yaml:"exclude,omitempty"`     // address, or range likes 10.0.0.1-10.0.0.9.
+	Reserved  []Reservation `json:"reserved,omitempty" yaml:"reserved,omitempty"`
+}
+
+// Reservation is the static address of point by uuid or username.
+type Reservation struct {
+	UUID     string `json:"uuid,omitempty" yaml:"uuid,omitempty"`
+	Username string `json:"username,omitempty" yaml:"username,omitempty"`
+	Address  string `json:"address"`
 }
 
 type PrefixRoute struct {
@@ -38,6 +51,9 @@ type Network struct {
 	Routes   []PrefixRoute `json:"routes"`
 	Subnet   IpSubnet      `json:"subnet"`
 	Password []Password    `json:"password"`
+	Crypt    *Crypt        `json:"crypt,omitempty"`
+	Compress string        `json:"compress,omitempty"` // accepted compression, snappy.
+	File     string        `json:"-" yaml:"-"`
 }
 
 func (n *Network) Right() {
@@ -50,12 +66,38 @@ func (n *Network) Right() {
 	if n.Bridge.Mtu == 0 {
 		n.Bridge.Mtu = 1518
 	}
+	if n.Bridge.Mtu > libol.MAXFRAME {
+		libol.Warn("Network.Right: mtu %d clamped to %d", n.Bridge.Mtu, libol.MAXFRAME)
+		n.Bridge.Mtu = libol.MAXFRAME
+	}
+	if n.Subnet.LeaseTime == 0 {
+		n.Subnet.LeaseTime = 86400
+	}
+	if n.Subnet.Grace == 0 {
+		n.Subnet.Grace = 300
+	}
 }
 
-type Cert struct {
-	Dir     string `json:"dir"`
-	CrtFile string `json:"crt" yaml:"crt"`
-	KeyFile string `json:"key" yaml:"key"`
+// Save writes the network to its file.
+func (n *Network) Save() error {
+	if n.File == "" {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(n.File), 0700); err != nil {
+		return err
+	}
+	return libol.MarshalSave(n, n.File, true)
+}
+
+// Remove deletes the file of network if existed.
+func (n *Network) Remove() error {
+	if n.File == "" {
+		return nil
+	}
+	if err := os.Remove(n.File); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
 }
 
 type FlowRules struct {
@@ -71,10 +113,52 @@ type FlowRules struct {
 	Jump     string `json:"jump"` // SNAT/RETURN/MASQUERADE
 }
 
+// Listener accepts points by protocol on the address, and only the
+// networks are allowed to login if not empty.
+type Listener struct {
+	Protocol      string         `json:"protocol"` // tcp/tls/kcp/kcp+tcpraw/udp/ws/wss.
+	Listen        string         `json:"listen"`
+	Path          string         `json:"path,omitempty" yaml:"path,omitempty"` // for ws and wss, and unique in switch.
+	Cert          *Cert          `json:"cert,omitempty" yaml:"cert,omitempty"` // same as switch if nil.
+	Networks      []string       `json:"networks,omitempty" yaml:"networks,omitempty"`
+	Allow         []string       `json:"allow,omitempty" yaml:"allow,omitempty"` // CIDRs of source, and any if empty.
+	Deny          []string       `json:"deny,omitempty" yaml:"deny,omitempty"`
+	ProxyProtocol *ProxyProtocol `json:"proxyProtocol,omitempty" yaml:"proxyProtocol,omitempty"` // for tcp and tls.
+}
+
+// ProxyProtocol accepts PROXY header v1 or v2 from load balancer.
+type ProxyProtocol struct {
+	Trusted []string `json:"trusted" yaml:"trusted"` // CIDRs of balancer, and required.
+}
+
+// Limit is shared by all listeners, and zero is unlimited.
+type Limit struct {
+	MaxClient    int `json:"maxClient,omitempty" yaml:"maxClient,omitempty"`
+	MaxPerSource int `json:"maxPerSource,omitempty" yaml:"maxPerSource,omitempty"`
+	Rate         int `json:"rate,omitempty" yaml:"rate,omitempty"` // new connections per second.
+	Burst        int `json:"burst,omitempty" yaml:"burst,omitempty"`
+	MaxFailed    int `json:"maxFailed,omitempty" yaml:"maxFailed,omitempty"` // login failed before banned.
+	BanTime      int `json:"banTime,omitempty" yaml:"banTime,omitempty"`     // seconds.
+}
+
+func (l *Limit) Right() {
+	if l.MaxFailed == 0 {
+		l.MaxFailed = 5
+	}
+	if l.BanTime == 0 {
+		l.BanTime = 300
+	}
+}
+
 type Switch struct {
 	Alias     string      `json:"alias"`
-	Protocol  string      `json:"protocol"` // tcp/tls/kcp.
+	Protocol  string      `json:"protocol"` // tcp/tls/kcp/kcp+tcpraw/udp/ws/wss.
 	Listen    string      `json:"listen"`
+	Listeners []Listener  `json:"listeners,omitempty" yaml:"listeners,omitempty"` // by protocol and listen if empty.
+	Kcp       *Kcp        `json:"kcp,omitempty" yaml:"kcp,omitempty"`
+	Heartbeat *Heartbeat  `json:"heartbeat,omitempty" yaml:"heartbeat,omitempty"`
+	Queue     *Queue      `json:"queue,omitempty" yaml:"queue,omitempty"` // to send to point.
+	Limit     *Limit      `json:"limit,omitempty" yaml:"limit,omitempty"`
 	Http      *Http       `json:"http,omitempty" yaml:"http,omitempty"`
 	Log       Log         `json:"log" yaml:"log"`
 	Cert      Cert        `json:"cert"`
@@ -83,6 +167,7 @@ type Switch struct {
 	ConfDir   string      `json:"-" yaml:"-"`
 	TokenFile string      `json:"-" yaml:"-"`
 	SaveFile  string      `json:"-" yaml:"-"`
+	StateDir  string      `json:"-" yaml:"-"` // users and leases saved.
 }
 
 var vSwitchDef = Switch{
@@ -117,15 +202,23 @@ func (c *Switch) Right() {
 		c.Alias = GetAlias()
 	}
 	RightAddr(&c.Listen, 10002)
+	for i := range c.Listeners {
+		l := &c.Listeners[i]
+		RightAddr(&l.Listen, 10002)
+		if l.Protocol == "" {
+			l.Protocol = "tcp"
+		}
+		if l.Cert != nil {
+			l.Cert.Right()
+		}
+	}
 	if c.Http != nil {
 		RightAddr(&c.Http.Listen, 10000)
 	}
 	c.TokenFile = fmt.Sprintf("%s/token", c.ConfDir)
+	c.StateDir = fmt.Sprintf("%s/state", c.ConfDir)
 	c.SaveFile = fmt.Sprintf("%s/switch.json", c.ConfDir)
-	if c.Cert.Dir != "" {
-		c.Cert.CrtFile = fmt.Sprintf("%s/crt.pem", c.Cert.Dir)
-		c.Cert.KeyFile = fmt.Sprintf("%s/private.key", c.Cert.Dir)
-	}
+	c.Cert.Right()
 }
 
 func (c *Switch) Default() {
@@ -133,6 +226,32 @@ func (c *Switch) Default() {
 	if c.Network == nil {
 		c.Network = make([]*Network, 0, 32)
 	}
+	if len(c.Listeners) == 0 {
+		protocol := c.Protocol
+		if protocol == "" {
+			protocol = "tcp"
+		}
+		// tcp is over tls if has certificate as before.
+		if protocol == "tcp" && c.Cert.KeyFile != "" {
+			protocol = "tls"
+		}
+		c.Listeners = append(c.Listeners, Listener{
+			Protocol: protocol,
+			Listen:   c.Listen,
+		})
+	}
+	if c.Heartbeat == nil {
+		c.Heartbeat = &Heartbeat{}
+	}
+	c.Heartbeat.Right()
+	if c.Queue == nil {
+		c.Queue = &Queue{}
+	}
+	c.Queue.Right()
+	if c.Limit == nil {
+		c.Limit = &Limit{}
+	}
+	c.Limit.Right()
 
 	files, err := filepath.Glob(c.ConfDir + "/network/*.json")
 	if err != nil {
@@ -141,14 +260,18 @@ func (c *Switch) Default() {
 	for _, k := range files {
 		n := &Network{
 			Alias: c.Alias,
+			File:  k,
 		}
 		if err := libol.UnmarshalLoad(n, k); err != nil {
 			libol.Error("Switch.Default %s", err)
 			continue
 		}
-		c.Network = append(c.Network, n)
+		c.addNetwork(n)
 	}
 	for _, n := range c.Network {
+		if n.File == "" {
+			n.File = fmt.Sprintf("%s/network/%s.json", c.ConfDir, n.Name)
+		}
 		for _, link := range n.Links {
 			link.Default()
 		}
@@ -157,10 +280,87 @@ func (c *Switch) Default() {
 	}
 }
 
+// addNetwork replaces the network of same name, so the file saved at
+// runtime has priority over switch.json.
+func (c *Switch) addNetwork(n *Network) {
+	for i, o := range c.Network {
+		if o.Name == n.Name {
+			libol.Info("Switch.addNetwork %s from %s", n.Name, n.File)
+			c.Network[i] = n
+			return
+		}
+	}
+	c.Network = append(c.Network, n)
+}
+
 func (c *Switch) Load() error {
 	return libol.UnmarshalLoad(c, c.SaveFile)
 }
 
+// Reload reads the configuration again from the directory, and returns
+// error if any file is invalid. The log is not reloaded.
+func (c *Switch) Reload() (*Switch, error) {
+	n := &Switch{
+		ConfDir:  c.ConfDir,
+		SaveFile: c.SaveFile,
+	}
+	if _, err := os.Stat(n.SaveFile); err == nil {
+		if err := n.Load(); err != nil {
+			return nil, err
+		}
+	}
+	files, err := filepath.Glob(c.ConfDir + "/network/*.json")
+	if err != nil {
+		return nil, err
+	}
+	for _, k := range files {
+		if err := libol.UnmarshalLoad(&Network{}, k); err != nil {
+			return nil, err
+		}
+	}
+	n.Log = c.Log
+	n.Default()
+	return n, nil
+}
+
+// DelNetwork removes the network in switch.json, so that it is not loaded
+// again after restart. The file is written only if has the network, and
+// the other fields are kept as they are.
+func (c *Switch) DelNetwork(name string) error {
+	if _, err := os.Stat(c.SaveFile); os.IsNotExist(err) {
+		return nil
+	}
+	saved := make(map[string]json.RawMessage, 32)
+	if err := libol.UnmarshalLoad(&saved, c.SaveFile); err != nil {
+		return err
+	}
+	nets := make([]json.RawMessage, 0, 32)
+	if data, ok := saved["network"]; ok {
+		if err := json.Unmarshal(data, &nets); err != nil {
+			return err
+		}
+	}
+	kept := make([]json.RawMessage, 0, len(nets))
+	for _, data := range nets {
+		n := struct {
+			Name string `json:"name"`
+		}{}
+		if err := json.Unmarshal(data, &n); err == nil && n.Name == name {
+			continue
+		}
+		kept = append(kept, data)
+	}
+	if len(kept) == len(nets) {
+		return nil
+	}
+	data, err := json.Marshal(kept)
+	if err != nil {
+		return err
+	}
+	saved["network"] = data
+	return libol.MarshalSave(saved, c.SaveFile, true)
+}
+
 func init() {
 	vSwitchDef.Right()
 }
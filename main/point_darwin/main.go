@@ -4,6 +4,7 @@ package main
 
 import (
 	"fmt"
+	"github.com/danieldin95/openlan-go/libol"
 	"github.com/danieldin95/openlan-go/main/config"
 	"github.com/danieldin95/openlan-go/point"
 	"os"
@@ -13,6 +14,10 @@ import (
 
 func main() {
 	c := config.NewPoint()
+	if err := c.Validate(); err != nil {
+		libol.Error("main: %s", err)
+		os.Exit(1)
+	}
 	p := point.NewPoint(c)
 	p.Start()
 
@@ -14,6 +14,10 @@ import (
 
 func main() {
 	c := config.NewPoint()
+	if err := c.Validate(); err != nil {
+		libol.Error("main: %s", err)
+		os.Exit(1)
+	}
 	p := point.NewPoint(c)
 	libol.PreNotify()
 	p.Start()
@@ -12,18 +12,28 @@ import (
 
 func main() {
 	c := config.NewSwitch()
-	vs := _switch.NewSwitch(c)
+	vs, err := _switch.NewSwitch(c)
+	if err != nil {
+		libol.Error("main: %s", err)
+		os.Exit(1)
+	}
 
 	libol.PreNotify()
 	_ = vs.Start()
 	libol.SdNotify()
-	x := make(chan os.Signal)
+	x := make(chan os.Signal, 1)
 	signal.Notify(x, os.Interrupt, syscall.SIGTERM)
 	signal.Notify(x, os.Interrupt, syscall.SIGKILL)
 	signal.Notify(x, os.Interrupt, syscall.SIGQUIT) //CTL+/
 	signal.Notify(x, os.Interrupt, syscall.SIGINT)  //CTL+C
+	signal.Notify(x, syscall.SIGHUP)                //reload
 
-	<-x
+	for s := range x {
+		if s != syscall.SIGHUP {
+			break
+		}
+		_ = vs.Reload()
+	}
 	_ = vs.Stop()
 	fmt.Println("Done!")
 }
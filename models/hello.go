@@ -0,0 +1,77 @@
+package models
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	HelloVersion    = 1 // version of control protocol.
+	HelloMinVersion = 1 // the lowest version accepted.
+)
+
+// Features in hello.
+const (
+	FeatCompress = "compress"
+	FeatCrypt    = "crypt"
+	FeatMux      = "mux"
+	FeatBeat     = "heartbeat"
+	FeatBond     = "bond"
+)
+
+// Hello is exchanged before login, and the switch replies with negotiated
+// version, features, maximum frame size and its heartbeat interval.
+type Hello struct {
+	Version  int      `json:"version"`
+	Features []string `json:"features"`
+	MaxSize  int      `json:"maxSize"`
+	Interval int      `json:"interval,omitempty"` // seconds to ping at least.
+}
+
+// NewHello returns the hello with features enabled by config.
+func NewHello(maxSize int, features ...string) *Hello {
+	return &Hello{
+		Version:  HelloVersion,
+		Features: features,
+		MaxSize:  maxSize,
+	}
+}
+
+func (h *Hello) Has(feature string) bool {
+	for _, f := range h.Features {
+		if f == feature {
+			return true
+		}
+	}
+	return false
+}
+
+// Negotiate returns the hello both supported, or error if the version
+// of peer is not accepted.
+func (h *Hello) Negotiate(peer *Hello) (*Hello, error) {
+	if peer.Version < HelloMinVersion {
+		return nil, fmt.Errorf("version %d not supported", peer.Version)
+	}
+	n := &Hello{
+		Version:  h.Version,
+		Features: make([]string, 0, len(h.Features)),
+		MaxSize:  h.MaxSize,
+		Interval: h.Interval,
+	}
+	if peer.Version < n.Version {
+		n.Version = peer.Version
+	}
+	if peer.MaxSize > 0 && peer.MaxSize < n.MaxSize {
+		n.MaxSize = peer.MaxSize
+	}
+	for _, f := range h.Features {
+		if peer.Has(f) {
+			n.Features = append(n.Features, f)
+		}
+	}
+	return n, nil
+}
+
+func (h *Hello) String() string {
+	return fmt.Sprintf("version %d, maxSize %d, features [%s]", h.Version, h.MaxSize, strings.Join(h.Features, " "))
+}
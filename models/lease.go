@@ -0,0 +1,20 @@
+package models
+
+// Lease is an address of network bound to a point by uuid, or to the user
+// by name likes user@network if reserved.
+type Lease struct {
+	UUID    string `json:"uuid"`
+	Network string `json:"network"`
+	Address string `json:"address"`
+	Type    string `json:"type"`             // dynamic or static.
+	Expire  int64  `json:"expire,omitempty"` // unix time, and never if zero.
+}
+
+const (
+	LeaseDynamic = "dynamic"
+	LeaseStatic  = "static"
+)
+
+func (l *Lease) Expired(now int64) bool {
+	return l.Expire > 0 && now >= l.Expire
+}
@@ -27,6 +27,21 @@ type Network struct {
 	IpEnd   string   `json:"ipEnd"`
 	Netmask string   `json:"netmask"`
 	Routes  []*Route `json:"routes"`
+	// not sent to point.
+	LeaseTime int64             `json:"-"` // seconds.
+	Grace     int64             `json:"-"` // seconds kept after point closed.
+	Exclude   []IpRange         `json:"-"`
+	Reserved  map[string]string `json:"-"` // address by uuid or user@network.
+}
+
+// IpRange is from start to end of ipv4 address included.
+type IpRange struct {
+	Start uint32
+	End   uint32
+}
+
+func (r IpRange) Contains(ip uint32) bool {
+	return ip >= r.Start && ip <= r.End
 }
 
 func NewNetwork(name string, ifAddr string) (this *Network) {
@@ -13,8 +13,11 @@ type Point struct {
 	Uptime  int64              `json:"uptime"`
 	Status  string             `json:"status"`
 	IfName  string             `json:"ifName"`
+	User    string             `json:"user,omitempty"`
 	Client  libol.SocketClient `json:"-"`
 	Device  network.Taper      `json:"-"`
+	Queue   *libol.SendQueue   `json:"-"`
+	Bond    *libol.Bond        `json:"-"`
 }
 
 func NewPoint(c libol.SocketClient, d network.Taper) (w *Point) {
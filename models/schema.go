@@ -8,31 +8,66 @@ import (
 
 func NewPointSchema(p *Point) schema.Point {
 	client, dev := p.Client, p.Device
-	return schema.Point{
+	sts := client.Sts()
+	rtt, jitter := client.Rtt()
+	point := schema.Point{
 		Uptime:  p.Uptime,
 		UUID:    p.UUID,
 		Alias:   p.Alias,
 		Address: client.Addr(),
+		Proxy:   client.ProxyAddr(),
 		Device:  dev.Name(),
-		RxBytes: client.Sts().RxOkay,
-		TxBytes: client.Sts().TxOkay,
-		ErrPkt:  client.Sts().TxError,
+		RxBytes: sts.RxOkay,
+		TxBytes: sts.TxOkay,
+		ErrPkt:  sts.TxError,
 		State:   client.State(),
 		Network: p.Network,
+		TxRatio: sts.TxRatio(),
+		RxRatio: sts.RxRatio(),
+		Rtt:     libol.Milliseconds(rtt),
+		Jitter:  libol.Milliseconds(jitter),
 	}
+	if q := p.Queue; q != nil {
+		point.QDepth = q.Depth()
+		point.QDrops = q.Drops()
+	}
+	point.Bond = NewBondSchema(p.Bond)
+	return point
+}
+
+func NewBondSchema(b *libol.Bond) *schema.Bond {
+	if b == nil {
+		return nil
+	}
+	bond := &schema.Bond{
+		Mode:     b.Mode(),
+		Sequence: b.Sequence(),
+	}
+	for _, client := range b.Clients() {
+		rtt, _ := client.Rtt()
+		bond.Paths = append(bond.Paths, schema.BondPath{
+			Address: client.Addr(),
+			State:   client.State(),
+			Rtt:     libol.Milliseconds(rtt),
+		})
+	}
+	return bond
 }
 
 func NewLinkSchema(p *Point) schema.Link {
 	client, dev := p.Client, p.Device
-	return schema.Link{
+	link := schema.Link{
 		UUID:    p.UUID,
 		Uptime:  client.UpTime(),
-		Device:  dev.Name(),
-		Address: client.Addr(),
+		Address: p.Server,
 		State:   client.State(),
 		IpAddr:  strings.Split(client.Addr(), ":")[0],
 		Network: p.Network,
 	}
+	if dev != nil { // not opened yet.
+		link.Device = dev.Name()
+	}
+	return link
 }
 
 func NewNeighborSchema(n *Neighbor) schema.Neighbor {
@@ -11,6 +11,31 @@ type User struct {
 	Token    string `json:"token"`
 	Password string `json:"password"`
 	UUID     string `json:"uuid"`
+	Crypt    *Crypt `json:"crypt,omitempty"`
+	Compress string `json:"compress,omitempty"`
+	Bond     *Bond  `json:"bond,omitempty"` // a path of the bonded point has same uuid.
+}
+
+// Accepted is replied with "okay." by switch in login, and the options
+// not accepted are empty.
+type Accepted struct {
+	Crypt    *Crypt `json:"crypt,omitempty"`
+	Compress string `json:"compress,omitempty"`
+	MaxSize  int    `json:"maxSize,omitempty"` // clamped by mtu of bridge.
+	Bond     *Bond  `json:"bond,omitempty"`
+}
+
+// Bond binds sessions with same uuid to one point, and frames are
+// prefixed by sequence if enabled.
+type Bond struct {
+	Mode     string `json:"mode"` // active-backup, round-robin or lowest-rtt.
+	Sequence bool   `json:"sequence,omitempty"`
+}
+
+// Crypt is negotiated in login, and the public key is X25519 by base64.
+type Crypt struct {
+	Algo   string `json:"algo"`
+	PubKey string `json:"pubkey"`
 }
 
 func NewUser(name string, password string) (this *User) {
@@ -47,6 +47,11 @@ func (b *LinuxBridge) Open(addr string) {
 	if err := brCtl.Stp(true); err != nil {
 		libol.Error("LinuxBridge.newBr.Stp: %s", err)
 	}
+	if b.mtu > ETHFRAME {
+		if err := netlink.LinkSetMTU(link, b.mtu-ETHHEAD); err != nil {
+			libol.Error("LinuxBridge.newBr.SetMtu: %s", err)
+		}
+	}
 	if err = netlink.LinkSetUp(link); err != nil {
 		libol.Error("LinuxBridge.newBr: %s", err)
 	}
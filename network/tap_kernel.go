@@ -133,4 +133,5 @@ func (t *KernelTap) Mtu() int {
 
 func (t *KernelTap) SetMtu(mtu int) {
 	t.mtu = mtu
+	SetLinkMtu(t.name, mtu)
 }
@@ -68,8 +68,13 @@ func (t *UserSpaceTap) InRead(p []byte) (n int, err error) {
 	}
 	t.lock.RUnlock()
 
-	t.readQ <- p
-	return len(p), nil
+	// not blocks bridge if the reader is slow.
+	select {
+	case t.readQ <- p:
+		return len(p), nil
+	default:
+		return 0, libol.NewErr("%s queue full", t)
+	}
 }
 
 func (t *UserSpaceTap) Write(p []byte) (n int, err error) {
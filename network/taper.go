@@ -2,9 +2,26 @@ package network
 
 import (
 	"fmt"
+	"github.com/danieldin95/openlan-go/libol"
 	"sync"
 )
 
+const (
+	ETHFRAME = 1518 // max frame of ethernet with vlan.
+	ETHHEAD  = 18
+)
+
+// SetLinkMtu sets mtu of kernel interface by frame size, and only for
+// jumbo frame, others are default.
+func SetLinkMtu(name string, frame int) {
+	if frame <= ETHFRAME {
+		return
+	}
+	if out, err := libol.IpLinkMtu(name, frame-ETHHEAD); err != nil {
+		libol.Error("SetLinkMtu: %s %s %s", name, err, out)
+	}
+}
+
 type Taper interface {
 	IsTun() bool
 	IsTap() bool
@@ -0,0 +1,365 @@
+package point
+
+import (
+	"github.com/danieldin95/openlan-go/libol"
+	"github.com/danieldin95/openlan-go/main/config"
+	"github.com/danieldin95/openlan-go/switch/schema"
+	"math"
+	"math/rand"
+	"net"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Endpoint is a switch the point can connect to.
+type Endpoint struct {
+	Addr     string
+	Protocol string
+	Weight   int
+	Local    string
+
+	healthy bool
+	rtt     time.Duration
+	since   time.Time     // healthy since.
+	session *probeSession // reused to probe over kcp.
+}
+
+func (e *Endpoint) String() string {
+	return e.Protocol + "://" + e.Addr
+}
+
+// Datagram is true for protocols over udp, and no connection to probe.
+func (e *Endpoint) Datagram() bool {
+	switch e.Protocol {
+	case "udp", "kcp", "kcp+tcpraw":
+		return true
+	}
+	return false
+}
+
+// Proxyable is true for protocols over tcp connection.
+func (e *Endpoint) Proxyable() bool {
+	switch e.Protocol {
+	case "tcp", "tls", "ws", "wss":
+		return true
+	}
+	return false
+}
+
+// Endpoints is in preferred order, and the active one fails over to
+// healthy others, and fails back if the preferred is stable for
+// hold-down.
+type Endpoints struct {
+	lock     sync.RWMutex
+	list     []*Endpoint
+	active   int
+	probe    time.Duration
+	holdDown time.Duration
+	timeout  time.Duration
+	proxy    *libol.Proxy
+	kcp      *config.Kcp
+	done     chan bool
+	stopped  bool
+}
+
+func NewEndpoints(c *config.Point, proxy *libol.Proxy) *Endpoints {
+	f := config.Failover{}
+	if c.Failover != nil {
+		f = *c.Failover
+	}
+	f.Right()
+	e := &Endpoints{
+		list:     make([]*Endpoint, 0, 4),
+		probe:    time.Duration(f.Probe) * time.Second,
+		holdDown: time.Duration(f.HoldDown) * time.Second,
+		timeout:  3 * time.Second,
+		proxy:    proxy,
+		kcp:      c.Kcp,
+		done:     make(chan bool),
+	}
+	now := time.Now()
+	for _, ep := range c.Endpoints {
+		protocol := ep.Protocol
+		if protocol == "" {
+			protocol = c.Protocol
+		}
+		e.list = append(e.list, &Endpoint{
+			Addr:     ep.Addr,
+			Protocol: protocol,
+			Weight:   ep.Weight,
+			Local:    ep.Local,
+			healthy:  true,
+			since:    now,
+		})
+	}
+	if len(e.list) == 0 {
+		e.list = append(e.list, &Endpoint{
+			Addr:     c.Addr,
+			Protocol: c.Protocol,
+			healthy:  true,
+			since:    now,
+		})
+	}
+	if f.Mode == "weighted" {
+		e.shuffle()
+	}
+	return e
+}
+
+// shuffle by weight, and points prefer endpoints in different order.
+func (e *Endpoints) shuffle() {
+	keys := make(map[*Endpoint]float64, len(e.list))
+	for _, ep := range e.list {
+		weight := ep.Weight
+		if weight <= 0 {
+			weight = 1
+		}
+		keys[ep] = math.Pow(rand.Float64(), 1/float64(weight))
+	}
+	sort.SliceStable(e.list, func(i, j int) bool {
+		return keys[e.list[i]] > keys[e.list[j]]
+	})
+}
+
+func (e *Endpoints) Active() *Endpoint {
+	e.lock.RLock()
+	defer e.lock.RUnlock()
+	return e.list[e.active]
+}
+
+func (e *Endpoints) IsHealthy(ep *Endpoint) bool {
+	e.lock.RLock()
+	defer e.lock.RUnlock()
+	return ep.healthy
+}
+
+// Failover selects the most preferred healthy endpoint other than the
+// active, or the next if none healthy. It returns nil if not changed.
+func (e *Endpoints) Failover() *Endpoint {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	if len(e.list) < 2 {
+		return nil
+	}
+	next := (e.active + 1) % len(e.list)
+	for i, ep := range e.list {
+		if i != e.active && ep.healthy {
+			next = i
+			break
+		}
+	}
+	libol.Warn("Endpoints.Failover: %s -> %s", e.list[e.active], e.list[next])
+	e.active = next
+	return e.list[next]
+}
+
+// Failback selects the preferred endpoint has been healthy for hold-down.
+// It returns nil if not changed.
+func (e *Endpoints) Failback() *Endpoint {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	now := time.Now()
+	for i := 0; i < e.active; i++ {
+		ep := e.list[i]
+		if ep.healthy && now.Sub(ep.since) >= e.holdDown {
+			libol.Info("Endpoints.Failback: %s -> %s", e.list[e.active], ep)
+			e.active = i
+			return ep
+		}
+	}
+	return nil
+}
+
+// probeSession pings the switch in one session, and the pongs are read
+// in background.
+type probeSession struct {
+	client libol.SocketClient
+	pongs  chan error
+}
+
+func newProbeSession(client libol.SocketClient) (*probeSession, error) {
+	if err := client.Connect(); err != nil {
+		client.Terminal()
+		return nil, err
+	}
+	s := &probeSession{client: client, pongs: make(chan error, 4)}
+	go s.read()
+	return s, nil
+}
+
+func (s *probeSession) read() {
+	data := make([]byte, libol.MAXBUF)
+	for {
+		n, err := s.client.ReadMsg(data)
+		if err != nil {
+			select {
+			case s.pongs <- err:
+			default:
+			}
+			return
+		}
+		if n > 0 && libol.IsControl(data[:n]) {
+			if action, _ := libol.NewFrameMessage(data[:n]).CmdAndParams(); action == "pong:" {
+				select {
+				case s.pongs <- nil:
+				default:
+				}
+			}
+		}
+	}
+}
+
+func (s *probeSession) Ping(timeout time.Duration) error {
+	for len(s.pongs) > 0 { // late pongs of previous.
+		if err := <-s.pongs; err != nil {
+			return err
+		}
+	}
+	if _, err := s.client.Ping(); err != nil {
+		return err
+	}
+	select {
+	case err := <-s.pongs:
+		return err
+	case <-time.After(timeout):
+		return libol.NewErr("no pong in %s", timeout)
+	}
+}
+
+func (s *probeSession) Close() {
+	s.client.Terminal()
+}
+
+// probeDatagram sends a probe echoed by the switch without session over
+// udp, and pings in the session reused over kcp. It is healthy if replied
+// in timeout, and the session is dialed again in next probe if failed.
+func (e *Endpoints) probeDatagram(ep *Endpoint) error {
+	if ep.Protocol == "udp" {
+		return libol.ProbeUdp(ep.Addr, e.timeout)
+	}
+	e.lock.Lock()
+	s := ep.session
+	ep.session = nil
+	e.lock.Unlock()
+	if s == nil {
+		kcpCfg, err := config.NewKcpConfig(ep.Protocol, e.kcp)
+		if err != nil {
+			return err
+		}
+		if s, err = newProbeSession(libol.NewKcpClient(ep.Addr, kcpCfg)); err != nil {
+			return err
+		}
+	}
+	if err := s.Ping(e.timeout); err != nil {
+		s.Close()
+		return err
+	}
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	if e.stopped {
+		s.Close()
+		return nil
+	}
+	ep.session = s
+	return nil
+}
+
+func (e *Endpoints) probeOne(ep *Endpoint) {
+	var conn net.Conn
+	var err error
+
+	start := time.Now()
+	if ep.Datagram() {
+		err = e.probeDatagram(ep)
+	} else if e.proxy != nil && ep.Proxyable() && e.proxy.UseFor(ep.Addr) {
+		conn, err = e.proxy.Dial(ep.Addr)
+	} else {
+		conn, err = net.DialTimeout("tcp", ep.Addr, e.timeout)
+	}
+	rtt := time.Since(start)
+	if conn != nil {
+		_ = conn.Close()
+	}
+
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	if err != nil {
+		if ep.healthy {
+			libol.Warn("Endpoints.probeOne: %s %s", ep, err)
+		}
+		ep.healthy = false
+		ep.rtt = 0
+		return
+	}
+	if !ep.healthy {
+		libol.Info("Endpoints.probeOne: %s healthy", ep)
+		ep.healthy = true
+		ep.since = time.Now()
+	}
+	ep.rtt = rtt
+}
+
+func (e *Endpoints) Probe() {
+	wg := sync.WaitGroup{}
+	for _, ep := range e.list {
+		wg.Add(1)
+		go func(ep *Endpoint) {
+			defer wg.Done()
+			e.probeOne(ep)
+		}(ep)
+	}
+	wg.Wait()
+}
+
+// Loop probes endpoints, and calls failback if the preferred is stable.
+func (e *Endpoints) Loop(failback func(ep *Endpoint)) {
+	if len(e.list) < 2 {
+		return
+	}
+	ticker := time.NewTicker(e.probe)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-e.done:
+			return
+		case <-ticker.C:
+			e.Probe()
+			if ep := e.Failback(); ep != nil {
+				failback(ep)
+			}
+		}
+	}
+}
+
+func (e *Endpoints) Stop() {
+	close(e.done)
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	e.stopped = true
+	for _, ep := range e.list {
+		if ep.session != nil {
+			ep.session.Close()
+			ep.session = nil
+		}
+	}
+}
+
+func (e *Endpoints) Status() []schema.Endpoint {
+	e.lock.RLock()
+	defer e.lock.RUnlock()
+	ls := make([]schema.Endpoint, 0, len(e.list))
+	for i, ep := range e.list {
+		ls = append(ls, schema.Endpoint{
+			Address:  ep.Addr,
+			Protocol: ep.Protocol,
+			Weight:   ep.Weight,
+			Active:   i == e.active,
+			Healthy:  ep.healthy,
+			Rtt:      libol.Milliseconds(ep.rtt),
+		})
+	}
+	return ls
+}
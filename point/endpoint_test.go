@@ -0,0 +1,67 @@
+package point
+
+import (
+	"github.com/danieldin95/openlan-go/libol"
+	"github.com/danieldin95/openlan-go/main/config"
+	"github.com/stretchr/testify/assert"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestEndpointsFailover(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err, "listen.")
+	defer ln.Close()
+	closed, _ := net.Listen("tcp", "127.0.0.1:0")
+	closed.Close()
+
+	c := &config.Point{
+		Protocol: "tcp",
+		Endpoints: []config.Endpoint{
+			{Addr: closed.Addr().String()},
+			{Addr: ln.Addr().String()},
+			{Addr: "127.0.0.1:1", Protocol: "udp"},
+		},
+	}
+	e := NewEndpoints(c, nil)
+	e.holdDown = 0
+	assert.Equal(t, "tcp", e.Active().Protocol, "protocol.")
+	assert.Equal(t, closed.Addr().String(), e.Active().Addr, "preferred.")
+
+	e.Probe()
+	assert.False(t, e.IsHealthy(e.list[0]), "closed.")
+	assert.True(t, e.IsHealthy(e.list[1]), "listened.")
+	assert.False(t, e.IsHealthy(e.list[2]), "no pong.")
+	assert.Equal(t, e.list[1], e.Failover(), "to healthy.")
+	assert.Nil(t, e.Failback(), "preferred unhealthy.")
+	assert.True(t, e.Status()[1].Active, "active.")
+
+	e.list[0].Addr = ln.Addr().String()
+	e.Probe()
+	assert.Equal(t, e.list[0], e.Failback(), "fail back.")
+}
+
+func TestEndpointsProbeUdp(t *testing.T) {
+	free, err := net.ListenPacket("udp", "127.0.0.1:0")
+	assert.Nil(t, err, "listen.")
+	addr := free.LocalAddr().String()
+	free.Close()
+	server := libol.NewUdpServer(addr, nil)
+	defer server.Close()
+	go server.Accept() // probe echoed without session.
+
+	c := &config.Point{
+		Protocol: "udp",
+		Endpoints: []config.Endpoint{
+			{Addr: "127.0.0.1:1"},
+			{Addr: addr},
+		},
+	}
+	e := NewEndpoints(c, nil)
+	e.timeout = time.Second
+	e.Probe()
+	assert.False(t, e.IsHealthy(e.list[0]), "no pong.")
+	assert.True(t, e.IsHealthy(e.list[1]), "ponged.")
+	assert.Equal(t, e.list[1], e.Failover(), "to healthy.")
+}
@@ -3,6 +3,7 @@ package http
 import (
 	"context"
 	"github.com/danieldin95/openlan-go/libol"
+	"github.com/danieldin95/openlan-go/switch/schema"
 	"github.com/gorilla/mux"
 	"net/http"
 	"net/http/pprof"
@@ -98,6 +99,14 @@ func (h *Http) LoadRouter() {
 			ResponseJson(w, h.pointer.UUID())
 		}
 	})
+	router.HandleFunc("/current", func(w http.ResponseWriter, r *http.Request) {
+		format := GetQueryOne(r, "format")
+		if format == "yaml" {
+			ResponseYaml(w, h.Current())
+		} else {
+			ResponseJson(w, h.Current())
+		}
+	})
 	router.HandleFunc("/current/config", func(w http.ResponseWriter, r *http.Request) {
 		format := GetQueryOne(r, "format")
 		if format == "yaml" {
@@ -108,6 +117,37 @@ func (h *Http) LoadRouter() {
 	})
 }
 
+func (h *Http) Current() schema.Point {
+	p := h.pointer
+	c := p.Config()
+	cur := schema.Point{
+		UUID:    p.UUID(),
+		Network: c.Network,
+		Alias:   c.Alias,
+		Device:  p.IfName(),
+		IpAddr:  c.If.Address,
+	}
+	reconn := p.Reconnect()
+	cur.Reconnect = &reconn
+	cur.Endpoints = p.Endpoints()
+	cur.Bond = p.Bond()
+	if client := p.Client(); client != nil {
+		sts := client.Sts()
+		rtt, jitter := client.Rtt()
+		cur.Uptime = client.UpTime()
+		cur.Address = client.Addr()
+		cur.State = client.State()
+		cur.RxBytes = sts.RxOkay
+		cur.TxBytes = sts.TxOkay
+		cur.ErrPkt = sts.TxError
+		cur.TxRatio = sts.TxRatio()
+		cur.RxRatio = sts.RxRatio()
+		cur.Rtt = libol.Milliseconds(rtt)
+		cur.Jitter = libol.Milliseconds(jitter)
+	}
+	return cur
+}
+
 func (h *Http) Start() error {
 	h.Initialize()
 	libol.Info("Http.Start %s", h.listen)
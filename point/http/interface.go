@@ -1,8 +1,17 @@
 package http
 
-import "github.com/danieldin95/openlan-go/main/config"
+import (
+	"github.com/danieldin95/openlan-go/libol"
+	"github.com/danieldin95/openlan-go/main/config"
+	"github.com/danieldin95/openlan-go/switch/schema"
+)
 
 type Pointer interface {
 	UUID() string
 	Config() *config.Point
+	Client() libol.SocketClient
+	IfName() string
+	Reconnect() schema.Reconnect
+	Endpoints() []schema.Endpoint
+	Bond() *schema.Bond
 }
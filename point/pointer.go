@@ -20,18 +20,15 @@ type Pointer interface {
 type MixPoint struct {
 	Tenant     string
 	uuid       string
-	worker     Worker
+	worker     *Worker
 	config     *config.Point
 	initialize bool
 }
 
 func NewMixPoint(config *config.Point) MixPoint {
 	p := MixPoint{
-		Tenant: config.Network,
-		worker: Worker{
-			IfAddr: config.If.Address,
-			config: config,
-		},
+		Tenant:     config.Network,
+		worker:     NewWorker(config),
 		config:     config,
 		initialize: false,
 	}
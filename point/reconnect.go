@@ -0,0 +1,99 @@
+package point
+
+import (
+	"github.com/danieldin95/openlan-go/libol"
+	"github.com/danieldin95/openlan-go/main/config"
+	"github.com/danieldin95/openlan-go/switch/schema"
+	"sync"
+	"time"
+)
+
+const (
+	RE_CONNECTING = "connecting"
+	RE_CONNECTED  = "connected"
+	RE_BACKOFF    = "backoff"
+	RE_STOPPED    = "stopped"
+)
+
+// Reconnect is state of connection to switch, and waits by backoff
+// before dialing again, so points not reconnect in lockstep.
+type Reconnect struct {
+	lock    sync.RWMutex
+	state   string
+	next    time.Time
+	backoff *libol.Backoff
+}
+
+func NewBackoff(c *config.Backoff) *libol.Backoff {
+	b := config.Backoff{}
+	if c != nil {
+		b = *c
+	}
+	b.Right()
+	return libol.NewBackoff(time.Duration(b.Interval)*time.Second, time.Duration(b.Max)*time.Second)
+}
+
+func NewReconnect(c *config.Backoff) *Reconnect {
+	return &Reconnect{
+		state:   RE_CONNECTING,
+		backoff: NewBackoff(c),
+	}
+}
+
+func (r *Reconnect) setState(state string, next time.Time) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.state = state
+	r.next = next
+}
+
+// Wait sleeps until next attempt, and returns false if done.
+func (r *Reconnect) Wait(done chan bool) bool {
+	d := r.backoff.Next()
+	if d > 0 {
+		libol.Info("Reconnect.Wait: attempt %d after %s", r.backoff.Attempts(), d)
+		r.setState(RE_BACKOFF, time.Now().Add(d))
+		timer := time.NewTimer(d)
+		defer timer.Stop()
+		select {
+		case <-done:
+			r.setState(RE_STOPPED, time.Time{})
+			return false
+		case <-timer.C:
+		}
+	}
+	r.setState(RE_CONNECTING, time.Time{})
+	return true
+}
+
+// Connected resets the backoff after login success.
+func (r *Reconnect) Connected() {
+	r.backoff.Reset()
+	r.setState(RE_CONNECTED, time.Time{})
+}
+
+// Closed is called when the connection lost, and it retries soon.
+func (r *Reconnect) Closed() {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if r.state == RE_CONNECTED {
+		r.state = RE_CONNECTING
+	}
+}
+
+func (r *Reconnect) Stop() {
+	r.setState(RE_STOPPED, time.Time{})
+}
+
+func (r *Reconnect) Status() schema.Reconnect {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	s := schema.Reconnect{
+		State:    r.state,
+		Attempts: r.backoff.Attempts(),
+	}
+	if !r.next.IsZero() {
+		s.Next = r.next.Unix()
+	}
+	return s
+}
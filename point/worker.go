@@ -3,6 +3,7 @@ package point
 import (
 	"bytes"
 	"crypto/tls"
+	"encoding/base64"
 	"encoding/binary"
 	"encoding/json"
 	"fmt"
@@ -11,6 +12,7 @@ import (
 	"github.com/danieldin95/openlan-go/models"
 	"github.com/danieldin95/openlan-go/network"
 	"github.com/danieldin95/openlan-go/point/http"
+	"github.com/danieldin95/openlan-go/switch/schema"
 	"net"
 	"strings"
 	"sync"
@@ -18,10 +20,11 @@ import (
 )
 
 type SessWorkerListener struct {
-	OnClose   func(w *SessWorker) error
-	OnSuccess func(w *SessWorker) error
-	OnIpAddr  func(w *SessWorker, n *models.Network) error
-	ReadAt    func(p []byte) error
+	OnClose     func(w *SessWorker) error
+	OnSuccess   func(w *SessWorker) error
+	OnIpAddr    func(w *SessWorker, n *models.Network) error
+	OnReconnect func(w *SessWorker) error
+	ReadAt      func(p []byte) error
 }
 
 type SessWorker struct {
@@ -36,6 +39,20 @@ type SessWorker struct {
 	routes      map[string]*models.Route
 	allowed     bool
 	initialized bool
+	crypt       *config.Crypt
+	cryptKey    *libol.CryptKey
+	compress    string
+	hello       *models.Hello // locked by helloLock.
+	features    []string
+	helloLock   sync.Mutex
+	helloTimer  *time.Timer
+	legacy      map[string]int64 // switch not supported hello since, and locked by helloLock.
+	heartbeat   config.Heartbeat
+	reconn      *Reconnect
+	done        chan bool
+	bond        *libol.Bond
+	bondReq     *models.Bond
+	extra       bool // path of bond, and not request address.
 }
 
 func NewSessWorker(client libol.SocketClient, c *config.Point) (t *SessWorker) {
@@ -47,9 +64,31 @@ func NewSessWorker(client libol.SocketClient, c *config.Point) (t *SessWorker) {
 		routes:      make(map[string]*models.Route, 64),
 		allowed:     c.Allowed,
 		initialized: false,
+		crypt:       c.Crypt,
+		compress:    c.Compress,
+		reconn:      NewReconnect(c.Backoff),
+		done:        make(chan bool),
+		legacy:      make(map[string]int64, 4),
 	}
+	if c.Heartbeat != nil {
+		t.heartbeat = *c.Heartbeat
+	}
+	t.heartbeat.Right()
 	t.user.Alias = c.Alias
 	t.user.Network = c.Network
+	t.features = []string{models.FeatBeat}
+	if c.Compress != "" {
+		t.features = append(t.features, models.FeatCompress)
+	}
+	if c.Crypt != nil && c.Crypt.Algo != "" {
+		t.features = append(t.features, models.FeatCrypt)
+	}
+	if c.Mux {
+		t.features = append(t.features, models.FeatMux)
+	}
+	if c.Bond != nil {
+		t.features = append(t.features, models.FeatBond)
+	}
 
 	return
 }
@@ -61,12 +100,18 @@ func (t *SessWorker) Initialize() {
 
 	libol.Info("SessWorker.Initialize")
 	t.initialized = true
-	t.Client.SetMaxSize(t.maxSize)
-	t.Client.SetListener(libol.ClientListener{
+	t.setListener(t.Client)
+}
+
+func (t *SessWorker) setListener(client libol.SocketClient) {
+	client.SetMaxSize(t.maxSize)
+	client.SetListener(libol.ClientListener{
 		OnConnected: func(client libol.SocketClient) error {
-			return t.Login(client)
+			return t.Hello(client)
 		},
 		OnClose: func(client libol.SocketClient) error {
+			t.stopHello(nil)
+			t.reconn.Closed()
 			if t.Listener.OnClose != nil {
 				_ = t.Listener.OnClose(t)
 			}
@@ -75,16 +120,54 @@ func (t *SessWorker) Initialize() {
 	})
 }
 
+// SetBond binds the session to the bond, and it is an extra path if not
+// the primary.
+func (t *SessWorker) SetBond(bond *libol.Bond, c *config.Bond, extra bool) {
+	t.bond = bond
+	t.bondReq = &models.Bond{
+		Mode:     c.Mode,
+		Sequence: c.Sequence,
+	}
+	t.extra = extra
+}
+
+// SetClient replaces the client to connect other switch, and the old one
+// is closed.
+func (t *SessWorker) SetClient(client libol.SocketClient) {
+	t.setListener(client)
+	t.lock.Lock()
+	old := t.Client
+	t.Client = client
+	t.lock.Unlock()
+	if old != nil {
+		libol.Info("SessWorker.SetClient: %s -> %s", old, client)
+		old.Terminal()
+	}
+}
+
+// client returns the current client, that is replaced by SetClient.
+func (t *SessWorker) client() libol.SocketClient {
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+	return t.Client
+}
+
 func (t *SessWorker) Start() {
 	if !t.initialized {
 		t.Initialize()
 	}
-	_ = t.Connect()
+	if err := t.Connect(); t.client() == nil { // stopped.
+		libol.Warn("SessWorker.Start: %s", err)
+		return
+	}
 
 	go t.Read()
+	go t.Loop()
 }
 
 func (t *SessWorker) Stop() {
+	close(t.done)
+	t.reconn.Stop()
 	t.Client.Terminal()
 
 	t.lock.Lock()
@@ -101,22 +184,127 @@ func (t *SessWorker) Close() {
 	}
 }
 
+// Connect returns an error if stopped before started.
 func (t *SessWorker) Connect() error {
-	s := t.Client.Status()
+	client := t.client()
+	if client == nil {
+		return libol.NewErr("SessWorker.Connect: stopped")
+	}
+	s := client.Status()
 	if s != libol.CL_INIT {
 		libol.Warn("SessWorker.Connect status %d->%d", s, libol.CL_INIT)
-		t.Client.SetStatus(libol.CL_INIT)
+		client.SetStatus(libol.CL_INIT)
 	}
 
-	if err := t.Client.Connect(); err != nil {
+	if err := client.Connect(); err != nil {
 		libol.Error("SessWorker.Connect %s", err)
 		return err
 	}
 	return nil
 }
 
+// LEGACYTIME is seconds to login without hello, and hello is tried again
+// after it, since the switch may be upgraded.
+const LEGACYTIME = 300
+
+// isLegacy returns true if the switch of address not supported hello in
+// recent time.
+func (t *SessWorker) isLegacy(addr string) bool {
+	t.helloLock.Lock()
+	defer t.helloLock.Unlock()
+	since, ok := t.legacy[addr]
+	if !ok {
+		return false
+	}
+	if time.Now().Unix()-since < LEGACYTIME {
+		return true
+	}
+	libol.Info("SessWorker.isLegacy: %s try hello again", addr)
+	delete(t.legacy, addr)
+	return false
+}
+
+// hello request, and login after replied. If timeout, the switch may
+// not support hello, and login without it in next connection to it.
+func (t *SessWorker) Hello(client libol.SocketClient) error {
+	client.SetCrypt(nil)
+	client.SetCompress("")
+	client.SetMaxSize(t.maxSize)
+	t.setHello(nil)
+	addr := client.Addr()
+	if t.isLegacy(addr) {
+		return t.Login(client)
+	}
+
+	body, err := json.Marshal(models.NewHello(t.maxSize, t.features...))
+	if err != nil {
+		libol.Error("SessWorker.Hello: %s", err)
+		return err
+	}
+	var timer *time.Timer
+	timer = time.AfterFunc(5*time.Second, func() {
+		if t.stopHello(timer) {
+			libol.Warn("SessWorker.Hello: %s no reply, and retry without hello", addr)
+			t.helloLock.Lock()
+			t.legacy[addr] = time.Now().Unix()
+			t.helloLock.Unlock()
+			client.Close()
+		}
+	})
+	t.helloLock.Lock()
+	t.helloTimer = timer
+	t.helloLock.Unlock()
+
+	libol.Cmd("SessWorker.Hello: %s", body)
+	if err := client.WriteReq("hello", string(body)); err != nil {
+		libol.Error("SessWorker.Hello: %s", err)
+		t.stopHello(timer)
+		return err
+	}
+	return nil
+}
+
+// stopHello returns true if the timer is waiting, and nil for any.
+func (t *SessWorker) stopHello(timer *time.Timer) bool {
+	t.helloLock.Lock()
+	defer t.helloLock.Unlock()
+	if t.helloTimer == nil || (timer != nil && t.helloTimer != timer) {
+		return false
+	}
+	t.helloTimer.Stop()
+	t.helloTimer = nil
+	return true
+}
+
 // login request
 func (t *SessWorker) Login(client libol.SocketClient) error {
+	hello := t.getHello()
+	t.user.Compress = t.compress
+	if hello != nil && !hello.Has(models.FeatCompress) {
+		t.user.Compress = ""
+	}
+	t.user.Bond = t.bondReq
+	if t.bondReq != nil && (hello == nil || !hello.Has(models.FeatBond)) {
+		t.user.Bond = nil
+		if t.extra {
+			// login with same uuid kicks the primary.
+			libol.Warn("SessWorker.Login: %s bond not supported", client)
+			client.Close()
+			return libol.NewErr("bond not supported")
+		}
+	}
+	if t.crypt != nil && t.crypt.Algo != "" {
+		key, err := libol.NewCryptKey()
+		if err != nil {
+			libol.Error("SessWorker.Login: %s", err)
+			return err
+		}
+		t.cryptKey = key
+		t.user.Crypt = &models.Crypt{
+			Algo:   t.crypt.Algo,
+			PubKey: base64.StdEncoding.EncodeToString(key.Public()),
+		}
+	}
 	body, err := json.Marshal(t.user)
 	if err != nil {
 		libol.Error("SessWorker.Login: %s", err)
@@ -160,11 +348,17 @@ func (t *SessWorker) onInstruct(data []byte) error {
 	case "logi:":
 		{
 			if resp[:4] == "okay" {
+				if err := t.onAccepted(resp); err != nil {
+					t.Client.SetStatus(libol.CL_UNAUTH)
+					libol.Error("SessWorker.onInstruct.login: %s", err)
+					return err
+				}
 				t.Client.SetStatus(libol.CL_AUEHED)
+				t.reconn.Connected()
 				if t.Listener.OnSuccess != nil {
 					_ = t.Listener.OnSuccess(t)
 				}
-				if t.allowed {
+				if t.allowed && !t.extra {
 					_ = t.Network(t.Client)
 				}
 				libol.Info("SessWorker.onInstruct.login: success")
@@ -173,6 +367,36 @@ func (t *SessWorker) onInstruct(data []byte) error {
 				libol.Error("SessWorker.onInstruct.login: %s", resp)
 			}
 		}
+	case "hell:":
+		{
+			if !t.stopHello(nil) {
+				return nil
+			}
+			h := &models.Hello{}
+			if err := json.Unmarshal([]byte(resp), h); err != nil {
+				t.Client.SetStatus(libol.CL_UNAUTH)
+				libol.Error("SessWorker.onInstruct.hello: %s", resp)
+				return libol.NewErr("hello %s", resp)
+			}
+			if h.Version > models.HelloVersion {
+				t.Client.SetStatus(libol.CL_UNAUTH)
+				libol.Error("SessWorker.onInstruct.hello: version %d not supported", h.Version)
+				return libol.NewErr("version %d not supported", h.Version)
+			}
+			if h.MaxSize > 0 && h.MaxSize < t.maxSize {
+				t.Client.SetMaxSize(h.MaxSize)
+			}
+			t.helloLock.Lock()
+			t.hello = h
+			delete(t.legacy, t.Client.Addr())
+			t.helloLock.Unlock()
+			libol.Info("SessWorker.onInstruct.hello: %s", h)
+			_ = t.Login(t.Client)
+		}
+	case "ping=":
+		_ = t.Client.Pong(resp)
+	case "pong:":
+		t.Client.OnPong(resp)
 	case "ipad:":
 		{
 			n := models.Network{}
@@ -187,25 +411,88 @@ func (t *SessWorker) onInstruct(data []byte) error {
 	return nil
 }
 
+// enable options accepted by switch in "okay. {...}".
+func (t *SessWorker) onAccepted(resp string) error {
+	a := models.Accepted{}
+	body := strings.TrimSpace(strings.TrimPrefix(resp, "okay."))
+	if body != "" {
+		if err := json.Unmarshal([]byte(body), &a); err != nil {
+			return libol.NewErr("Invalid json data.")
+		}
+	}
+	if err := t.onCrypt(a.Crypt); err != nil {
+		return err
+	}
+	if a.Compress != "" && a.Compress == t.user.Compress {
+		t.Client.SetCompress(a.Compress)
+		libol.Info("SessWorker.onAccepted: %s enabled", a.Compress)
+	}
+	if a.MaxSize > 0 && a.MaxSize < t.Client.MaxSize() {
+		libol.Warn("SessWorker.onAccepted: maxSize clamped to %d", a.MaxSize)
+		t.Client.SetMaxSize(a.MaxSize)
+	}
+	if t.bond != nil {
+		sequence := a.Bond != nil && a.Bond.Sequence
+		t.bond.SetSequence(sequence)
+		if sequence {
+			t.Client.SetMaxSize(t.Client.MaxSize() + libol.BONDSEQ)
+		}
+	}
+	return nil
+}
+
+// enable crypt by the public key of switch.
+func (t *SessWorker) onCrypt(c *models.Crypt) error {
+	if t.user.Crypt == nil {
+		return nil
+	}
+	if c == nil || c.Algo != t.user.Crypt.Algo {
+		return libol.NewErr("crypt %s not accepted", t.user.Crypt.Algo)
+	}
+	peer, err := base64.StdEncoding.DecodeString(c.PubKey)
+	if err != nil {
+		return err
+	}
+	shared, err := t.cryptKey.Shared(peer)
+	if err != nil {
+		return err
+	}
+	crypt, err := libol.NewCrypt(c.Algo, shared, t.crypt.Secret, false)
+	if err != nil {
+		return err
+	}
+	t.Client.SetCrypt(crypt)
+	libol.Info("SessWorker.onCrypt: %s enabled", c.Algo)
+	return nil
+}
+
 func (t *SessWorker) Read() {
-	libol.Info("SessWorker.Read: %s", t.Client.State())
 	defer libol.Catch("SessWorker.Read")
+	if client := t.client(); client != nil {
+		libol.Info("SessWorker.Read: %s", client.State())
+	}
 
 	data := make([]byte, libol.MAXBUF)
 	for {
-		if t.Client == nil || t.Client.Have(libol.CL_TERMINAL) {
+		client := t.client()
+		if client == nil || client.Have(libol.CL_TERMINAL) {
 			break
 		}
 
-		if !t.Client.IsOk() {
-			time.Sleep(30 * time.Second) // sleep 30s and release cpu.
+		if !client.IsOk() {
+			if !t.reconn.Wait(t.done) {
+				break
+			}
+			if t.Listener.OnReconnect != nil {
+				_ = t.Listener.OnReconnect(t)
+			}
 			_ = t.Connect()
 			continue
 		}
-		n, err := t.Client.ReadMsg(data)
+		n, err := client.ReadMsg(data)
 		if err != nil {
 			libol.Error("SessWorker.Read: %s", err)
-			t.Close()
+			client.Close()
 			continue
 		}
 		libol.Log("SessWorker.Read: %x", data[:n])
@@ -223,6 +510,61 @@ func (t *SessWorker) Read() {
 	libol.Info("SessWorker.Read: exit")
 }
 
+func (t *SessWorker) getHello() *models.Hello {
+	t.helloLock.Lock()
+	defer t.helloLock.Unlock()
+	return t.hello
+}
+
+func (t *SessWorker) setHello(h *models.Hello) {
+	t.helloLock.Lock()
+	defer t.helloLock.Unlock()
+	t.hello = h
+}
+
+// interval returns the interval of heartbeat, and the switch's if it
+// is shorter, since the switch closes the point silent for its intervals.
+func (t *SessWorker) interval() time.Duration {
+	interval := t.heartbeat.Interval
+	if h := t.getHello(); h != nil && h.Interval > 0 && h.Interval < interval {
+		interval = h.Interval
+	}
+	return time.Duration(interval) * time.Second
+}
+
+// Loop sends heartbeat if the switch supported it, and closes the
+// connection if missed too many, so it can reconnect.
+func (t *SessWorker) Loop() {
+	for {
+		timer := time.NewTimer(t.interval())
+		select {
+		case <-t.done:
+			timer.Stop()
+			return
+		case <-timer.C:
+			t.ping()
+		}
+	}
+}
+
+func (t *SessWorker) ping() {
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+
+	client := t.Client
+	if client == nil || client.Status() != libol.CL_AUEHED {
+		return
+	}
+	if h := t.getHello(); h == nil || !h.Has(models.FeatBeat) {
+		return
+	}
+	missed, err := client.Ping()
+	if err != nil || missed >= t.heartbeat.Missed {
+		libol.Warn("SessWorker.ping: %s missed %d pings", client, missed)
+		client.Close()
+	}
+}
+
 func (t *SessWorker) DoWrite(data []byte) error {
 	libol.Log("SessWorker.DoWrite: %x", data)
 
@@ -233,6 +575,10 @@ func (t *SessWorker) DoWrite(data []byte) error {
 		libol.Debug("SessWorker.Loop: dropping by unAuth")
 		return nil
 	}
+	if len(data) > t.Client.MaxSize() {
+		libol.Debug("SessWorker.DoWrite: dropping by size %d", len(data))
+		return nil
+	}
 	if err := t.Client.WriteMsg(data); err != nil {
 		t.Close()
 		return err
@@ -240,6 +586,15 @@ func (t *SessWorker) DoWrite(data []byte) error {
 	return nil
 }
 
+func (t *SessWorker) Reconnect() schema.Reconnect {
+	return t.reconn.Status()
+}
+
+// Attempts returns the number of connecting since the last login.
+func (t *SessWorker) Attempts() int {
+	return t.reconn.backoff.Attempts()
+}
+
 func (t *SessWorker) Auth() (string, string) {
 	return t.user.Name, t.user.Password
 }
@@ -271,6 +626,7 @@ type Neighbors struct {
 	lock      sync.RWMutex
 	neighbors map[uint32]*Neighbor
 	done      chan bool
+	once      sync.Once
 	ticker    *time.Ticker
 	timeout   int64
 }
@@ -309,9 +665,12 @@ func (n *Neighbors) Start() {
 	}
 }
 
+// Stop never blocks, and it may be called before started.
 func (n *Neighbors) Stop() {
 	n.ticker.Stop()
-	n.done <- true
+	n.once.Do(func() {
+		close(n.done)
+	})
 }
 
 func (n *Neighbors) Add(h *Neighbor) {
@@ -387,7 +746,7 @@ type TunEther struct {
 }
 
 type TapWorker struct {
-	Device    network.Taper
+	Device    network.Taper // locked by lock, since closed by others.
 	Listener  TapWorkerListener
 	Ether     TunEther
 	Neighbors Neighbors
@@ -398,6 +757,7 @@ type TapWorker struct {
 	pointCfg    *config.Point
 	initialized bool
 	ifAddr      string
+	backoff     *libol.Backoff
 }
 
 func NewTapWorker(devCfg network.TapConfig, c *config.Point) (a *TapWorker) {
@@ -407,6 +767,7 @@ func NewTapWorker(devCfg network.TapConfig, c *config.Point) (a *TapWorker) {
 		pointCfg:    c,
 		initialized: false,
 		OpenAgain:   libol.NewSafeVar(),
+		backoff:     NewBackoff(c.Backoff),
 	}
 	a.OpenAgain.Set(false)
 
@@ -446,8 +807,14 @@ func (a *TapWorker) SetEther(addr string) {
 	a.Neighbors.Clear()
 }
 
+func (a *TapWorker) device() network.Taper {
+	a.lock.RLock()
+	defer a.lock.RUnlock()
+	return a.Device
+}
+
 func (a *TapWorker) DoTun() {
-	if a.Device == nil || !a.Device.IsTun() {
+	if dev := a.device(); dev == nil || !dev.IsTun() {
 		return
 	}
 	a.SetEther(a.pointCfg.If.Address)
@@ -455,11 +822,13 @@ func (a *TapWorker) DoTun() {
 	libol.Info("TapWorker.DoTun: src %x", a.Ether.HwAddr)
 }
 
+// Open the device again if opened, and not if closed meanwhile.
 func (a *TapWorker) Open() {
-	if a.Device != nil {
-		_ = a.Device.Close()
+	old := a.device()
+	if old != nil {
+		_ = old.Close()
 		if !a.OpenAgain.Get().(bool) {
-			time.Sleep(5 * time.Second) // sleep 5s and release cpu.
+			time.Sleep(a.backoff.Next()) // release cpu if failed again.
 		}
 	}
 	dev, err := network.NewKernelTap(a.pointCfg.Network, a.devCfg)
@@ -467,8 +836,17 @@ func (a *TapWorker) Open() {
 		libol.Error("TapWorker.Open: %s", err)
 		return
 	}
+	a.lock.Lock()
+	if a.Device != old {
+		a.lock.Unlock()
+		libol.Info("TapWorker.Open: %s closed", dev.Name())
+		_ = dev.Close()
+		return
+	}
 	libol.Info("TapWorker.Open: >>>> %s <<<<", dev.Name())
+	dev.SetMtu(a.pointCfg.If.Mtu)
 	a.Device = dev
+	a.lock.Unlock()
 	if a.Listener.OnOpen != nil {
 		_ = a.Listener.OnOpen(a)
 	}
@@ -508,11 +886,12 @@ func (a *TapWorker) Read() {
 	libol.Info("TapWorker.Read")
 	data := make([]byte, libol.MAXBUF)
 	for {
-		if a.Device == nil {
+		dev := a.device()
+		if dev == nil {
 			break
 		}
 
-		n, err := a.Device.Read(data)
+		n, err := dev.Read(data)
 		if err != nil || a.OpenAgain.Get().(bool) {
 			if err != nil {
 				libol.Warn("TapWorker.Read: %s", err)
@@ -522,8 +901,11 @@ func (a *TapWorker) Read() {
 			a.OpenAgain.Set(false)
 			continue
 		}
+		if a.backoff.Attempts() > 0 {
+			a.backoff.Reset()
+		}
 		libol.Log("TapWorker.Read: %x", data[:n])
-		if a.Device.IsTun() {
+		if dev.IsTun() {
 			iph, err := libol.NewIpv4FromFrame(data)
 			if err != nil {
 				libol.Error("TapWorker.Read: %s", err)
@@ -539,7 +921,7 @@ func (a *TapWorker) Read() {
 				continue
 			}
 			eth := a.NewEth(libol.ETHPIP4, neb.HwAddr)
-			buffer := make([]byte, 0, libol.MAXBUF)
+			buffer := make([]byte, 0, eth.Len+n)
 			buffer = append(buffer, eth.Encode()...)
 			buffer = append(buffer, data[0:n]...)
 			n += eth.Len
@@ -560,11 +942,12 @@ func (a *TapWorker) Read() {
 func (a *TapWorker) DoWrite(data []byte) error {
 	libol.Log("TapWorker.DoWrite: %x", data)
 
-	if a.Device == nil {
+	dev := a.device()
+	if dev == nil {
 		return libol.NewErr("Device is nil")
 	}
 
-	if a.Device.IsTun() {
+	if dev.IsTun() {
 		//Proxy arp request.
 		if a.onArp(data) {
 			libol.Debug("TapWorker.Loop: Arp proxy.")
@@ -583,7 +966,7 @@ func (a *TapWorker) DoWrite(data []byte) error {
 		}
 	}
 
-	if _, err := a.Device.Write(data); err != nil {
+	if _, err := dev.Write(data); err != nil {
 		libol.Error("TapWorker.Loop: %s", err)
 		a.Close()
 		return err
@@ -694,9 +1077,16 @@ type Worker struct {
 	IfAddr   string
 	Listener WorkerListener
 
+	lock        sync.Mutex // for start and stop.
+	stopped     bool
 	http        *http.Http
 	tcpWorker   *SessWorker
 	tapWorker   *TapWorker
+	bond        *libol.Bond
+	paths       []*SessWorker // extra paths of bond.
+	endpoints   *Endpoints
+	proxy       *libol.Proxy
+	invalid     error // of config, and never connect.
 	config      *config.Point
 	uuid        string
 	network     *models.Network
@@ -713,25 +1103,118 @@ func NewWorker(config *config.Point) (p *Worker) {
 	}
 }
 
+// refused returns a client never connected, since its config is invalid.
+func refused(key, addr string, err error) libol.SocketClient {
+	libol.Error("Worker.NewClient: %s %s", addr, err)
+	return libol.NewMuxClient(key, addr, func() (net.Conn, error) {
+		return nil, err
+	})
+}
+
+// muxKey identifies the session shared, and points share it only if they
+// dial the same switch by the same way.
+func (p *Worker) muxKey(ep *Endpoint) string {
+	key := []string{ep.Protocol, ep.Addr, ep.Local}
+	if c := p.config.Cert; c != nil {
+		key = append(key, c.CrtFile, c.KeyFile, c.CaFile, c.ServerName)
+	} else {
+		key = append(key, "", "", "", "")
+	}
+	key = append(key, fmt.Sprintf("%t", p.config.Insecure))
+	if p.proxy != nil {
+		key = append(key, fmt.Sprintf("%s://%s@%s", p.proxy.Scheme, p.proxy.Username, p.proxy.Addr))
+	}
+	return strings.Join(key, "|")
+}
+
+// NewMuxClient returns a stream on the session shared by points with same
+// protocol, address, certificates, local and proxy.
+func (p *Worker) NewMuxClient(ep *Endpoint, tlsConf *tls.Config) libol.SocketClient {
+	addr := ep.Addr
+	key := p.muxKey(ep)
+	if strings.HasPrefix(ep.Protocol, "kcp") {
+		kcpConf, err := config.NewKcpConfig(ep.Protocol, p.config.Kcp)
+		if err != nil {
+			return refused(key, addr, err)
+		}
+		return libol.NewMuxClient(key, addr, func() (net.Conn, error) {
+			return libol.DialKcp(addr, kcpConf)
+		})
+	}
+	return libol.NewMuxClient(key, addr, func() (net.Conn, error) {
+		return libol.DialTcpFrom(ep.Local, addr, tlsConf, p.proxy)
+	})
+}
+
+// TlsConfig verifies the switch by certificate, or by system if not
+// configured, and not verified only if insecure.
+func (p *Worker) TlsConfig(ep *Endpoint) (*tls.Config, error) {
+	if p.config.Cert != nil {
+		return p.config.Cert.ClientTls(ep.Addr)
+	}
+	if p.config.Insecure {
+		libol.Warn("Worker.TlsConfig: %s not verified by insecure", ep)
+		return &tls.Config{InsecureSkipVerify: true}, nil
+	}
+	// not verified before, and the self-signed needs ca or insecure now.
+	libol.Info("Worker.TlsConfig: %s verified by system, and set crt.ca or insecure if self-signed", ep)
+	host, _, _ := net.SplitHostPort(ep.Addr)
+	return &tls.Config{ServerName: host}, nil
+}
+
+func (p *Worker) NewClient(ep *Endpoint) libol.SocketClient {
+	var tlsConf *tls.Config
+
+	if p.invalid != nil {
+		return refused(ep.String(), ep.Addr, p.invalid)
+	}
+	if ep.Protocol == "tls" || ep.Protocol == "wss" {
+		var err error
+		if tlsConf, err = p.TlsConfig(ep); err != nil {
+			return refused(ep.String(), ep.Addr, err)
+		}
+	}
+	isKcp := ep.Protocol == "kcp" || ep.Protocol == "kcp+tcpraw"
+	if p.config.Mux && (isKcp || ep.Protocol == "tcp" || ep.Protocol == "tls") {
+		return p.NewMuxClient(ep, tlsConf)
+	} else if isKcp {
+		kcpConf, err := config.NewKcpConfig(ep.Protocol, p.config.Kcp)
+		if err != nil {
+			return refused(ep.String(), ep.Addr, err)
+		}
+		return libol.NewKcpClient(ep.Addr, kcpConf)
+	} else if ep.Protocol == "udp" {
+		return libol.NewUdpClient(ep.Addr, nil)
+	} else if ep.Protocol == "ws" || ep.Protocol == "wss" {
+		return libol.NewWebClient(ep.Addr, &libol.WebConfig{TlsCfg: tlsConf, Proxy: p.proxy})
+	}
+	// default is tcp/tls
+	client := libol.NewTcpClient(ep.Addr, tlsConf)
+	client.SetProxy(p.proxy)
+	client.SetLocal(ep.Local)
+	return client
+}
+
 func (p *Worker) Initialize() {
 	if p.config == nil {
 		return
 	}
 
 	var conf network.TapConfig
-	var tlsConf *tls.Config
-	var client libol.SocketClient
 	libol.Info("Worker.Initialize")
 
 	p.initialized = true
-	if p.config.Protocol == "tls" {
-		tlsConf = &tls.Config{InsecureSkipVerify: true}
+	proxy, err := config.NewProxy(p.config.Proxy)
+	if err != nil {
+		libol.Error("Worker.Initialize: %s", err)
+		p.invalid = libol.NewErr("proxy %s", err)
 	}
-	if p.config.Protocol == "kcp" {
-		client = libol.NewKcpClient(p.config.Addr, nil)
-	} else { // default is tcp/tls
-		client = libol.NewTcpClient(p.config.Addr, tlsConf)
+	p.proxy = proxy
+	if p.proxy != nil {
+		libol.Info("Worker.Initialize: by proxy %s", p.proxy)
 	}
+	p.endpoints = NewEndpoints(p.config, p.proxy)
+	client := p.NewClient(p.endpoints.Active())
 	p.tcpWorker = NewSessWorker(client, p.config)
 
 	if p.config.If.Provider == "tun" {
@@ -752,12 +1235,18 @@ func (p *Worker) Initialize() {
 
 	p.tcpWorker.SetUUID(p.UUID())
 	p.tcpWorker.Listener = SessWorkerListener{
-		OnClose:   p.OnClose,
-		OnSuccess: p.OnSuccess,
-		OnIpAddr:  p.OnIpAddr,
-		ReadAt:    p.tapWorker.DoWrite,
+		OnClose:     p.OnClose,
+		OnSuccess:   p.OnSuccess,
+		OnIpAddr:    p.OnIpAddr,
+		OnReconnect: p.OnReconnect,
+		ReadAt:      p.tapWorker.DoWrite,
 	}
 	p.tcpWorker.Initialize()
+	readAt := p.tcpWorker.DoWrite
+	if p.config.Bond != nil {
+		p.initBond(client)
+		readAt = p.bond.Write
+	}
 
 	p.tapWorker.Listener = TapWorkerListener{
 		OnOpen: func(w *TapWorker) error {
@@ -771,7 +1260,7 @@ func (p *Worker) Initialize() {
 			}
 			return nil
 		},
-		ReadAt:   p.tcpWorker.DoWrite,
+		ReadAt:   readAt,
 		FindDest: p.FindDest,
 	}
 	p.tapWorker.Initialize()
@@ -781,13 +1270,64 @@ func (p *Worker) Initialize() {
 	}
 }
 
+// initBond binds the session and extra paths to one point, and frames
+// from tap are sent on the path selected by bond.
+func (p *Worker) initBond(client libol.SocketClient) {
+	c := p.config.Bond
+	libol.Info("Worker.initBond: %s with %d paths", c.Mode, len(c.Paths))
+
+	p.bond = libol.NewBond(c.Mode, false)
+	p.bond.Add(&libol.BondPath{Client: client, Write: p.tcpWorker.DoWrite})
+	p.tcpWorker.SetBond(p.bond, c, false)
+	p.tcpWorker.Listener.ReadAt = p.ReadBond
+	for _, pc := range c.Paths {
+		ep := &Endpoint{
+			Addr:     pc.Addr,
+			Protocol: pc.Protocol,
+			Local:    pc.Local,
+		}
+		path := p.NewClient(ep)
+		w := NewSessWorker(path, p.config)
+		w.SetUUID(p.UUID())
+		w.SetBond(p.bond, c, true)
+		w.Listener = SessWorkerListener{
+			OnClose:   p.OnClose,
+			OnSuccess: p.OnSuccess,
+			OnIpAddr:  p.OnIpAddr,
+			ReadAt:    p.ReadBond,
+		}
+		w.Initialize()
+		p.bond.Add(&libol.BondPath{Client: path, Write: w.DoWrite})
+		p.paths = append(p.paths, w)
+	}
+}
+
+// ReadBond writes frames from any path to tap, and in order if sequence.
+func (p *Worker) ReadBond(data []byte) error {
+	return p.bond.Input(data, p.tapWorker.DoWrite)
+}
+
+func (p *Worker) Bond() *schema.Bond {
+	return models.NewBondSchema(p.bond)
+}
+
+// Start workers, and never after stopped, since started in background.
 func (p *Worker) Start() {
 	libol.Debug("Worker.Start linux.")
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if p.stopped {
+		return
+	}
 	if !p.initialized {
 		p.Initialize()
 	}
 	p.tapWorker.Start()
 	p.tcpWorker.Start()
+	for _, w := range p.paths {
+		w.Start()
+	}
+	go p.endpoints.Loop(p.OnFailback)
 
 	if p.http != nil {
 		_ = p.http.Start()
@@ -795,6 +1335,9 @@ func (p *Worker) Start() {
 }
 
 func (p *Worker) Stop() {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.stopped = true
 	if p.tapWorker == nil || p.tcpWorker == nil {
 		return
 	}
@@ -803,6 +1346,11 @@ func (p *Worker) Stop() {
 		p.http.Shutdown()
 	}
 	p.FreeIpAddr()
+	p.endpoints.Stop()
+	for _, w := range p.paths {
+		w.Stop()
+	}
+	p.paths = nil
 	p.tcpWorker.Stop()
 	p.tapWorker.Stop()
 	p.tcpWorker = nil
@@ -818,7 +1366,7 @@ func (p *Worker) Client() libol.SocketClient {
 
 func (p *Worker) Device() network.Taper {
 	if p.tapWorker != nil {
-		return p.tapWorker.Device
+		return p.tapWorker.device()
 	}
 	return nil
 }
@@ -855,6 +1403,13 @@ func (p *Worker) IfName() string {
 	return ""
 }
 
+func (p *Worker) Reconnect() schema.Reconnect {
+	if p.tcpWorker != nil {
+		return p.tcpWorker.Reconnect()
+	}
+	return schema.Reconnect{State: RE_STOPPED}
+}
+
 func (p *Worker) Worker() *SessWorker {
 	if p.tcpWorker != nil {
 		return p.tcpWorker
@@ -933,16 +1488,57 @@ func (p *Worker) FreeIpAddr() {
 
 func (p *Worker) OnClose(w *SessWorker) error {
 	libol.Info("Worker.OnClose")
+	if p.bond != nil && p.bond.Select() != nil { // other paths are alive.
+		return nil
+	}
 	p.FreeIpAddr()
 	return nil
 }
 
+// OnReconnect fails over if the active endpoint is unhealthy, or failed
+// to connect again after the immediate retry.
+func (p *Worker) OnReconnect(w *SessWorker) error {
+	active := p.endpoints.Active()
+	if w.Attempts() < 2 && p.endpoints.IsHealthy(active) {
+		return nil
+	}
+	if ep := p.endpoints.Failover(); ep != nil {
+		p.setClient(w, p.NewClient(ep))
+	}
+	return nil
+}
+
+func (p *Worker) OnFailback(ep *Endpoint) {
+	if p.tcpWorker != nil {
+		p.setClient(p.tcpWorker, p.NewClient(ep))
+	}
+}
+
+func (p *Worker) setClient(w *SessWorker, client libol.SocketClient) {
+	old := w.Client
+	w.SetClient(client)
+	if p.bond != nil {
+		p.bond.Replace(old, client)
+	}
+}
+
+func (p *Worker) Endpoints() []schema.Endpoint {
+	if p.endpoints != nil {
+		return p.endpoints.Status()
+	}
+	return nil
+}
+
 func (p *Worker) OnSuccess(w *SessWorker) error {
 	libol.Info("Worker.OnSuccess")
 
 	if p.Listener.AddAddr != nil {
 		_ = p.Listener.AddAddr(p.IfAddr)
 	}
+	// request address by the extra path if the primary is down.
+	if w.extra && w.allowed && p.network == nil {
+		_ = w.Network(w.Client)
+	}
 	return nil
 }
 
@@ -0,0 +1,41 @@
+package api
+
+import (
+	"github.com/danieldin95/openlan-go/libol"
+	"github.com/danieldin95/openlan-go/switch/schema"
+	"github.com/gorilla/mux"
+	"net/http"
+)
+
+type Ban struct {
+	Switcher Switcher
+}
+
+func (h Ban) Router(router *mux.Router) {
+	router.HandleFunc("/api/ban", h.List).Methods("GET")
+	router.HandleFunc("/api/ban", h.Del).Methods("DELETE")
+	router.HandleFunc("/api/ban/{id}", h.Del).Methods("DELETE")
+}
+
+func (h Ban) List(w http.ResponseWriter, r *http.Request) {
+	bans := make([]schema.Ban, 0, 32)
+	for _, b := range h.Switcher.Guard().Bans() {
+		bans = append(bans, schema.Ban{
+			Source: b.Source,
+			Failed: b.Failed,
+			Until:  b.Until.Unix(),
+		})
+	}
+	ResponseJson(w, bans)
+}
+
+// Del clears the ban of source, and all if not given.
+func (h Ban) Del(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	libol.Info("DelBan %s", vars["id"])
+	if !h.Switcher.Guard().Unban(vars["id"]) {
+		http.Error(w, vars["id"], http.StatusNotFound)
+		return
+	}
+	ResponseMsg(w, 0, "")
+}
@@ -1,9 +1,12 @@
 package api
 
 import (
+	"encoding/json"
+	"github.com/danieldin95/openlan-go/libol"
 	"github.com/danieldin95/openlan-go/switch/schema"
 	"github.com/danieldin95/openlan-go/switch/storage"
 	"github.com/gorilla/mux"
+	"io/ioutil"
 	"net/http"
 )
 
@@ -12,7 +15,9 @@ type Lease struct {
 
 func (l Lease) Router(router *mux.Router) {
 	router.HandleFunc("/api/lease", l.List).Methods("GET")
-	router.HandleFunc("/api/lease/{id}", l.List).Methods("GET")
+	router.HandleFunc("/api/lease/{id}", l.Get).Methods("GET")
+	router.HandleFunc("/api/lease/{id}", l.Add).Methods("POST")
+	router.HandleFunc("/api/lease/{id}", l.Del).Methods("DELETE")
 }
 
 func (l Lease) List(w http.ResponseWriter, r *http.Request) {
@@ -25,3 +30,57 @@ func (l Lease) List(w http.ResponseWriter, r *http.Request) {
 	}
 	ResponseJson(w, nets)
 }
+
+// Get finds the lease by uuid, user@network or address.
+func (l Lease) Get(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	if lease := storage.Network.GetLease(vars["id"]); lease != nil {
+		ResponseJson(w, lease)
+	} else {
+		http.Error(w, vars["id"], http.StatusNotFound)
+	}
+}
+
+// Add reserves the address for the point by uuid, or the user by name
+// likes user@network.
+func (l Lease) Add(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	defer r.Body.Close()
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	lease := &schema.Lease{}
+	if err := json.Unmarshal(body, lease); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if lease.Network == "" || lease.Address == "" {
+		http.Error(w, "network and address are required", http.StatusBadRequest)
+		return
+	}
+	libol.Info("AddLease %s %s on %s", vars["id"], lease.Address, lease.Network)
+	if _, err := storage.Network.Reserve(vars["id"], lease.Network, lease.Address); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	ResponseJson(w, storage.Network.GetLease(vars["id"]))
+}
+
+// Del releases the lease by uuid, user@network or address, and refuses
+// if the address is used by a point online.
+func (l Lease) Del(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	libol.Info("DelLease %s", vars["id"])
+	if storage.Network.GetLease(vars["id"]) == nil {
+		http.Error(w, vars["id"], http.StatusNotFound)
+		return
+	}
+	if err := storage.Network.Release(vars["id"]); err != nil {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	ResponseMsg(w, 0, "")
+}
@@ -48,6 +48,7 @@ func (h Link) Get(w http.ResponseWriter, r *http.Request) {
 }
 
 func (h Link) Add(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
 	defer r.Body.Close()
 	body, err := ioutil.ReadAll(r.Body)
 	if err != nil {
@@ -57,18 +58,38 @@ func (h Link) Add(w http.ResponseWriter, r *http.Request) {
 
 	c := &config.Point{}
 	if err := json.Unmarshal([]byte(body), c); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if c.Addr == "" {
+		c.Addr = vars["id"]
+	}
+	if c.Addr == "" || c.Network == "" {
+		http.Error(w, "connection and network are required", http.StatusBadRequest)
 		return
 	}
-
 	c.Default()
-	h.Switcher.AddLink(c.Network, c)
-	ResponseMsg(w, 0, "")
+	libol.Info("AddLink %s on %s", c.Addr, c.Network)
+	if err := h.Switcher.AddLink(c.Network, c); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if link := storage.Link.Get(c.Addr); link != nil {
+		ResponseJson(w, models.NewLinkSchema(link))
+	} else {
+		http.Error(w, c.Addr, http.StatusNotFound)
+	}
 }
 
 func (h Link) Del(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	libol.Info("DelLink %s", vars["id"])
-	h.Switcher.DelLink("", vars["id"])
+
+	addr := vars["id"]
+	config.RightAddr(&addr, 10002)
+	if err := h.Switcher.DelLink("", addr); err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
 	ResponseMsg(w, 0, "")
 }
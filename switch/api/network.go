@@ -1,19 +1,29 @@
 package api
 
 import (
+	"encoding/json"
+	"github.com/danieldin95/openlan-go/libol"
+	"github.com/danieldin95/openlan-go/main/config"
 	"github.com/danieldin95/openlan-go/models"
 	"github.com/danieldin95/openlan-go/switch/schema"
 	"github.com/danieldin95/openlan-go/switch/storage"
 	"github.com/gorilla/mux"
+	"io/ioutil"
+	"net"
 	"net/http"
+	"strings"
 )
 
 type Network struct {
+	Switcher Switcher
 }
 
 func (h Network) Router(router *mux.Router) {
 	router.HandleFunc("/api/network", h.List).Methods("GET")
 	router.HandleFunc("/api/network/{id}", h.Get).Methods("GET")
+	router.HandleFunc("/api/network/{id}", h.Add).Methods("POST")
+	router.HandleFunc("/api/network/{id}", h.Mod).Methods("PUT")
+	router.HandleFunc("/api/network/{id}", h.Del).Methods("DELETE")
 }
 
 func (h Network) List(w http.ResponseWriter, r *http.Request) {
@@ -36,3 +46,123 @@ func (h Network) Get(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, vars["id"], http.StatusNotFound)
 	}
 }
+
+// read returns the configuration of network in body, and the name is same
+// as id.
+func (h Network) read(r *http.Request) (*config.Network, error) {
+	vars := mux.Vars(r)
+	defer r.Body.Close()
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return nil, err
+	}
+	c := &config.Network{}
+	if err := json.Unmarshal(body, c); err != nil {
+		return nil, err
+	}
+	if c.Name == "" {
+		c.Name = vars["id"]
+	}
+	if c.Name != vars["id"] {
+		return nil, libol.NewErr("name %s not same as %s", c.Name, vars["id"])
+	}
+	if err := checkNetwork(c); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func checkNetwork(c *config.Network) error {
+	if c.Bridge.Address != "" {
+		if _, _, err := net.ParseCIDR(c.Bridge.Address); err != nil {
+			return libol.NewErr("invalid bridge address %s", c.Bridge.Address)
+		}
+	}
+	if s := c.Subnet; s.Netmask != "" {
+		for _, v := range []string{s.Start, s.End, s.Netmask} {
+			if ip := net.ParseIP(v); ip == nil || ip.To4() == nil {
+				return libol.NewErr("invalid subnet %s", v)
+			}
+		}
+	}
+	for _, ex := range c.Subnet.Exclude {
+		for _, v := range strings.SplitN(ex, "-", 2) {
+			if ip := net.ParseIP(strings.TrimSpace(v)); ip == nil || ip.To4() == nil {
+				return libol.NewErr("invalid exclude %s", ex)
+			}
+		}
+	}
+	for _, rv := range c.Subnet.Reserved {
+		if rv.UUID == "" && rv.Username == "" {
+			return libol.NewErr("uuid or username of reserved is required")
+		}
+		if ip := net.ParseIP(rv.Address); ip == nil || ip.To4() == nil {
+			return libol.NewErr("invalid reserved %s", rv.Address)
+		}
+	}
+	for _, rt := range c.Routes {
+		if _, _, err := net.ParseCIDR(rt.Prefix); err != nil {
+			return libol.NewErr("invalid route %s", rt.Prefix)
+		}
+		if rt.NextHop != "" && net.ParseIP(rt.NextHop) == nil {
+			return libol.NewErr("invalid nexthop %s", rt.NextHop)
+		}
+	}
+	for _, pass := range c.Password {
+		if pass.Username == "" {
+			return libol.NewErr("username is required")
+		}
+	}
+	for _, link := range c.Links {
+		if link.Addr == "" {
+			return libol.NewErr("connection of link is required")
+		}
+	}
+	return nil
+}
+
+func (h Network) response(w http.ResponseWriter, name string) {
+	if n := storage.Network.Get(name); n != nil {
+		ResponseJson(w, models.NewNetworkSchema(n))
+	} else {
+		ResponseMsg(w, 0, "")
+	}
+}
+
+func (h Network) Add(w http.ResponseWriter, r *http.Request) {
+	c, err := h.read(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	libol.Info("AddNetwork %s", c.Name)
+	if err := h.Switcher.AddNetwork(c); err != nil {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	h.response(w, c.Name)
+}
+
+func (h Network) Mod(w http.ResponseWriter, r *http.Request) {
+	c, err := h.read(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	libol.Info("ModNetwork %s", c.Name)
+	if err := h.Switcher.ModNetwork(c); err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	h.response(w, c.Name)
+}
+
+func (h Network) Del(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	libol.Info("DelNetwork %s", vars["id"])
+	if err := h.Switcher.DelNetwork(vars["id"]); err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	ResponseMsg(w, 0, "")
+}
@@ -0,0 +1,86 @@
+package api
+
+import (
+	"github.com/danieldin95/openlan-go/libol"
+	"github.com/danieldin95/openlan-go/main/config"
+	"github.com/danieldin95/openlan-go/switch/schema"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type fakeSwitcher struct {
+	nets map[string]*config.Network
+}
+
+func (s *fakeSwitcher) UUID() string                                 { return "" }
+func (s *fakeSwitcher) UpTime() int64                                { return 0 }
+func (s *fakeSwitcher) Alias() string                                { return "" }
+func (s *fakeSwitcher) AddLink(tenant string, c *config.Point) error { return nil }
+func (s *fakeSwitcher) DelLink(tenant, addr string) error            { return nil }
+func (s *fakeSwitcher) Reload() error                                { return nil }
+func (s *fakeSwitcher) Config() *config.Switch                       { return nil }
+func (s *fakeSwitcher) Servers() []libol.SocketServer                { return nil }
+func (s *fakeSwitcher) Listeners() []schema.Listener                 { return nil }
+func (s *fakeSwitcher) Guard() *libol.Guard                          { return nil }
+
+func (s *fakeSwitcher) AddNetwork(c *config.Network) error {
+	if _, ok := s.nets[c.Name]; ok {
+		return libol.NewErr("network %s already existed", c.Name)
+	}
+	s.nets[c.Name] = c
+	return nil
+}
+
+func (s *fakeSwitcher) ModNetwork(c *config.Network) error {
+	if _, ok := s.nets[c.Name]; !ok {
+		return libol.NewErr("network %s not found", c.Name)
+	}
+	s.nets[c.Name] = c
+	return nil
+}
+
+func (s *fakeSwitcher) DelNetwork(name string) error {
+	if _, ok := s.nets[name]; !ok {
+		return libol.NewErr("network %s not found", name)
+	}
+	delete(s.nets, name)
+	return nil
+}
+
+func doRequest(router *mux.Router, method, url, body string) int {
+	req := httptest.NewRequest(method, url, strings.NewReader(body))
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w.Code
+}
+
+func TestNetwork_Handler(t *testing.T) {
+	sw := &fakeSwitcher{nets: make(map[string]*config.Network, 4)}
+	router := mux.NewRouter()
+	Network{Switcher: sw}.Router(router)
+
+	body := `{"subnet": {"start": "172.32.0.10", "end": "172.32.0.20", "netmask": "255.255.255.0"}}`
+	assert.Equal(t, http.StatusOK, doRequest(router, "POST", "/api/network/example", body), "added.")
+	assert.Equal(t, "example", sw.nets["example"].Name, "name by id.")
+	assert.Equal(t, http.StatusConflict, doRequest(router, "POST", "/api/network/example", body), "existed.")
+	assert.Equal(t, http.StatusBadRequest, doRequest(router, "POST", "/api/network/other", "{"), "broken.")
+	assert.Equal(t, http.StatusBadRequest, doRequest(router, "POST", "/api/network/other", `{"name": "example"}`), "not same.")
+	assert.Equal(t, http.StatusBadRequest, doRequest(router, "POST", "/api/network/other",
+		`{"subnet": {"start": "172.32.0.10", "end": "x", "netmask": "255.255.255.0"}}`), "invalid subnet.")
+	assert.Equal(t, http.StatusBadRequest, doRequest(router, "POST", "/api/network/other",
+		`{"links": [{"protocol": "tcp"}]}`), "link without connection.")
+	_, ok := sw.nets["other"]
+	assert.False(t, ok, "not added.")
+
+	body = `{"routes": [{"prefix": "192.168.0.0/24"}]}`
+	assert.Equal(t, http.StatusOK, doRequest(router, "PUT", "/api/network/example", body), "modified.")
+	assert.Equal(t, 1, len(sw.nets["example"].Routes), "modified.")
+	assert.Equal(t, http.StatusNotFound, doRequest(router, "PUT", "/api/network/other", body), "not found.")
+
+	assert.Equal(t, http.StatusOK, doRequest(router, "DELETE", "/api/network/example", ""), "deleted.")
+	assert.Equal(t, http.StatusNotFound, doRequest(router, "DELETE", "/api/network/example", ""), "not found.")
+}
@@ -1,6 +1,7 @@
 package api
 
 import (
+	"github.com/danieldin95/openlan-go/libol"
 	"github.com/danieldin95/openlan-go/main/config"
 	"github.com/danieldin95/openlan-go/switch/schema"
 )
@@ -9,9 +10,16 @@ type Switcher interface {
 	UUID() string
 	UpTime() int64
 	Alias() string
-	AddLink(tenant string, c *config.Point)
-	DelLink(tenant, addr string)
+	AddLink(tenant string, c *config.Point) error
+	DelLink(tenant, addr string) error
+	AddNetwork(c *config.Network) error
+	ModNetwork(c *config.Network) error
+	DelNetwork(name string) error
+	Reload() error
 	Config() *config.Switch
+	Servers() []libol.SocketServer
+	Listeners() []schema.Listener
+	Guard() *libol.Guard
 }
 
 func NewWorkerSchema(s Switcher) schema.Worker {
@@ -0,0 +1,145 @@
+package app
+
+import (
+	"github.com/danieldin95/openlan-go/libol"
+	"github.com/danieldin95/openlan-go/main/config"
+	"sync"
+	"time"
+)
+
+// beat is the state of a client, and idle counts the intervals nothing
+// received.
+type beat struct {
+	rx   uint64
+	idle int
+	ping bool // pinged us, and answers pings.
+}
+
+// Heartbeat answers pings, and pings the clients have pinged it. The
+// client pinged is closed if missed too many pings, or silent for as many
+// intervals, and others never since they may not ping.
+type Heartbeat struct {
+	lock     sync.Mutex
+	clients  map[libol.SocketClient]*beat
+	interval time.Duration
+	missed   int
+	done     chan bool
+	once     sync.Once
+
+	master Master
+}
+
+func NewHeartbeat(m Master, c config.Switch) (h *Heartbeat) {
+	h = &Heartbeat{
+		master:   m,
+		clients:  make(map[libol.SocketClient]*beat, 1024),
+		interval: 10 * time.Second,
+		missed:   3,
+		done:     make(chan bool),
+	}
+	if c.Heartbeat != nil {
+		h.interval = time.Duration(c.Heartbeat.Interval) * time.Second
+		h.missed = c.Heartbeat.Missed
+	}
+	return
+}
+
+// OnClient tracks the client accepted, and it is closed if silent.
+func (h *Heartbeat) OnClient(client libol.SocketClient) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	h.clients[client] = &beat{rx: client.Sts().RxOkay}
+}
+
+func (h *Heartbeat) OnFrame(client libol.SocketClient, frame *libol.FrameMessage) error {
+	if !frame.IsControl() {
+		return nil
+	}
+	action, params := frame.CmdAndParams()
+	switch action {
+	case "ping=":
+		if client.Status() == libol.CL_AUEHED {
+			h.lock.Lock()
+			if b, ok := h.clients[client]; ok {
+				b.ping = true
+			} else {
+				h.clients[client] = &beat{rx: client.Sts().RxOkay, ping: true}
+			}
+			h.lock.Unlock()
+		}
+		if err := client.Pong(params); err != nil {
+			libol.Error("Heartbeat.OnFrame: %s %s", client, err)
+		}
+	case "pong:":
+		client.OnPong(params)
+	default:
+		return nil
+	}
+	// heartbeat is consumed, and not for others.
+	return libol.NewErr("heartbeat")
+}
+
+func (h *Heartbeat) Start() {
+	libol.Info("Heartbeat.Start: every %s", h.interval)
+	ticker := time.NewTicker(h.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-h.done:
+			return
+		case <-ticker.C:
+			h.pingAll()
+		}
+	}
+}
+
+func (h *Heartbeat) Stop() {
+	h.once.Do(func() {
+		close(h.done)
+	})
+}
+
+// pingAll updates the clients under lock, and pings or closes them out of
+// lock, so a blocked client never blocks others.
+func (h *Heartbeat) pingAll() {
+	pings := make([]libol.SocketClient, 0, 32)
+	silent := make([]libol.SocketClient, 0, 32)
+	h.lock.Lock()
+	for client, b := range h.clients {
+		if !client.IsOk() {
+			delete(h.clients, client)
+			continue
+		}
+		if rx := client.Sts().RxOkay; rx != b.rx {
+			b.rx = rx
+			b.idle = 0
+		} else {
+			b.idle++
+		}
+		if !b.ping {
+			continue
+		}
+		if b.idle >= h.missed {
+			delete(h.clients, client)
+			silent = append(silent, client)
+		} else if client.Status() == libol.CL_AUEHED {
+			pings = append(pings, client)
+		}
+	}
+	h.lock.Unlock()
+
+	for _, client := range silent {
+		libol.Warn("Heartbeat.pingAll: %s silent for %d intervals", client, h.missed)
+		h.master.OffClient(client)
+	}
+	for _, client := range pings {
+		missed, err := client.Ping()
+		if err != nil || missed >= h.missed {
+			libol.Warn("Heartbeat.pingAll: %s missed %d pings", client, missed)
+			h.lock.Lock()
+			delete(h.clients, client)
+			h.lock.Unlock()
+			h.master.OffClient(client)
+		}
+	}
+}
@@ -0,0 +1,53 @@
+package app
+
+import (
+	"github.com/danieldin95/openlan-go/libol"
+	"github.com/danieldin95/openlan-go/main/config"
+	"github.com/danieldin95/openlan-go/network"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"io/ioutil"
+	"net"
+	"testing"
+)
+
+type fakeMaster struct {
+	offs []libol.SocketClient
+}
+
+func (m *fakeMaster) ReadTap(dev network.Taper, readAt func(p []byte) error) {}
+func (m *fakeMaster) NewTap(tenant string) (network.Taper, error)            { return nil, nil }
+func (m *fakeMaster) UUID() string                                           { return "" }
+func (m *fakeMaster) Allowed(client libol.SocketClient, network string) bool { return true }
+func (m *fakeMaster) Guard() *libol.Guard                                    { return nil }
+
+func (m *fakeMaster) OffClient(client libol.SocketClient) {
+	m.offs = append(m.offs, client)
+}
+
+func newPipeClient(t *testing.T) libol.SocketClient {
+	local, remote := net.Pipe()
+	go func() {
+		_, _ = io.Copy(ioutil.Discard, remote)
+	}()
+	return libol.NewTcpClientFromConn(local)
+}
+
+func TestHeartbeat_Silent(t *testing.T) {
+	m := &fakeMaster{}
+	h := NewHeartbeat(m, config.Switch{})
+	pinged := newPipeClient(t)
+	legacy := newPipeClient(t)
+	defer pinged.Close()
+	defer legacy.Close()
+	h.OnClient(pinged)
+	h.OnClient(legacy)
+	h.clients[pinged].ping = true
+
+	for i := 0; i < h.missed; i++ {
+		h.pingAll()
+	}
+	assert.Equal(t, []libol.SocketClient{pinged}, m.offs, "only pinged closed.")
+	_, ok := h.clients[legacy]
+	assert.True(t, ok, "legacy kept.")
+}
@@ -0,0 +1,123 @@
+package app
+
+import (
+	"encoding/json"
+	"github.com/danieldin95/openlan-go/libol"
+	"github.com/danieldin95/openlan-go/main/config"
+	"github.com/danieldin95/openlan-go/models"
+	"sync"
+)
+
+type helloNetwork struct {
+	mtu      int
+	compress bool
+	crypt    bool
+}
+
+type Hello struct {
+	lock     sync.RWMutex
+	networks map[string]helloNetwork // guarded by lock.
+	interval int                     // seconds of heartbeat.
+	master   Master
+}
+
+func NewHello(m Master, c config.Switch) (h *Hello) {
+	h = &Hello{
+		master:   m,
+		networks: make(map[string]helloNetwork, 32),
+		interval: 10,
+	}
+	if c.Heartbeat != nil {
+		h.interval = c.Heartbeat.Interval
+	}
+	for _, n := range c.Network {
+		h.Update(n)
+	}
+	return
+}
+
+// Update applies the mtu, the compression and the crypt of network, which
+// is added or changed at runtime.
+func (h *Hello) Update(n *config.Network) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	h.networks[n.Name] = helloNetwork{
+		mtu:      n.Bridge.Mtu,
+		compress: n.Compress != "",
+		crypt:    n.Crypt != nil,
+	}
+}
+
+// Remove forgets the network removed at runtime.
+func (h *Hello) Remove(name string) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	delete(h.networks, name)
+}
+
+// local returns the max mtu of bridges, and the features supported by
+// any network.
+func (h *Hello) local() *models.Hello {
+	h.lock.RLock()
+	defer h.lock.RUnlock()
+	maxSize := 1514
+	compress, crypt := false, false
+	for _, n := range h.networks {
+		if n.mtu > maxSize {
+			maxSize = n.mtu
+		}
+		compress = compress || n.compress
+		crypt = crypt || n.crypt
+	}
+	features := []string{models.FeatBeat, models.FeatBond, models.FeatMux}
+	if compress {
+		features = append(features, models.FeatCompress)
+	}
+	if crypt {
+		features = append(features, models.FeatCrypt)
+	}
+	local := models.NewHello(maxSize, features...)
+	local.Interval = h.interval
+	return local
+}
+
+func (h *Hello) OnFrame(client libol.SocketClient, frame *libol.FrameMessage) error {
+	if !frame.IsControl() {
+		return nil
+	}
+	action, params := frame.CmdAndParams()
+	if action != "hell=" {
+		return nil
+	}
+	if err := h.handleHello(client, params); err != nil {
+		libol.Error("Hello.OnFrame: %s %s", client, err)
+		_ = client.WriteResp("hello", err.Error())
+		client.Close()
+	}
+	// hello is consumed, and not for others.
+	return libol.NewErr("hello")
+}
+
+func (h *Hello) handleHello(client libol.SocketClient, data string) error {
+	if client.Status() == libol.CL_AUEHED {
+		return libol.NewErr("hello after login")
+	}
+	peer := &models.Hello{}
+	if err := json.Unmarshal([]byte(data), peer); err != nil {
+		return libol.NewErr("Invalid json data.")
+	}
+	hello, err := h.local().Negotiate(peer)
+	if err != nil {
+		return err
+	}
+	if !hello.Has(models.FeatBeat) {
+		hello.Interval = 0
+	}
+	body, err := json.Marshal(hello)
+	if err != nil {
+		return err
+	}
+	client.SetMaxSize(hello.MaxSize)
+	libol.Info("Hello.handleHello: %s %s", client, hello)
+	return client.WriteResp("hello", string(body))
+}
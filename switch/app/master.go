@@ -10,4 +10,6 @@ type Master interface {
 	NewTap(tenant string) (network.Taper, error)
 	UUID() string
 	OffClient(client libol.SocketClient)
+	Allowed(client libol.SocketClient, network string) bool
+	Guard() *libol.Guard
 }
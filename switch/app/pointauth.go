@@ -1,28 +1,90 @@
 package app
 
 import (
+	"encoding/base64"
 	"encoding/json"
 	"github.com/danieldin95/openlan-go/libol"
 	"github.com/danieldin95/openlan-go/main/config"
 	"github.com/danieldin95/openlan-go/models"
 	"github.com/danieldin95/openlan-go/switch/storage"
 	"strings"
+	"sync"
+	"time"
 )
 
 type PointAuth struct {
-	success int
-	failed  int
+	success  int
+	failed   int
+	lock     sync.RWMutex
+	crypts   map[string]*config.Crypt // guarded by lock.
+	compress map[string]string        // guarded by lock.
+	mtus     map[string]int           // guarded by lock.
+	queue    config.Queue
 
 	master Master
 }
 
 func NewPointAuth(m Master, c config.Switch) (p *PointAuth) {
 	p = &PointAuth{
-		master: m,
+		master:   m,
+		crypts:   make(map[string]*config.Crypt, 32),
+		compress: make(map[string]string, 32),
+		mtus:     make(map[string]int, 32),
+	}
+	if c.Queue != nil {
+		p.queue = *c.Queue
+	}
+	p.queue.Right()
+	for _, n := range c.Network {
+		p.Update(n)
 	}
 	return
 }
 
+// Update applies the crypt, the compression and the mtu of network, which
+// is added or changed at runtime.
+func (p *PointAuth) Update(n *config.Network) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	delete(p.crypts, n.Name)
+	delete(p.compress, n.Name)
+	if n.Crypt != nil {
+		p.crypts[n.Name] = n.Crypt
+	}
+	if n.Compress != "" {
+		p.compress[n.Name] = n.Compress
+	}
+	p.mtus[n.Name] = n.Bridge.Mtu
+}
+
+// Remove forgets the network removed at runtime.
+func (p *PointAuth) Remove(name string) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	delete(p.crypts, name)
+	delete(p.compress, name)
+	delete(p.mtus, name)
+}
+
+func (p *PointAuth) getCrypt(network string) *config.Crypt {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+	return p.crypts[network]
+}
+
+func (p *PointAuth) getCompress(network string) string {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+	return p.compress[network]
+}
+
+func (p *PointAuth) getMtu(network string) (int, bool) {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+	mtu, ok := p.mtus[network]
+	return mtu, ok
+}
+
 func (p *PointAuth) OnFrame(client libol.SocketClient, frame *libol.FrameMessage) error {
 	libol.Log("PointAuth.OnFrame %s.", frame)
 
@@ -32,13 +94,30 @@ func (p *PointAuth) OnFrame(client libol.SocketClient, frame *libol.FrameMessage
 
 		switch action {
 		case "logi=":
-			if err := p.handleLogin(client, params); err != nil {
+			user, err := p.handleLogin(client, params)
+			if err == nil && user != nil && !p.master.Allowed(client, user.Network) {
+				client.SetStatus(libol.CL_UNAUTH)
+				err = libol.NewErr("Network not allowed.")
+			}
+			if err == nil && user != nil {
+				err = p.handleAccepted(client, user)
+			}
+			source := libol.SourceIP(client.Addr())
+			if err != nil {
 				libol.Error("PointAuth.OnFrame: %s", err)
+				if p.master.Guard().OnFailed(source) {
+					libol.Warn("PointAuth.OnFrame: %s banned", source)
+				}
 				_ = client.WriteResp("login", err.Error())
 				client.Close()
 				return err
 			}
-			_ = client.WriteResp("login", "okay.")
+			p.master.Guard().OnSuccess(source)
+			if user != nil {
+				_ = p.onAuth(client, user)
+			} else {
+				_ = client.WriteResp("login", "okay.")
+			}
 		}
 
 		//If instruct is not login, continue to process.
@@ -47,24 +126,26 @@ func (p *PointAuth) OnFrame(client libol.SocketClient, frame *libol.FrameMessage
 
 	//Dropped all frames if not auth.
 	if client.Status() != libol.CL_AUEHED {
-		libol.Debug("PointAuth.onRead: %s unAuth", client.Addr)
+		libol.Debug("PointAuth.onRead: %s unAuth", client.Addr())
 		return libol.NewErr("unAuth client.")
 	}
 
 	return nil
 }
 
-func (p *PointAuth) handleLogin(client libol.SocketClient, data string) error {
+// handleLogin returns the user if auth success, and nil if already auth.
+// The client is marked as auth by handleAccepted after crypt enabled.
+func (p *PointAuth) handleLogin(client libol.SocketClient, data string) (*models.User, error) {
 	libol.Debug("PointAuth.handleLogin: %s", data)
 
 	if client.Status() == libol.CL_AUEHED {
 		libol.Warn("PointAuth.handleLogin: already auth %s", client)
-		return nil
+		return nil, nil
 	}
 
 	user := models.NewUser("", "")
 	if err := json.Unmarshal([]byte(data), user); err != nil {
-		return libol.NewErr("Invalid json data.")
+		return nil, libol.NewErr("Invalid json data.")
 	}
 
 	name := user.Name
@@ -81,20 +162,153 @@ func (p *PointAuth) handleLogin(client libol.SocketClient, data string) error {
 	if user.Token != "" {
 		name = user.Token
 	}
+	if certName := p.certName(client, name, user.Network); certName != "" {
+		if storage.User.Get(certName) != nil {
+			p.success++
+			if user.Network == "" {
+				user.Network = strings.SplitN(certName, "@", 2)[1]
+			}
+			user.Name = certName
+			libol.Info("PointAuth.handleLogin: %s auth by certificate %s", client.Addr(), certName)
+			return user, nil
+		}
+	}
 	libol.Info("PointAuth.handleLogin: %s on %s", name, user.Alias)
 	nowUser := storage.User.Get(name)
 	if nowUser != nil {
 		if nowUser.Password == user.Password {
 			p.success++
-			client.SetStatus(libol.CL_AUEHED)
 			libol.Info("PointAuth.handleLogin: %s auth", client.Addr())
-			_ = p.onAuth(client, user)
-			return nil
+			return user, nil
 		}
 	}
 	p.failed++
 	client.SetStatus(libol.CL_UNAUTH)
-	return libol.NewErr("Auth failed.")
+	return nil, libol.NewErr("Auth failed.")
+}
+
+// certName returns the name likes user@network in the certificate of
+// client, which is the same as name and network if given.
+func (p *PointAuth) certName(client libol.SocketClient, name, network string) string {
+	certs := client.PeerCerts()
+	if len(certs) == 0 {
+		return ""
+	}
+	for _, cn := range libol.CertNames(certs[0]) {
+		values := strings.SplitN(cn, "@", 2)
+		if len(values) != 2 || values[0] == "" || values[1] == "" {
+			continue
+		}
+		if name != "" && name != cn {
+			continue
+		}
+		if network != "" && network != values[1] {
+			continue
+		}
+		return cn
+	}
+	return ""
+}
+
+// handleAccepted replies login with accepted options, and enables them
+// after reply, so the frames from tap are sent after it. The client is
+// marked as auth at last, so nothing is sent in cleartext after crypt.
+func (p *PointAuth) handleAccepted(client libol.SocketClient, user *models.User) error {
+	accepted := models.Accepted{}
+	crypt, err := p.handleCrypt(client, user, &accepted)
+	if err != nil {
+		return err
+	}
+	compress := ""
+	if user.Compress != "" && user.Compress == p.getCompress(user.Network) {
+		compress = user.Compress
+		accepted.Compress = compress
+	}
+
+	// clamp the frame negotiated in hello to mtu of bridge.
+	if mtu, ok := p.getMtu(user.Network); ok && mtu > 0 && client.MaxSize() > mtu {
+		accepted.MaxSize = mtu
+	}
+
+	if user.Bond != nil {
+		accepted.Bond = &models.Bond{
+			Mode:     user.Bond.Mode,
+			Sequence: user.Bond.Sequence,
+		}
+		om, err := p.bonded(client, user)
+		if err != nil {
+			client.SetStatus(libol.CL_UNAUTH)
+			return err
+		}
+		if om != nil {
+			accepted.Bond.Mode = om.Bond.Mode()
+			accepted.Bond.Sequence = om.Bond.Sequence()
+		}
+	}
+
+	resp := "okay."
+	if accepted.Crypt != nil || accepted.Compress != "" || accepted.MaxSize > 0 || accepted.Bond != nil {
+		body, _ := json.Marshal(&accepted)
+		resp += " " + string(body)
+	}
+	if err := client.WriteResp("login", resp); err != nil {
+		return err
+	}
+	if crypt != nil {
+		client.SetCrypt(crypt)
+		libol.Info("PointAuth.handleAccepted: %s %s enabled", client, crypt.Algo())
+	}
+	if compress != "" {
+		client.SetCompress(compress)
+		libol.Info("PointAuth.handleAccepted: %s %s enabled", client, compress)
+	}
+	if accepted.MaxSize > 0 {
+		client.SetMaxSize(accepted.MaxSize)
+		libol.Info("PointAuth.handleAccepted: %s maxSize clamped to %d", client, accepted.MaxSize)
+	}
+	if accepted.Bond != nil && accepted.Bond.Sequence {
+		client.SetMaxSize(client.MaxSize() + libol.BONDSEQ)
+	}
+	client.SetStatus(libol.CL_AUEHED)
+	return nil
+}
+
+func (p *PointAuth) handleCrypt(client libol.SocketClient, user *models.User, accepted *models.Accepted) (*libol.Crypt, error) {
+	conf := p.getCrypt(user.Network)
+	if user.Crypt == nil {
+		if conf != nil && conf.Algo != "" {
+			client.SetStatus(libol.CL_UNAUTH)
+			return nil, libol.NewErr("Crypt required.")
+		}
+		return nil, nil
+	}
+
+	secret := ""
+	if conf != nil {
+		secret = conf.Secret
+	}
+	peer, err := base64.StdEncoding.DecodeString(user.Crypt.PubKey)
+	if err != nil {
+		return nil, libol.NewErr("Invalid public key.")
+	}
+	key, err := libol.NewCryptKey()
+	if err != nil {
+		return nil, err
+	}
+	shared, err := key.Shared(peer)
+	if err != nil {
+		return nil, libol.NewErr("Invalid public key.")
+	}
+	crypt, err := libol.NewCrypt(user.Crypt.Algo, shared, secret, true)
+	if err != nil {
+		client.SetStatus(libol.CL_UNAUTH)
+		return nil, err
+	}
+	accepted.Crypt = &models.Crypt{
+		Algo:   user.Crypt.Algo,
+		PubKey: base64.StdEncoding.EncodeToString(key.Public()),
+	}
+	return crypt, nil
 }
 
 func (p *PointAuth) onAuth(client libol.SocketClient, user *models.User) error {
@@ -103,6 +317,9 @@ func (p *PointAuth) onAuth(client libol.SocketClient, user *models.User) error {
 	}
 
 	libol.Info("PointAuth.onAuth: %s", client)
+	if om, _ := p.bonded(client, user); om != nil {
+		return p.onPath(client, om)
+	}
 	dev, err := p.master.NewTap(user.Network)
 	if err != nil {
 		return err
@@ -111,22 +328,111 @@ func (p *PointAuth) onAuth(client libol.SocketClient, user *models.User) error {
 	m.Alias = user.Alias
 	m.UUID = user.UUID
 	m.Network = user.Network
+	m.User = user.Name
 	if m.UUID == "" {
 		m.UUID = user.Alias
 	}
 
 	// free point has same uuid.
 	if om := storage.Point.GetByUUID(m.UUID); om != nil {
-		p.master.OffClient(om.Client)
+		p.offPoint(om)
 	}
 
+	m.Queue = p.newQueue(client)
 	client.SetPrivate(m)
+	if user.Bond != nil {
+		m.Bond = libol.NewBond(user.Bond.Mode, user.Bond.Sequence)
+		m.Bond.Add(p.newPath(client, m.Queue))
+		libol.Info("PointAuth.onAuth: %s bonded by %s", m.UUID, m.Bond.Mode())
+	}
 	storage.Point.Add(m)
-	go p.master.ReadTap(dev, client.WriteMsg)
+	go m.Queue.Loop()
+	if m.Bond != nil {
+		go p.master.ReadTap(dev, func(data []byte) error {
+			if err := m.Bond.Write(data); err != nil {
+				libol.Debug("PointAuth.onAuth: %s %s", m.UUID, err)
+			}
+			return nil
+		})
+		return nil
+	}
+	go p.master.ReadTap(dev, func(data []byte) error {
+		if err := m.Queue.Push(data); err != nil {
+			p.master.OffClient(client)
+			return err
+		}
+		return nil
+	})
+
+	return nil
+}
+
+// bonded returns the point the user joins as a path of bond, and nil if
+// not bonded. The path must be logged in by the same user, and the same
+// certificate if any, or else it is an error.
+func (p *PointAuth) bonded(client libol.SocketClient, user *models.User) (*models.Point, error) {
+	if user.Bond == nil {
+		return nil, nil
+	}
+	uuid := user.UUID
+	if uuid == "" {
+		uuid = user.Alias
+	}
+	om := storage.Point.GetByUUID(uuid)
+	if om == nil || om.Bond == nil || om.Network != user.Network {
+		return nil, nil
+	}
+	if storage.UserName(om.User, om.Network) != storage.UserName(user.Name, user.Network) {
+		return nil, libol.NewErr("Bonded by other user.")
+	}
+	if p.certName(om.Client, "", om.Network) != p.certName(client, "", user.Network) {
+		return nil, libol.NewErr("Bonded by other certificate.")
+	}
+	return om, nil
+}
 
+// onPath adds the client as a path of the bonded point, which shares the
+// tap device and address with other paths.
+func (p *PointAuth) onPath(client libol.SocketClient, m *models.Point) error {
+	libol.Info("PointAuth.onPath: %s to %s", client, m.UUID)
+	queue := p.newQueue(client)
+	client.SetPrivate(m)
+	m.Bond.Add(p.newPath(client, queue))
+	storage.Point.AddPath(m, client)
+	go queue.Loop()
 	return nil
 }
 
+func (p *PointAuth) newQueue(client libol.SocketClient) *libol.SendQueue {
+	q := p.queue
+	return libol.NewSendQueue(client, q.Length, q.Policy, time.Duration(q.Timeout)*time.Second)
+}
+
+func (p *PointAuth) newPath(client libol.SocketClient, queue *libol.SendQueue) *libol.BondPath {
+	return &libol.BondPath{
+		Client: client,
+		Queue:  queue,
+		Write: func(data []byte) error {
+			if err := queue.Push(data); err != nil {
+				p.master.OffClient(client)
+				return err
+			}
+			return nil
+		},
+	}
+}
+
+// offPoint frees the point, and all paths if bonded.
+func (p *PointAuth) offPoint(m *models.Point) {
+	if m.Bond == nil {
+		p.master.OffClient(m.Client)
+		return
+	}
+	for _, client := range m.Bond.Clients() {
+		p.master.OffClient(client)
+	}
+}
+
 func (p *PointAuth) Stats() (success, failed int) {
 	return p.success, p.failed
 }
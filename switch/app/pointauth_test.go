@@ -0,0 +1,113 @@
+package app
+
+import (
+	"encoding/base64"
+	"github.com/danieldin95/openlan-go/libol"
+	"github.com/danieldin95/openlan-go/main/config"
+	"github.com/danieldin95/openlan-go/models"
+	"github.com/danieldin95/openlan-go/switch/storage"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"io/ioutil"
+	"net"
+	"testing"
+)
+
+func TestPointAuth_Bonded(t *testing.T) {
+	p := NewPointAuth(nil, config.Switch{})
+	primary := libol.NewTcpClient("192.168.1.1:10001", nil)
+	m := &models.Point{
+		UUID:    "bonded-uuid",
+		Network: "default",
+		User:    "hi",
+		Client:  primary,
+		Bond:    libol.NewBond("active-backup", false),
+	}
+	storage.Point.Add(m)
+	defer storage.Point.Del(primary.Addr())
+
+	bond := &models.Bond{Mode: "active-backup"}
+	path := libol.NewTcpClient("192.168.1.2:10001", nil)
+	user := &models.User{Name: "hi@default", UUID: "bonded-uuid", Network: "default", Bond: bond}
+	om, err := p.bonded(path, user)
+	assert.Nil(t, err, "same user.")
+	assert.Equal(t, m, om, "bonded.")
+
+	other := libol.NewTcpClient("192.168.1.3:10001", nil)
+	user = &models.User{Name: "guest", UUID: "bonded-uuid", Network: "default", Bond: bond}
+	om, err = p.bonded(other, user)
+	assert.NotNil(t, err, "other user.")
+	assert.Nil(t, om, "not bonded.")
+	assert.NotNil(t, p.handleAccepted(other, user), "rejected.")
+	assert.Equal(t, uint8(libol.CL_UNAUTH), other.Status(), "unauth.")
+
+	user = &models.User{Name: "hi", UUID: "bonded-uuid", Network: "guest", Bond: bond}
+	om, err = p.bonded(other, user)
+	assert.Nil(t, err, "other network.")
+	assert.Nil(t, om, "not bonded.")
+}
+
+func TestPointAuth_AcceptedCrypt(t *testing.T) {
+	c := config.Switch{
+		Network: []*config.Network{
+			{Name: "crypt", Crypt: &config.Crypt{Algo: libol.CRYPT_AESGCM, Secret: "secret"}},
+		},
+	}
+	p := NewPointAuth(nil, c)
+	local, remote := net.Pipe()
+	defer remote.Close()
+	go func() {
+		_, _ = io.Copy(ioutil.Discard, remote)
+	}()
+	client := libol.NewTcpClientFromConn(local)
+	key, err := libol.NewCryptKey()
+	assert.Nil(t, err, "key.")
+	user := &models.User{
+		Name:    "hi@crypt",
+		Network: "crypt",
+		Crypt: &models.Crypt{
+			Algo:   libol.CRYPT_AESGCM,
+			PubKey: base64.StdEncoding.EncodeToString(key.Public()),
+		},
+	}
+	assert.Nil(t, p.handleAccepted(client, user), "accepted.")
+	assert.NotNil(t, client.Crypt(), "crypt enabled.")
+	assert.Equal(t, uint8(libol.CL_AUEHED), client.Status(), "auth after crypt.")
+	client.Close()
+}
+
+func TestPointAuth_Update(t *testing.T) {
+	p := NewPointAuth(nil, config.Switch{})
+	h := NewHello(nil, config.Switch{})
+	key, err := libol.NewCryptKey()
+	assert.Nil(t, err, "key.")
+	user := &models.User{
+		Name:    "hi@api",
+		Network: "api",
+		Crypt: &models.Crypt{
+			Algo:   libol.CRYPT_AESGCM,
+			PubKey: base64.StdEncoding.EncodeToString(key.Public()),
+		},
+	}
+	plain := &models.User{Name: "hi@api", Network: "api"}
+
+	// the network added by api.
+	n := &config.Network{Name: "api", Crypt: &config.Crypt{Algo: libol.CRYPT_AESGCM, Secret: "secret"}}
+	p.Update(n)
+	h.Update(n)
+	assert.True(t, h.local().Has(models.FeatCrypt), "crypt supported.")
+	client := newPipeClient(t)
+	assert.NotNil(t, p.handleAccepted(client, plain), "crypt required.")
+	client.Close()
+	client = newPipeClient(t)
+	assert.Nil(t, p.handleAccepted(client, user), "accepted.")
+	assert.NotNil(t, client.Crypt(), "crypt enabled.")
+	client.Close()
+
+	p.Remove("api")
+	h.Remove("api")
+	assert.False(t, h.local().Has(models.FeatCrypt), "crypt removed.")
+	client = newPipeClient(t)
+	assert.Nil(t, p.handleAccepted(client, plain), "crypt not required.")
+	client.Close()
+}
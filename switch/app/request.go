@@ -58,8 +58,11 @@ func (r *WithRequest) OnIpAddr(client libol.SocketClient, data string) {
 	if n.IfAddr == "" {
 		FinNet := storage.Network.Get(n.Name)
 		libol.Cmd("WithRequest.OnIpAddr: find %s", FinNet)
-		uuid := storage.Point.GetUUID(client.Addr())
-		ipStr, netmask := storage.Network.GetFreeAddr(uuid, FinNet)
+		uuid, user := storage.Point.GetUUID(client.Addr()), ""
+		if m := storage.Point.Get(client.Addr()); m != nil {
+			user = m.User
+		}
+		ipStr, netmask := storage.Network.GetFreeAddr(uuid, user, FinNet)
 		if ipStr == "" {
 			libol.Error("WithRequest.OnIpAddr: %s no free address", n.Name)
 			_ = client.WriteResp("ipaddr", "no free address")
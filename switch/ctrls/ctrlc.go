@@ -20,12 +20,14 @@ func (cc *CtrlC) Register() {
 	// Listen change and update.
 	_ = storage.Point.Listen.Add("ctlc", &Point{cc: cc})
 	_ = storage.Neighbor.Listen.Add("ctlc", &Neighbor{cc: cc})
+	_ = storage.Link.Listen.Add("ctlc", &Link{cc: cc})
 }
 
 func (cc *CtrlC) Handle() {
 	// Handle command
 	if cc.Conn != nil {
 		cc.Conn.Listener("point", &Point{cc: cc})
+		cc.Conn.Listener("link", &Link{cc: cc})
 		cc.Conn.Listener("neighbor", &Neighbor{cc: cc})
 		cc.Conn.Listener("online", &OnLine{cc: cc})
 		cc.Conn.Listener("switch", &Switch{cc: cc})
@@ -0,0 +1,72 @@
+package ctrls
+
+import (
+	"encoding/json"
+	"github.com/danieldin95/openlan-go/controller/libctrl"
+	"github.com/danieldin95/openlan-go/libol"
+	"github.com/danieldin95/openlan-go/main/config"
+	"github.com/danieldin95/openlan-go/models"
+	"github.com/danieldin95/openlan-go/switch/storage"
+)
+
+type Link struct {
+	libctrl.Listen
+	cc *CtrlC
+}
+
+func (l *Link) Add(key string, value interface{}) {
+	libol.Cmd("Link.Add %s", key)
+	if value == nil {
+		return
+	}
+	if obj, ok := value.(*models.Point); ok {
+		if d, e := json.Marshal(models.NewLinkSchema(obj)); e == nil {
+			l.cc.Send(libctrl.Message{
+				Action:   "add",
+				Resource: "link",
+				Data:     string(d),
+			})
+		}
+	}
+}
+
+func (l *Link) Del(key string) {
+	libol.Cmd("Link.Del %s", key)
+	l.cc.Send(libctrl.Message{
+		Action:   "del",
+		Resource: "link",
+		Data:     key,
+	})
+}
+
+func (l *Link) GetCtl(id string, m libctrl.Message) error {
+	for u := range storage.Link.List() {
+		if u == nil {
+			break
+		}
+		l.Add(u.Server, u)
+	}
+	return nil
+}
+
+// AddCtl adds the link in configuration of point from controller.
+func (l *Link) AddCtl(id string, m libctrl.Message) error {
+	libol.Cmd("Link.AddCtl %s %s", id, m.Data)
+	c := &config.Point{}
+	if err := json.Unmarshal([]byte(m.Data), c); err != nil {
+		return err
+	}
+	if c.Addr == "" || c.Network == "" {
+		return libol.NewErr("connection and network are required")
+	}
+	c.Default()
+	return l.cc.Switcher.AddLink(c.Network, c)
+}
+
+// DelCtl deletes the link by address of connection from controller.
+func (l *Link) DelCtl(id string, m libctrl.Message) error {
+	libol.Cmd("Link.DelCtl %s %s", id, m.Data)
+	addr := m.Data
+	config.RightAddr(&addr, 10002)
+	return l.cc.Switcher.DelLink("", addr)
+}
@@ -3,10 +3,12 @@ package _switch
 import "github.com/danieldin95/openlan-go/libol"
 
 type FireWall struct {
-	Rules []libol.FilterRule
+	Rules   []libol.FilterRule
+	started bool
 }
 
 func (f *FireWall) Start() {
+	f.started = true
 	for _, rule := range f.Rules {
 		if ret, err := libol.IPTables(rule, "-I"); err != nil {
 			libol.Warn("FireWall.Start %s", ret)
@@ -15,9 +17,42 @@ func (f *FireWall) Start() {
 }
 
 func (f *FireWall) Stop() {
+	f.started = false
 	for _, rule := range f.Rules {
 		if ret, err := libol.IPTables(rule, "-D"); err != nil {
 			libol.Warn("FireWall.Start %s", ret)
 		}
 	}
 }
+
+// Add appends the rules, and inserts them now if started.
+func (f *FireWall) Add(rules ...libol.FilterRule) {
+	for _, rule := range rules {
+		f.Rules = append(f.Rules, rule)
+		if !f.started {
+			continue
+		}
+		if ret, err := libol.IPTables(rule, "-I"); err != nil {
+			libol.Warn("FireWall.Add %s", ret)
+		}
+	}
+}
+
+// Del removes the rules, and deletes them now if started.
+func (f *FireWall) Del(rules ...libol.FilterRule) {
+	for _, rule := range rules {
+		for i, r := range f.Rules {
+			if r != rule {
+				continue
+			}
+			f.Rules = append(f.Rules[:i], f.Rules[i+1:]...)
+			if !f.started {
+				break
+			}
+			if ret, err := libol.IPTables(rule, "-D"); err != nil {
+				libol.Warn("FireWall.Del %s", ret)
+			}
+			break
+		}
+	}
+}
@@ -80,7 +80,9 @@ func (h *Http) PProf(r *mux.Router) {
 
 func (h *Http) Middleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if h.IsAuth(w, r) {
+		if h.isWebPath(r.URL.Path) {
+			next.ServeHTTP(w, r) // point authenticate by login.
+		} else if h.IsAuth(w, r) {
 			next.ServeHTTP(w, r)
 		} else {
 			w.Header().Set("WWW-Authenticate", "Basic")
@@ -132,14 +134,37 @@ func (h *Http) LoadRouter() {
 			api.ResponseJson(w, h.switcher.Config())
 		}
 	})
+	router.HandleFunc("/api/config/reload", func(w http.ResponseWriter, r *http.Request) {
+		if err := h.switcher.Reload(); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		api.ResponseMsg(w, 0, "")
+	}).Methods("POST")
 	api.Link{Switcher: h.switcher}.Router(router)
 	api.User{}.Router(router)
 	api.Neighbor{}.Router(router)
 	api.Point{}.Router(router)
-	api.Network{}.Router(router)
+	api.Network{Switcher: h.switcher}.Router(router)
 	api.OnLine{}.Router(router)
 	api.Ctrl{Switcher: h.switcher}.Router(router)
 	api.Lease{}.Router(router)
+	api.Ban{Switcher: h.switcher}.Router(router)
+	for _, server := range h.switcher.Servers() {
+		if ws, ok := server.(*libol.WebServer); ok {
+			router.Handle(ws.Path(), ws.Handler())
+		}
+	}
+}
+
+// isWebPath returns true if the path is mounted for websocket of points.
+func (h *Http) isWebPath(path string) bool {
+	for _, server := range h.switcher.Servers() {
+		if ws, ok := server.(*libol.WebServer); ok && path == ws.Path() {
+			return true
+		}
+	}
+	return false
 }
 
 func (h *Http) LoadToken() error {
@@ -214,6 +239,7 @@ func (h *Http) PubFile(w http.ResponseWriter, r *http.Request) {
 func (h *Http) getIndex(body *schema.Index) *schema.Index {
 	body.Version = schema.NewVersionSchema()
 	body.Worker = api.NewWorkerSchema(h.switcher)
+	body.Listeners = h.switcher.Listeners()
 
 	pointList := make([]*models.Point, 0, 128)
 	for p := range storage.Point.List() {
@@ -0,0 +1,174 @@
+package _switch
+
+import (
+	"crypto/tls"
+	"github.com/danieldin95/openlan-go/libol"
+	"github.com/danieldin95/openlan-go/main/config"
+	"github.com/danieldin95/openlan-go/switch/schema"
+	"sync"
+)
+
+// Listener is a server of switch, and all clients accepted are fed to the
+// same hooks.
+type Listener struct {
+	Conf   config.Listener
+	Server libol.SocketServer
+
+	lock     sync.RWMutex
+	clients  map[libol.SocketClient]bool
+	networks map[string]bool
+	tlsCfg   *tls.Config
+}
+
+func NewListener(c config.Listener, sw *config.Switch) (*Listener, error) {
+	var server libol.SocketServer
+
+	l := &Listener{
+		Conf:     c,
+		clients:  make(map[libol.SocketClient]bool, 1024),
+		networks: make(map[string]bool, len(c.Networks)),
+	}
+	tlsCfg, err := l.serverTls(sw)
+	if err != nil {
+		libol.Error("NewListener: %s", err)
+		tlsCfg = &tls.Config{} // not accept tls without certificate.
+	}
+	if tlsCfg != nil {
+		l.tlsCfg = tlsCfg
+		tlsCfg = &tls.Config{
+			GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+				return l.currentTls(), nil
+			},
+		}
+	}
+	switch c.Protocol {
+	case "kcp", "kcp+tcpraw":
+		kcpCfg, err := config.NewKcpConfig(c.Protocol, sw.Kcp)
+		if err != nil {
+			return nil, libol.NewErr("%s %s", c.Listen, err)
+		}
+		server = libol.NewKcpServer(c.Listen, kcpCfg)
+	case "udp":
+		server = libol.NewUdpServer(c.Listen, nil)
+	case "ws", "wss":
+		webCfg := &libol.WebConfig{Path: c.Path}
+		if c.Protocol == "wss" {
+			webCfg.TlsCfg = tlsCfg
+		}
+		server = libol.NewWebServer(c.Listen, webCfg)
+	case "tls":
+		if tlsCfg == nil {
+			libol.Warn("NewListener: %s no certificate, and listen by tcp", c.Listen)
+		}
+		server = libol.NewTcpServer(c.Listen, tlsCfg)
+	default:
+		server = libol.NewTcpServer(c.Listen, nil)
+	}
+	if c.ProxyProtocol != nil {
+		if ts, ok := server.(*libol.TcpServer); ok {
+			pp, err := libol.NewProxyProtocol(c.ProxyProtocol.Trusted)
+			if err != nil {
+				server.Close()
+				return nil, libol.NewErr("%s PROXY protocol %s", c.Listen, err)
+			}
+			ts.SetProxyProtocol(pp)
+			libol.Info("NewListener: %s PROXY protocol from %s", c.Listen, c.ProxyProtocol.Trusted)
+		} else {
+			libol.Warn("NewListener: %s PROXY protocol not supported", c.Protocol)
+		}
+	}
+	if len(c.Allow) > 0 || len(c.Deny) > 0 {
+		filter, err := libol.NewAddrFilter(c.Allow, c.Deny)
+		if err != nil {
+			server.Close()
+			return nil, libol.NewErr("%s filter %s", c.Listen, err)
+		}
+		server.SetFilter(filter)
+	}
+	l.Server = server
+	for _, name := range c.Networks {
+		l.networks[name] = true
+	}
+	return l, nil
+}
+
+func (l *Listener) serverTls(sw *config.Switch) (*tls.Config, error) {
+	cert := l.Conf.Cert
+	if cert == nil {
+		cert = &sw.Cert
+	}
+	return cert.ServerTls()
+}
+
+func (l *Listener) currentTls() *tls.Config {
+	l.lock.RLock()
+	defer l.lock.RUnlock()
+	return l.tlsCfg
+}
+
+// ReloadCert loads the certificate of c again, and the new is used by the
+// next handshake. The listener without certificate when created is not
+// changed.
+func (l *Listener) ReloadCert(c config.Listener, sw *config.Switch) error {
+	if l.currentTls() == nil {
+		return nil
+	}
+	l.Conf.Cert = c.Cert
+	tlsCfg, err := l.serverTls(sw)
+	if err != nil {
+		return err
+	}
+	if tlsCfg == nil {
+		return libol.NewErr("%s no certificate", l.Conf.Listen)
+	}
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	l.tlsCfg = tlsCfg
+	return nil
+}
+
+// Allowed returns true if the network can be logged in by this listener.
+func (l *Listener) Allowed(network string) bool {
+	if len(l.networks) == 0 {
+		return true
+	}
+	return l.networks[network]
+}
+
+func (l *Listener) AddClient(client libol.SocketClient) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	l.clients[client] = true
+}
+
+func (l *Listener) DelClient(client libol.SocketClient) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	delete(l.clients, client)
+}
+
+func (l *Listener) HasClient(client libol.SocketClient) bool {
+	l.lock.RLock()
+	defer l.lock.RUnlock()
+	return l.clients[client]
+}
+
+func (l *Listener) Schema() schema.Listener {
+	l.lock.RLock()
+	clients := len(l.clients)
+	l.lock.RUnlock()
+
+	sts := l.Server.Sts()
+	return schema.Listener{
+		Protocol: l.Conf.Protocol,
+		Address:  l.Conf.Listen,
+		Networks: l.Conf.Networks,
+		Clients:  clients,
+		RxCount:  sts.RxCount,
+		TxCount:  sts.TxCount,
+		DrpCount: sts.DrpCount,
+		AcpCount: sts.AcpCount,
+		ClsCount: sts.ClsCount,
+		RejCount: sts.RejCount,
+	}
+}
@@ -0,0 +1,7 @@
+package schema
+
+type Ban struct {
+	Source string `json:"source"`
+	Failed int    `json:"failed"`
+	Until  int64  `json:"until"` // unix time.
+}
@@ -3,6 +3,7 @@ package schema
 type Index struct {
 	Version   Version    `json:"version"`
 	Worker    Worker     `json:"worker"`
+	Listeners []Listener `json:"listeners"`
 	Points    []Point    `json:"points"`
 	Links     []Link     `json:"links"`
 	Neighbors []Neighbor `json:"neighbors"`
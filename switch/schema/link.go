@@ -12,6 +12,7 @@ type Link struct {
 	TxBytes uint64 `json:"txBytes"`
 	ErrPkt  uint64 `json:"errors"`
 	State   string `json:"state"`
+	Switch  string `json:"switch,omitempty"`
 }
 
 type LinkConfig struct {
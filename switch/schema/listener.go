@@ -0,0 +1,14 @@
+package schema
+
+type Listener struct {
+	Protocol string   `json:"protocol"`
+	Address  string   `json:"listen"`
+	Networks []string `json:"networks,omitempty"`
+	Clients  int      `json:"clients"`
+	RxCount  int64    `json:"rxCount"`
+	TxCount  int64    `json:"txCount"`
+	DrpCount int64    `json:"dropCount"`
+	AcpCount int64    `json:"acceptCount"`
+	ClsCount int64    `json:"closeCount"`
+	RejCount int64    `json:"rejectCount"`
+}
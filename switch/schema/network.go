@@ -4,6 +4,9 @@ type Lease struct {
 	Address string `json:"address"`
 	UUID    string `json:"uuid"`
 	Client  string `json:"client"`
+	Network string `json:"network"`
+	Type    string `json:"type"`
+	Expire  int64  `json:"expire,omitempty"`
 }
 
 type PrefixRoute struct {
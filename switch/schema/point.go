@@ -1,16 +1,54 @@
 package schema
 
 type Point struct {
-	Uptime  int64  `json:"uptime"`
-	UUID    string `json:"uuid"`
-	Network string `json:"network"`
-	Alias   string `json:"alias"`
-	Address string `json:"server"`
-	Switch  string `json:"switch"`
-	IpAddr  string `json:"address"`
-	Device  string `json:"device"`
-	RxBytes uint64 `json:"rxBytes"`
-	TxBytes uint64 `json:"txBytes"`
-	ErrPkt  uint64 `json:"errors"`
-	State   string `json:"state"`
+	Uptime  int64   `json:"uptime"`
+	UUID    string  `json:"uuid"`
+	Network string  `json:"network"`
+	Alias   string  `json:"alias"`
+	Address string  `json:"server"`
+	Proxy   string  `json:"proxy,omitempty"` // balancer sent PROXY header.
+	Switch  string  `json:"switch"`
+	IpAddr  string  `json:"address"`
+	Device  string  `json:"device"`
+	RxBytes uint64  `json:"rxBytes"`
+	TxBytes uint64  `json:"txBytes"`
+	ErrPkt  uint64  `json:"errors"`
+	State   string  `json:"state"`
+	TxRatio float64 `json:"txRatio,omitempty"` // of compression.
+	RxRatio float64 `json:"rxRatio,omitempty"`
+	Rtt     float64 `json:"rtt,omitempty"` // smoothed in milliseconds.
+	Jitter  float64 `json:"jitter,omitempty"`
+	QDepth  int     `json:"queueDepth"` // frames waiting to send.
+	QDrops  uint64  `json:"queueDrops"`
+
+	Reconnect *Reconnect `json:"reconnect,omitempty"`
+	Endpoints []Endpoint `json:"endpoints,omitempty"`
+	Bond      *Bond      `json:"bond,omitempty"`
+}
+
+type Bond struct {
+	Mode     string     `json:"mode"`
+	Sequence bool       `json:"sequence"`
+	Paths    []BondPath `json:"paths"`
+}
+
+type BondPath struct {
+	Address string  `json:"server"`
+	State   string  `json:"state"`
+	Rtt     float64 `json:"rtt,omitempty"`
+}
+
+type Reconnect struct {
+	State    string `json:"state"`
+	Attempts int    `json:"attempts"`
+	Next     int64  `json:"next,omitempty"` // unix time of next retry.
+}
+
+type Endpoint struct {
+	Address  string  `json:"server"`
+	Protocol string  `json:"protocol"`
+	Weight   int     `json:"weight,omitempty"`
+	Active   bool    `json:"active"`
+	Healthy  bool    `json:"healthy"`
+	Rtt      float64 `json:"rtt,omitempty"` // of tcp connect in milliseconds.
 }
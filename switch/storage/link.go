@@ -22,11 +22,13 @@ func (p *_link) Init(size int) {
 	p.Links = libol.NewSafeStrMap(size)
 }
 
-func (p *_link) Add(m *point.Point) {
+// Add saves the link by the address configured, not the address of
+// endpoint active.
+func (p *_link) Add(key string, m *point.Point) {
 	link := &models.Point{
 		Alias:   "",
 		Network: m.Tenant,
-		Server:  m.Addr(),
+		Server:  key,
 		Uptime:  m.UpTime(),
 		Status:  m.State(),
 		Client:  m.Client(),
@@ -34,8 +36,8 @@ func (p *_link) Add(m *point.Point) {
 		IfName:  m.IfName(),
 		UUID:    m.UUID(),
 	}
-	_ = p.Links.Set(m.Addr(), link)
-	_ = p.Listen.AddV(m.Addr(), link)
+	_ = p.Links.Set(key, link)
+	_ = p.Listen.AddV(key, link)
 }
 
 func (p *_link) Get(key string) *models.Point {
@@ -6,18 +6,23 @@ import (
 	"github.com/danieldin95/openlan-go/models"
 	"github.com/danieldin95/openlan-go/switch/schema"
 	"net"
+	"sort"
+	"strings"
+	"sync"
+	"time"
 )
 
 type _network struct {
 	Networks *libol.SafeStrMap
-	AddrUUID *libol.SafeStrStr
-	UUIDAddr *libol.SafeStrStr
+	lock     sync.Mutex
+	leases   map[string]*models.Lease // by network/uuid, or network/user@network if reserved.
+	bound    map[string]string        // by network/address reserved for user, and uuid of point using it.
 }
 
 var Network = _network{
 	Networks: libol.NewSafeStrMap(1024),
-	AddrUUID: libol.NewSafeStrStr(1024),
-	UUIDAddr: libol.NewSafeStrStr(1024),
+	leases:   make(map[string]*models.Lease, 1024),
+	bound:    make(map[string]string, 32),
 }
 
 func (w *_network) Add(n *models.Network) {
@@ -52,63 +57,348 @@ func (w *_network) List() <-chan *models.Network {
 	return c
 }
 
-func (w *_network) ListLease() <-chan *schema.Lease {
-	c := make(chan *schema.Lease, 128)
+// LoadLease adds the lease saved in state.
+func (w *_network) LoadLease(l *models.Lease) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	w.leases[leaseKey(l.Network, l.UUID)] = l
+}
 
-	go func() {
-		w.UUIDAddr.Iter(func(k string, v string) {
-			c <- &schema.Lease{
-				UUID:    k,
-				Address: v,
-				Client:  Point.GetAddr(k),
+// leaseKey returns the key of lease, and the same uuid has a lease for
+// each network.
+func leaseKey(network, uuid string) string {
+	return network + "/" + uuid
+}
+
+func ip2Int(addr string) uint32 {
+	ip := net.ParseIP(addr)
+	if ip == nil || ip.To4() == nil {
+		return 0
+	}
+	return binary.BigEndian.Uint32(ip.To4())
+}
+
+func int2Ip(v uint32) string {
+	tmp := make([]byte, 4)
+	binary.BigEndian.PutUint32(tmp, v)
+	return net.IP(tmp).String()
+}
+
+// UserName returns the name of user likes user@network.
+func UserName(user, network string) string {
+	if user == "" || strings.Contains(user, "@") {
+		return user
+	}
+	return user + "@" + network
+}
+
+// online returns true if the point of uuid is online in the network.
+func online(uuid, network string) bool {
+	m := Point.GetByUUID(uuid)
+	return m != nil && m.Network == network
+}
+
+// expire deletes the dynamic leases expired of points offline, and renews
+// the leases of points online. It is locked by caller.
+func (w *_network) expire(now int64) {
+	for k, l := range w.leases {
+		if l.Type != models.LeaseDynamic {
+			continue
+		}
+		if online(l.UUID, l.Network) {
+			n := w.Get(l.Network)
+			if n != nil && n.LeaseTime > 0 && l.Expire-now < n.LeaseTime/2 {
+				l.Expire = now + n.LeaseTime
+				State.Put("lease", k, l)
 			}
-		})
-		c <- nil //Finish channel by nil.
-	}()
+			continue
+		}
+		if l.Expired(now) {
+			libol.Info("_network.expire %s on %s", l.Address, l.UUID)
+			delete(w.leases, k)
+			State.Del("lease", k)
+		}
+	}
+}
 
-	return c
+// reserved returns the address reserved for the uuid or the user, and
+// the key reserved by.
+func (w *_network) reserved(n *models.Network, uuid, user string) (string, string) {
+	user = UserName(user, n.Name)
+	for _, k := range []string{uuid, user} {
+		if k == "" {
+			continue
+		}
+		if addr, ok := n.Reserved[k]; ok {
+			return addr, k
+		}
+		if l, ok := w.leases[leaseKey(n.Name, k)]; ok && l.Type == models.LeaseStatic {
+			return l.Address, k
+		}
+	}
+	return "", ""
+}
+
+func excluded(n *models.Network, ip uint32) bool {
+	for _, r := range n.Exclude {
+		if r.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// used returns the addresses of network leased or reserved, and except
+// the uuid. It is locked by caller.
+func (w *_network) used(n *models.Network, except string) map[string]string {
+	addrs := make(map[string]string, len(w.leases))
+	for k, addr := range n.Reserved {
+		addrs[addr] = k
+	}
+	for _, l := range w.leases {
+		if l.Network == n.Name && l.UUID != except {
+			addrs[l.Address] = l.UUID
+		}
+	}
+	return addrs
+}
+
+// bind returns true if the address reserved for user is not used by
+// other point online, and binds it to the uuid. It is locked by caller.
+func (w *_network) bind(n *models.Network, addr, uuid string) bool {
+	key := leaseKey(n.Name, addr)
+	if holder, ok := w.bound[key]; ok && holder != uuid && online(holder, n.Name) {
+		return false
+	}
+	w.bound[key] = uuid
+	return true
 }
 
-func (w *_network) GetFreeAddr(uuid string, n *models.Network) (ip string, mask string) {
+// GetFreeAddr returns the address reserved for the point, or the address
+// leased before if not expired, or a free one of network. The address
+// reserved for user is used by only one point of it at the same time,
+// and others get a free one.
+func (w *_network) GetFreeAddr(uuid, user string, n *models.Network) (ip string, mask string) {
 	if n == nil || uuid == "" {
 		return "", ""
 	}
+	w.lock.Lock()
+	defer w.lock.Unlock()
 
-	ipStr := ""
+	now := time.Now().Unix()
+	w.expire(now)
 	netmask := n.Netmask
+	key := leaseKey(n.Name, uuid)
+	if addr, by := w.reserved(n, uuid, user); addr != "" {
+		k, ok := w.used(n, uuid)[addr]
+		if ok && k != by {
+			libol.Warn("_network.GetFreeAddr %s reserved for %s used by %s", addr, uuid, k)
+		} else if by != uuid && !w.bind(n, addr, uuid) {
+			libol.Info("_network.GetFreeAddr %s reserved for %s used by %s", addr, by, w.bound[leaseKey(n.Name, addr)])
+		} else {
+			if l, ok := w.leases[key]; ok && l.Type == models.LeaseDynamic {
+				delete(w.leases, key)
+				State.Del("lease", key)
+			}
+			return addr, netmask
+		}
+	}
+	if l, ok := w.leases[key]; ok && l.Type == models.LeaseDynamic {
+		if !excluded(n, ip2Int(l.Address)) {
+			if _, ok := w.used(n, uuid)[l.Address]; !ok {
+				if n.LeaseTime > 0 {
+					l.Expire = now + n.LeaseTime
+				}
+				State.Put("lease", key, l)
+				return l.Address, netmask
+			}
+		}
+	}
 
-	if addr, ok := w.UUIDAddr.GetEx(uuid); ok {
+	start := ip2Int(n.IpStart)
+	end := ip2Int(n.IpEnd)
+	if start == 0 || end == 0 {
+		return "", netmask
+	}
+	addrs := w.used(n, uuid)
+	for i := start; i <= end && i != 0; i++ {
+		if excluded(n, i) {
+			continue
+		}
+		addr := int2Ip(i)
+		if _, ok := addrs[addr]; ok {
+			continue
+		}
+		l := &models.Lease{
+			UUID:    uuid,
+			Network: n.Name,
+			Address: addr,
+			Type:    models.LeaseDynamic,
+		}
+		if n.LeaseTime > 0 {
+			l.Expire = now + n.LeaseTime
+		}
+		w.leases[key] = l
+		State.Put("lease", key, l)
 		return addr, netmask
 	}
+	return "", netmask
+}
+
+// OffAddr keeps the dynamic lease for the grace of network after the
+// point closed, so the point reconnecting gets the same address. And the
+// address reserved for user is unbound.
+func (w *_network) OffAddr(uuid string) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	for k, holder := range w.bound {
+		if holder == uuid {
+			delete(w.bound, k)
+		}
+	}
+	now := time.Now().Unix()
+	for k, l := range w.leases {
+		if l.UUID != uuid || l.Type != models.LeaseDynamic {
+			continue
+		}
+		grace := int64(0)
+		if n := w.Get(l.Network); n != nil {
+			grace = n.Grace
+		}
+		if grace <= 0 {
+			delete(w.leases, k)
+			State.Del("lease", k)
+			continue
+		}
+		if expire := now + grace; l.Expire == 0 || expire < l.Expire {
+			l.Expire = expire
+			State.Put("lease", k, l)
+		}
+	}
+}
+
+// Reserve binds the address of network to the uuid, or user@network.
+func (w *_network) Reserve(key, network, addr string) (*models.Lease, error) {
+	n := w.Get(network)
+	if n == nil {
+		return nil, libol.NewErr("network %s not found", network)
+	}
+	ip := ip2Int(addr)
+	if ip == 0 || ip < ip2Int(n.IpStart) || ip > ip2Int(n.IpEnd) {
+		return nil, libol.NewErr("%s out of %s-%s", addr, n.IpStart, n.IpEnd)
+	}
+	if excluded(n, ip) {
+		return nil, libol.NewErr("%s excluded", addr)
+	}
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	w.expire(time.Now().Unix())
+	if k, ok := w.used(n, key)[addr]; ok && k != key {
+		return nil, libol.NewErr("%s used by %s", addr, k)
+	}
+	l := &models.Lease{
+		UUID:    key,
+		Network: n.Name,
+		Address: addr,
+		Type:    models.LeaseStatic,
+	}
+	w.leases[leaseKey(n.Name, key)] = l
+	State.Put("lease", leaseKey(n.Name, key), l)
+	return l, nil
+}
+
+// Release deletes the lease by uuid, user@network or address, and returns
+// an error if not found or the address is used by a point online.
+func (w *_network) Release(key string) error {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	k, l := w.getLease(key)
+	if l == nil {
+		return libol.NewErr("lease %s not found", key)
+	}
+	if uuid := w.holder(l); uuid != "" && online(uuid, l.Network) {
+		return libol.NewErr("%s used by %s online", l.Address, uuid)
+	}
+	delete(w.leases, k)
+	delete(w.bound, leaseKey(l.Network, l.Address))
+	State.Del("lease", k)
+	return nil
+}
 
-	sIp := net.ParseIP(n.IpStart)
-	eIp := net.ParseIP(n.IpEnd)
-	if sIp == nil || eIp == nil {
-		return ipStr, netmask
+// holder returns the uuid of point using the address of lease. It is
+// locked by caller.
+func (w *_network) holder(l *models.Lease) string {
+	if uuid, ok := w.bound[leaseKey(l.Network, l.Address)]; ok {
+		return uuid
 	}
+	return l.UUID
+}
 
-	start := binary.BigEndian.Uint32(sIp.To4()[:4])
-	end := binary.BigEndian.Uint32(eIp.To4()[:4])
-	for i := start; i <= end; i++ {
-		tmp := make([]byte, 4)
-		binary.BigEndian.PutUint32(tmp[:4], i)
-		tmpStr := net.IP(tmp).String()
-		if _, ok := w.AddrUUID.GetEx(tmpStr); !ok {
-			ipStr = tmpStr
-			break
+// getLease finds by network/uuid, uuid, user@network or address, and is
+// locked by caller.
+func (w *_network) getLease(key string) (string, *models.Lease) {
+	if l, ok := w.leases[key]; ok {
+		return key, l
+	}
+	for k, l := range w.leases {
+		if l.UUID == key {
+			return k, l
+		}
+	}
+	for k, l := range w.leases {
+		if l.Address == key {
+			return k, l
 		}
 	}
+	return "", nil
+}
+
+// newLeaseSchema is locked by caller.
+func (w *_network) newLeaseSchema(l *models.Lease) schema.Lease {
+	return schema.Lease{
+		UUID:    l.UUID,
+		Network: l.Network,
+		Address: l.Address,
+		Type:    l.Type,
+		Expire:  l.Expire,
+		Client:  Point.GetAddr(w.holder(l)),
+	}
+}
+
+func (w *_network) GetLease(key string) *schema.Lease {
+	w.lock.Lock()
+	defer w.lock.Unlock()
 
-	if ipStr != "" {
-		_ = w.AddrUUID.Set(ipStr, uuid)
-		_ = w.UUIDAddr.Set(uuid, ipStr)
+	w.expire(time.Now().Unix())
+	if _, l := w.getLease(key); l != nil {
+		sl := w.newLeaseSchema(l)
+		return &sl
 	}
-	return ipStr, netmask
+	return nil
 }
 
-func (w *_network) FreeAddr(uuid string) {
-	if addr, ok := w.UUIDAddr.GetEx(uuid); ok {
-		w.UUIDAddr.Del(uuid)
-		w.AddrUUID.Del(addr)
+func (w *_network) ListLease() <-chan *schema.Lease {
+	c := make(chan *schema.Lease, 128)
+
+	w.lock.Lock()
+	w.expire(time.Now().Unix())
+	leases := make([]schema.Lease, 0, len(w.leases))
+	for _, l := range w.leases {
+		leases = append(leases, w.newLeaseSchema(l))
 	}
+	w.lock.Unlock()
+	sort.Slice(leases, func(i, j int) bool {
+		return ip2Int(leases[i].Address) < ip2Int(leases[j].Address)
+	})
+	go func() {
+		for i := range leases {
+			c <- &leases[i]
+		}
+		c <- nil //Finish channel by nil.
+	}()
+
+	return c
 }
@@ -0,0 +1,120 @@
+package storage
+
+import (
+	"github.com/danieldin95/openlan-go/libol"
+	"github.com/danieldin95/openlan-go/models"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestNetwork_Lease(t *testing.T) {
+	n := &models.Network{
+		Name:      "lease",
+		IpStart:   "10.0.0.1",
+		IpEnd:     "10.0.0.5",
+		Netmask:   "255.255.255.0",
+		LeaseTime: 60,
+		Grace:     30,
+		Exclude:   []models.IpRange{{Start: ip2Int("10.0.0.1"), End: ip2Int("10.0.0.2")}},
+		Reserved:  map[string]string{"hi@lease": "10.0.0.5"},
+	}
+	Network.Add(n)
+	defer Network.Del(n.Name)
+
+	addr, _ := Network.GetFreeAddr("u1", "", n)
+	assert.Equal(t, "10.0.0.3", addr, "skip excluded.")
+	addr, _ = Network.GetFreeAddr("u2", "hi", n)
+	assert.Equal(t, "10.0.0.5", addr, "reserved by user.")
+	addr, _ = Network.GetFreeAddr("u3", "", n)
+	assert.Equal(t, "10.0.0.4", addr, "skip reserved.")
+	addr, _ = Network.GetFreeAddr("u4", "", n)
+	assert.Equal(t, "", addr, "no free.")
+
+	// kept for grace after closed.
+	Network.OffAddr("u1")
+	addr, _ = Network.GetFreeAddr("u1", "", n)
+	assert.Equal(t, "10.0.0.3", addr, "same address.")
+	Network.OffAddr("u1")
+	Network.lock.Lock()
+	Network.leases[leaseKey(n.Name, "u1")].Expire = time.Now().Unix() - 1
+	Network.lock.Unlock()
+	addr, _ = Network.GetFreeAddr("u4", "", n)
+	assert.Equal(t, "10.0.0.3", addr, "expired.")
+
+	_, err := Network.Reserve("u5", n.Name, "10.0.0.4")
+	assert.NotNil(t, err, "used.")
+	assert.Nil(t, Network.Release("10.0.0.4"), "release.")
+	_, err = Network.Reserve("u5", n.Name, "10.0.0.4")
+	assert.Nil(t, err, "reserve.")
+	addr, _ = Network.GetFreeAddr("u5", "", n)
+	assert.Equal(t, "10.0.0.4", addr, "reserved by uuid.")
+	assert.Equal(t, models.LeaseStatic, Network.GetLease("u5").Type)
+}
+
+func addPoint(uuid, addr, network string) {
+	Point.Add(&models.Point{
+		UUID:    uuid,
+		Network: network,
+		Client:  libol.NewTcpClient(addr, nil),
+	})
+}
+
+func TestNetwork_LeaseReservedUser(t *testing.T) {
+	n := &models.Network{
+		Name:     "reserved",
+		IpStart:  "10.0.1.1",
+		IpEnd:    "10.0.1.5",
+		Netmask:  "255.255.255.0",
+		Grace:    30,
+		Reserved: map[string]string{"hi@reserved": "10.0.1.5"},
+	}
+	Network.Add(n)
+	defer Network.Del(n.Name)
+
+	addPoint("u1", "127.0.0.1:1001", n.Name)
+	defer Point.Del("127.0.0.1:1001")
+	addr, _ := Network.GetFreeAddr("u1", "hi", n)
+	assert.Equal(t, "10.0.1.5", addr, "reserved by user.")
+	addPoint("u2", "127.0.0.1:1002", n.Name)
+	addr, _ = Network.GetFreeAddr("u2", "hi", n)
+	assert.Equal(t, "10.0.1.1", addr, "used by u1, and dynamic.")
+	addr, _ = Network.GetFreeAddr("u1", "hi", n)
+	assert.Equal(t, "10.0.1.5", addr, "kept by u1.")
+
+	// reserved address is released to others after u1 closed.
+	Point.Del("127.0.0.1:1001")
+	Network.OffAddr("u1")
+	addr, _ = Network.GetFreeAddr("u2", "hi", n)
+	assert.Equal(t, "10.0.1.5", addr, "bound to u2.")
+	assert.Nil(t, Network.GetLease(leaseKey(n.Name, "u2")), "dynamic released.")
+
+	// not released if online.
+	_, err := Network.Reserve("hi@reserved", n.Name, "10.0.1.4")
+	assert.Nil(t, err, "reserve.")
+	assert.Nil(t, Network.Release("hi@reserved"), "not used.")
+	addr, _ = Network.GetFreeAddr("u1", "", n)
+	assert.Equal(t, "10.0.1.1", addr, "dynamic.")
+	addPoint("u1", "127.0.0.1:1001", n.Name)
+	assert.NotNil(t, Network.Release("10.0.1.1"), "online.")
+	Point.Del("127.0.0.1:1001")
+	assert.Nil(t, Network.Release("10.0.1.1"), "offline.")
+	Point.Del("127.0.0.1:1002")
+}
+
+func TestNetwork_LeaseByNetwork(t *testing.T) {
+	n1 := &models.Network{Name: "net1", IpStart: "10.0.2.1", IpEnd: "10.0.2.5", Netmask: "255.255.255.0"}
+	n2 := &models.Network{Name: "net2", IpStart: "10.0.3.1", IpEnd: "10.0.3.5", Netmask: "255.255.255.0"}
+	Network.Add(n1)
+	defer Network.Del(n1.Name)
+	Network.Add(n2)
+	defer Network.Del(n2.Name)
+
+	addr, _ := Network.GetFreeAddr("u1", "", n1)
+	assert.Equal(t, "10.0.2.1", addr, "net1.")
+	addr, _ = Network.GetFreeAddr("u1", "", n2)
+	assert.Equal(t, "10.0.3.1", addr, "net2.")
+	addr, _ = Network.GetFreeAddr("u1", "", n1)
+	assert.Equal(t, "10.0.2.1", addr, "kept on net1.")
+	assert.Equal(t, "10.0.3.1", Network.GetLease(leaseKey(n2.Name, "u1")).Address, "kept on net2.")
+}
@@ -32,6 +32,12 @@ func (p *_point) Add(m *models.Point) {
 	_ = p.Listen.AddV(m.Client.Addr(), m)
 }
 
+// AddPath maps the client of a bond path to the point.
+func (p *_point) AddPath(m *models.Point, client libol.SocketClient) {
+	_ = p.AddrUUID.Set(client.Addr(), m.UUID)
+	_ = p.Clients.Set(client.Addr(), m)
+}
+
 func (p *_point) Get(addr string) *models.Point {
 	if v := p.Clients.Get(addr); v != nil {
 		m := v.(*models.Point)
@@ -59,9 +65,16 @@ func (p *_point) GetAddr(uuid string) string {
 func (p *_point) Del(addr string) {
 	if v := p.Clients.Get(addr); v != nil {
 		m := v.(*models.Point)
+		if m.Bond != nil && m.Bond.Remove(addr) > 0 {
+			p.delPath(m, addr)
+			return
+		}
 		if m.Device != nil {
 			_ = m.Device.Close()
 		}
+		if m.Queue != nil {
+			m.Queue.Close()
+		}
 		if p.UUIDAddr.Get(m.UUID) == addr { // not has newer
 			p.UUIDAddr.Del(m.UUID)
 		}
@@ -71,12 +84,32 @@ func (p *_point) Del(addr string) {
 	p.Listen.DelV(addr)
 }
 
+// delPath deletes a path of bond, and the next is primary if deleted
+// the primary.
+func (p *_point) delPath(m *models.Point, addr string) {
+	p.AddrUUID.Del(addr)
+	p.Clients.Del(addr)
+	if p.UUIDAddr.Get(m.UUID) != addr {
+		return
+	}
+	p.Listen.DelV(addr)
+	if path := m.Bond.Primary(); path != nil {
+		m.Client = path.Client
+		m.Queue = path.Queue
+		_ = p.UUIDAddr.Reset(m.UUID, path.Client.Addr())
+		_ = p.Listen.AddV(path.Client.Addr(), m)
+	}
+}
+
 func (p *_point) List() <-chan *models.Point {
 	c := make(chan *models.Point, 128)
 
 	go func() {
 		p.Clients.Iter(func(k string, v interface{}) {
 			if m, ok := v.(*models.Point); ok {
+				if m.Bond != nil && m.Client.Addr() != k { // other paths of bond.
+					return
+				}
 				m.Update()
 				c <- m
 			}
@@ -0,0 +1,63 @@
+package storage
+
+import (
+	"encoding/json"
+	"github.com/danieldin95/openlan-go/libol"
+	"github.com/danieldin95/openlan-go/models"
+)
+
+type _state struct {
+	Store libol.Store
+}
+
+// State saves the users and the leases, and nothing is saved if no store.
+var State = _state{}
+
+// Open loads the users and the leases saved in store, and writes the
+// changes through it later.
+func (s *_state) Open(store libol.Store) {
+	s.Store = store
+	store.Iter("user", func(key string, value []byte) {
+		user := &models.User{}
+		if err := json.Unmarshal(value, user); err != nil {
+			libol.Warn("State.Open: user %s: %s", key, err)
+			return
+		}
+		_ = User.Users.Set(key, user)
+	})
+	store.Iter("lease", func(key string, value []byte) {
+		lease := &models.Lease{}
+		if err := json.Unmarshal(value, lease); err != nil {
+			libol.Warn("State.Open: lease %s: %s", key, err)
+			return
+		}
+		Network.LoadLease(lease)
+	})
+}
+
+func (s *_state) Close() {
+	if s.Store == nil {
+		return
+	}
+	if err := s.Store.Close(); err != nil {
+		libol.Error("State.Close: %s", err)
+	}
+}
+
+func (s *_state) Put(bucket, key string, value interface{}) {
+	if s.Store == nil {
+		return
+	}
+	if err := s.Store.Put(bucket, key, value); err != nil {
+		libol.Error("State.Put: %s %s: %s", bucket, key, err)
+	}
+}
+
+func (s *_state) Del(bucket, key string) {
+	if s.Store == nil {
+		return
+	}
+	if err := s.Store.Del(bucket, key); err != nil {
+		libol.Error("State.Del: %s %s: %s", bucket, key, err)
+	}
+}
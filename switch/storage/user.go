@@ -17,7 +17,15 @@ func (w *_user) Init(size int) {
 	w.Users = libol.NewSafeStrMap(size)
 }
 
+// Add adds the user, and saves it to state.
 func (w *_user) Add(user *models.User) {
+	name := w.AddConf(user)
+	State.Put("user", name, user)
+}
+
+// AddConf adds the user of configuration, and it is not saved to state
+// since loaded from configuration again.
+func (w *_user) AddConf(user *models.User) string {
 	libol.Debug("_user.Add %v", *user)
 	name := user.Name
 	if name == "" {
@@ -25,11 +33,28 @@ func (w *_user) Add(user *models.User) {
 	}
 	w.Users.Del(name)
 	_ = w.Users.Set(name, user)
+	return name
 }
 
 func (w *_user) Del(name string) {
 	libol.Debug("_user.Add %s", name)
 	w.Users.Del(name)
+	State.Del("user", name)
+}
+
+// DelConf deletes the user added by AddConf, and keeps it if replaced by
+// others, such as the user added by api. It returns false if kept.
+func (w *_user) DelConf(user *models.User) bool {
+	name := user.Name
+	if name == "" {
+		name = user.Token
+	}
+	libol.Debug("_user.DelConf %s", name)
+	if w.Get(name) != user {
+		return false
+	}
+	w.Users.Del(name)
+	return true
 }
 
 func (w *_user) Get(name string) *models.User {
@@ -1,21 +1,25 @@
 package _switch
 
 import (
-	"crypto/tls"
+	"fmt"
 	"github.com/danieldin95/openlan-go/libol"
 	"github.com/danieldin95/openlan-go/main/config"
 	"github.com/danieldin95/openlan-go/models"
 	"github.com/danieldin95/openlan-go/network"
 	"github.com/danieldin95/openlan-go/switch/app"
 	"github.com/danieldin95/openlan-go/switch/ctrls"
+	"github.com/danieldin95/openlan-go/switch/schema"
 	"github.com/danieldin95/openlan-go/switch/storage"
+	"reflect"
 	"strings"
 	"sync"
 	"time"
 )
 
 type Apps struct {
+	Hello    *app.Hello
 	Auth     *app.PointAuth
+	Beat     *app.Heartbeat
 	Request  *app.WithRequest
 	Neighbor *app.Neighbors
 	OnLines  *app.Online
@@ -30,30 +34,48 @@ type Switch struct {
 
 	hooks      []Hook
 	http       *Http
-	server     libol.SocketServer
+	listeners  []*Listener
+	guard      *libol.Guard
 	bridge     map[string]network.Bridger
 	worker     map[string]*Worker
 	lock       sync.RWMutex
 	uuid       string
 	newTime    int64
 	initialize bool
+	stopped    sync.Once
 }
 
-func NewSwitch(c config.Switch) *Switch {
-	var tlsCfg *tls.Config
-	var server libol.SocketServer
-
-	if c.Cert.KeyFile != "" && c.Cert.CrtFile != "" {
-		cer, err := tls.LoadX509KeyPair(c.Cert.CrtFile, c.Cert.KeyFile)
+// NewSwitch returns an error if any listener is invalid, and refuses to
+// start.
+func NewSwitch(c config.Switch) (*Switch, error) {
+	limit := config.Limit{}
+	if c.Limit != nil {
+		limit = *c.Limit
+	}
+	guard := libol.NewGuard(limit.MaxClient, limit.MaxPerSource, limit.Rate, limit.Burst,
+		limit.MaxFailed, time.Duration(limit.BanTime)*time.Second)
+	listeners := make([]*Listener, 0, len(c.Listeners))
+	paths := make(map[string]bool, 4)
+	for _, lc := range c.Listeners {
+		l, err := NewListener(lc, &c)
+		if err == nil {
+			// all websocket are mounted on the http server too.
+			if ws, ok := l.Server.(*libol.WebServer); ok {
+				if paths[ws.Path()] {
+					l.Server.Close()
+					err = libol.NewErr("%s path %s already used", lc.Listen, ws.Path())
+				}
+				paths[ws.Path()] = true
+			}
+		}
 		if err != nil {
-			libol.Error("NewSwitch: %s", err)
+			for _, o := range listeners {
+				o.Server.Close()
+			}
+			return nil, err
 		}
-		tlsCfg = &tls.Config{Certificates: []tls.Certificate{cer}}
-	}
-	if c.Protocol == "kcp" {
-		server = libol.NewKcpServer(c.Listen, nil)
-	} else {
-		server = libol.NewTcpServer(c.Listen, tlsCfg)
+		l.Server.SetGuard(guard)
+		listeners = append(listeners, l)
 	}
 	v := Switch{
 		Conf: c,
@@ -62,73 +84,129 @@ func NewSwitch(c config.Switch) *Switch {
 		},
 		worker:     make(map[string]*Worker, 32),
 		bridge:     make(map[string]network.Bridger, 32),
-		server:     server,
+		listeners:  listeners,
+		guard:      guard,
 		newTime:    time.Now().Unix(),
 		initialize: false,
 	}
-	return &v
+	return &v, nil
 }
 
-func (v *Switch) AddRules(source string, prefix string) {
-	libol.Info("Switch.AddRules %s, %s", source, prefix)
-	v.Fire.Rules = append(v.Fire.Rules, libol.FilterRule{
-		Table:  "filter",
-		Chain:  "FORWARD",
-		Source: source,
-		Dest:   prefix,
-		Jump:   "ACCEPT",
-	})
-	v.Fire.Rules = append(v.Fire.Rules, libol.FilterRule{
-		Table:  "nat",
-		Chain:  "POSTROUTING",
-		Source: source,
-		Dest:   prefix,
-		Jump:   "MASQUERADE",
-	})
-	v.Fire.Rules = append(v.Fire.Rules, libol.FilterRule{
-		Table:  "nat",
-		Chain:  "POSTROUTING",
-		Dest:   source,
-		Source: prefix,
-		Jump:   "MASQUERADE",
-	})
+// rules returns the rules to MASQUERADE the routes via the bridge, and the
+// empty nexthop of routes is filled by address of the bridge.
+func (v *Switch) rules(nCfg *config.Network) []libol.FilterRule {
+	rules := make([]libol.FilterRule, 0, 8)
+	source := nCfg.Bridge.Address
+	if source == "" {
+		return rules
+	}
+	ifAddr := strings.SplitN(source, "/", 2)[0]
+	for i, rt := range nCfg.Routes {
+		if rt.NextHop == "" {
+			nCfg.Routes[i].NextHop = ifAddr
+		}
+		rt = nCfg.Routes[i]
+		if rt.NextHop != ifAddr {
+			continue
+		}
+		// MASQUERADE
+		libol.Info("Switch.rules %s, %s", source, rt.Prefix)
+		rules = append(rules, libol.FilterRule{
+			Table:  "filter",
+			Chain:  "FORWARD",
+			Source: source,
+			Dest:   rt.Prefix,
+			Jump:   "ACCEPT",
+		})
+		rules = append(rules, libol.FilterRule{
+			Table:  "nat",
+			Chain:  "POSTROUTING",
+			Source: source,
+			Dest:   rt.Prefix,
+			Jump:   "MASQUERADE",
+		})
+		rules = append(rules, libol.FilterRule{
+			Table:  "nat",
+			Chain:  "POSTROUTING",
+			Dest:   source,
+			Source: rt.Prefix,
+			Jump:   "MASQUERADE",
+		})
+	}
+	return rules
+}
+
+func newFilterRule(rule config.FlowRules) libol.FilterRule {
+	return libol.FilterRule{
+		Table:    rule.Table,
+		Chain:    rule.Chain,
+		Source:   rule.Source,
+		Dest:     rule.Dest,
+		Jump:     rule.Jump,
+		ToSource: rule.ToSource,
+		ToDest:   rule.ToDest,
+		Comment:  rule.Comment,
+		Input:    rule.Input,
+		Output:   rule.Output,
+	}
+}
+
+// diffRules returns the rules in a but not in b.
+func diffRules(a, b []libol.FilterRule) []libol.FilterRule {
+	rules := make([]libol.FilterRule, 0, len(a))
+	for _, x := range a {
+		found := false
+		for _, y := range b {
+			if x == y {
+				found = true
+				break
+			}
+		}
+		if !found {
+			rules = append(rules, x)
+		}
+	}
+	return rules
+}
+
+// addNetwork creates the worker and the bridge of network, and it is
+// locked by caller.
+func (v *Switch) addNetwork(nCfg *config.Network) *Worker {
+	name := nCfg.Name
+	brCfg := nCfg.Bridge
+
+	v.Fire.Add(v.rules(nCfg)...)
+	w := NewWorker(*nCfg)
+	v.worker[name] = w
+	v.bridge[name] = network.NewBridger(brCfg.Provider, brCfg.Name, brCfg.Mtu)
+	return w
 }
 
 func (v *Switch) Initialize() {
 	v.initialize = true
+	if store, err := libol.NewFileStore(v.Conf.StateDir); err == nil {
+		storage.State.Open(store)
+	} else {
+		libol.Error("Switch.Initialize: state %s", err)
+	}
 	if v.Conf.Http != nil {
 		v.http = NewHttp(v, v.Conf)
 	}
 	for _, nCfg := range v.Conf.Network {
-		name := nCfg.Name
-		brCfg := nCfg.Bridge
-
-		if brCfg.Address != "" {
-			source := brCfg.Address
-			ifAddr := strings.SplitN(source, "/", 2)[0]
-			for i, rt := range nCfg.Routes {
-				if rt.NextHop == "" {
-					nCfg.Routes[i].NextHop = ifAddr
-				}
-				rt = nCfg.Routes[i]
-				if rt.NextHop != ifAddr {
-					continue
-				}
-				// MASQUERADE
-				v.AddRules(source, rt.Prefix)
-			}
-		}
-		v.worker[name] = NewWorker(*nCfg)
-		v.bridge[name] = network.NewBridger(brCfg.Provider, brCfg.Name, brCfg.Mtu)
+		v.addNetwork(nCfg)
 	}
 
+	v.Apps.Hello = app.NewHello(v, v.Conf)
 	v.Apps.Auth = app.NewPointAuth(v, v.Conf)
+	v.Apps.Beat = app.NewHeartbeat(v, v.Conf)
 	v.Apps.Request = app.NewWithRequest(v, v.Conf)
 	v.Apps.Neighbor = app.NewNeighbors(v, v.Conf)
 	v.Apps.OnLines = app.NewOnline(v, v.Conf)
 
 	v.hooks = make([]Hook, 0, 64)
+	v.hooks = append(v.hooks, v.Apps.Hello.OnFrame)
 	v.hooks = append(v.hooks, v.Apps.Auth.OnFrame)
+	v.hooks = append(v.hooks, v.Apps.Beat.OnFrame)
 	v.hooks = append(v.hooks, v.Apps.Neighbor.OnFrame)
 	v.hooks = append(v.hooks, v.Apps.Request.OnFrame)
 	v.hooks = append(v.hooks, v.Apps.OnLines.OnFrame)
@@ -145,18 +223,7 @@ func (v *Switch) Initialize() {
 
 	// FireWall
 	for _, rule := range v.Conf.FireWall {
-		v.Fire.Rules = append(v.Fire.Rules, libol.FilterRule{
-			Table:    rule.Table,
-			Chain:    rule.Chain,
-			Source:   rule.Source,
-			Dest:     rule.Dest,
-			Jump:     rule.Jump,
-			ToSource: rule.ToSource,
-			ToDest:   rule.ToDest,
-			Comment:  rule.Comment,
-			Input:    rule.Input,
-			Output:   rule.Output,
-		})
+		v.Fire.Add(newFilterRule(rule))
 	}
 	libol.Info("Switch.Initialize total %d rules", len(v.Fire.Rules))
 }
@@ -177,6 +244,7 @@ func (v *Switch) OnHook(client libol.SocketClient, data []byte) error {
 func (v *Switch) OnClient(client libol.SocketClient) error {
 	client.SetStatus(libol.CL_CONNECTED)
 	libol.Info("Switch.onClient: %s", client.Addr())
+	v.Apps.Beat.OnClient(client)
 	return nil
 }
 
@@ -194,6 +262,15 @@ func (v *Switch) ReadClient(client libol.SocketClient, data []byte) error {
 		if point == nil || dev == nil {
 			return libol.NewErr("Tap devices is nil")
 		}
+		if point.Bond != nil {
+			return point.Bond.Input(data, func(frame []byte) error {
+				if _, err := dev.Write(frame); err != nil {
+					libol.Error("Worker.OnRead: %s", err)
+					return err
+				}
+				return nil
+			})
+		}
 		if _, err := dev.Write(data); err != nil {
 			libol.Error("Worker.OnRead: %s", err)
 			return err
@@ -207,10 +284,11 @@ func (v *Switch) OnClose(client libol.SocketClient) error {
 	libol.Info("Switch.OnClose: %s", client.Addr())
 
 	uuid := storage.Point.GetUUID(client.Addr())
-	if storage.Point.GetAddr(uuid) == client.Addr() { // not has newer
-		storage.Network.FreeAddr(uuid)
-	}
 	storage.Point.Del(client.Addr())
+	// not has newer, or other paths of bond.
+	if uuid != "" && storage.Point.GetAddr(uuid) == "" {
+		storage.Network.OffAddr(uuid)
+	}
 
 	return nil
 }
@@ -230,13 +308,11 @@ func (v *Switch) Start() error {
 			br.Open(brCfg.Address)
 		}
 	}
-	go v.server.Accept()
-	call := libol.ServerListener{
-		OnClient: v.OnClient,
-		OnClose:  v.OnClose,
-		ReadAt:   v.ReadClient,
+	for _, l := range v.listeners {
+		go l.Server.Accept()
+		go l.Server.Loop(v.listen(l))
 	}
-	go v.server.Loop(call)
+	go v.Apps.Beat.Start()
 	for _, w := range v.worker {
 		w.Start(v)
 	}
@@ -249,11 +325,22 @@ func (v *Switch) Start() error {
 	return nil
 }
 
+// Stop returns an error if already stopped.
 func (v *Switch) Stop() error {
+	err := libol.NewErr("already stopped")
+	v.stopped.Do(func() {
+		err = v.stop()
+	})
+	return err
+}
+
+func (v *Switch) stop() error {
 	v.lock.Lock()
 	defer v.lock.Unlock()
 
 	libol.Debug("Switch.Stop")
+	// keep the leases of points closed later.
+	storage.State.Close()
 	v.Fire.Stop()
 	ctrls.Ctrl.Stop()
 	if v.bridge == nil {
@@ -270,7 +357,10 @@ func (v *Switch) Stop() error {
 		v.http.Shutdown()
 		v.http = nil
 	}
-	v.server.Close()
+	for _, l := range v.listeners {
+		l.Server.Close()
+	}
+	v.Apps.Beat.Stop()
 	for _, w := range v.worker {
 		w.Stop()
 	}
@@ -285,8 +375,58 @@ func (v *Switch) UpTime() int64 {
 	return time.Now().Unix() - v.newTime
 }
 
-func (v *Switch) Server() libol.SocketServer {
-	return v.server
+// listen feeds clients accepted by the listener to same hooks.
+func (v *Switch) listen(l *Listener) libol.ServerListener {
+	return libol.ServerListener{
+		OnClient: func(client libol.SocketClient) error {
+			l.AddClient(client)
+			return v.OnClient(client)
+		},
+		OnClose: func(client libol.SocketClient) error {
+			defer l.DelClient(client)
+			return v.OnClose(client)
+		},
+		ReadAt: v.ReadClient,
+	}
+}
+
+func (v *Switch) Guard() *libol.Guard {
+	return v.guard
+}
+
+func (v *Switch) Servers() []libol.SocketServer {
+	servers := make([]libol.SocketServer, 0, len(v.listeners))
+	for _, l := range v.listeners {
+		servers = append(servers, l.Server)
+	}
+	return servers
+}
+
+func (v *Switch) Listeners() []schema.Listener {
+	listeners := make([]schema.Listener, 0, len(v.listeners))
+	for _, l := range v.listeners {
+		listeners = append(listeners, l.Schema())
+	}
+	return listeners
+}
+
+// listener returns the listener accepted the client, and nil if not found.
+func (v *Switch) listener(client libol.SocketClient) *Listener {
+	for _, l := range v.listeners {
+		if l.HasClient(client) {
+			return l
+		}
+	}
+	return nil
+}
+
+// Allowed returns true if the network can be logged in by the listener
+// accepted the client.
+func (v *Switch) Allowed(client libol.SocketClient, network string) bool {
+	if l := v.listener(client); l != nil {
+		return l.Allowed(network)
+	}
+	return true
 }
 
 func (v *Switch) NewTap(tenant string) (network.Taper, error) {
@@ -328,12 +468,271 @@ func (v *Switch) UUID() string {
 	return v.uuid
 }
 
-func (v *Switch) AddLink(tenant string, c *config.Point) {
+// AddNetwork creates the network at runtime, and saves it to the file
+// under network of configuration directory.
+func (v *Switch) AddNetwork(c *config.Network) error {
+	v.lock.Lock()
+	defer v.lock.Unlock()
 
+	if _, ok := v.worker[c.Name]; ok {
+		return libol.NewErr("network %s already existed", c.Name)
+	}
+	c.File = v.networkFile(c)
+	if err := c.Save(); err != nil {
+		return err
+	}
+	v.startNetwork(c)
+	v.Conf.Network = append(v.Conf.Network, c)
+	return nil
 }
 
-func (v *Switch) DelLink(tenant, addr string) {
+// ModNetwork replaces the network by destroying and creating again, so
+// the points of it are disconnected.
+func (v *Switch) ModNetwork(c *config.Network) error {
+	v.lock.Lock()
+	defer v.lock.Unlock()
 
+	w, ok := v.worker[c.Name]
+	if !ok {
+		return libol.NewErr("network %s not found", c.Name)
+	}
+	c.File = w.Conf.File
+	if err := c.Save(); err != nil {
+		return err
+	}
+	v.stopNetwork(c.Name)
+	v.startNetwork(c)
+	for i, n := range v.Conf.Network {
+		if n.Name == c.Name {
+			v.Conf.Network[i] = c
+		}
+	}
+	return nil
+}
+
+// DelNetwork destroys the network, and removes it from the configuration
+// directory.
+func (v *Switch) DelNetwork(name string) error {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+
+	w, ok := v.worker[name]
+	if !ok {
+		return libol.NewErr("network %s not found", name)
+	}
+	v.stopNetwork(name)
+	nets := make([]*config.Network, 0, len(v.Conf.Network))
+	for _, n := range v.Conf.Network {
+		if n.Name != name {
+			nets = append(nets, n)
+		}
+	}
+	v.Conf.Network = nets
+	if err := w.Conf.Remove(); err != nil {
+		return err
+	}
+	return v.Conf.DelNetwork(name)
+}
+
+// Reload reads the configuration again, and applies the differences of
+// networks, firewall and certificates. The points of network not changed
+// are kept online, and the network is created again if its bridge or
+// subnet changed.
+func (v *Switch) Reload() error {
+	c, err := v.Conf.Reload()
+	if err != nil {
+		libol.Error("Switch.Reload: %s", err)
+		return err
+	}
+	v.lock.Lock()
+	defer v.lock.Unlock()
+
+	libol.Info("Switch.Reload: %s", c.SaveFile)
+	nets := make(map[string]*config.Network, len(c.Network))
+	for _, n := range c.Network {
+		nets[n.Name] = n
+	}
+	for _, n := range v.Conf.Network {
+		if _, ok := nets[n.Name]; !ok {
+			v.stopNetwork(n.Name)
+		}
+	}
+	for _, n := range c.Network {
+		w, ok := v.worker[n.Name]
+		if !ok {
+			v.startNetwork(n)
+			continue
+		}
+		old := w.Conf.Subnet
+		if w.Conf.Bridge != n.Bridge || old.Start != n.Subnet.Start ||
+			old.End != n.Subnet.End || old.Netmask != n.Subnet.Netmask {
+			v.stopNetwork(n.Name)
+			v.startNetwork(n)
+			continue
+		}
+		rules := v.rules(n)
+		older := v.rules(&w.Conf)
+		v.Fire.Del(diffRules(older, rules)...)
+		v.Fire.Add(diffRules(rules, older)...)
+		// the crypt and the compression are negotiated at login.
+		renew := w.Conf.Compress != n.Compress || !reflect.DeepEqual(w.Conf.Crypt, n.Crypt)
+		users := w.Reload(*n)
+		v.updateApps(n)
+		if renew {
+			v.offPoints(func(m *models.Point) bool {
+				return m.Network == n.Name
+			})
+		} else if len(users) > 0 {
+			v.offPoints(func(m *models.Point) bool {
+				return users[storage.UserName(m.User, m.Network)]
+			})
+		}
+	}
+	v.Conf.Network = c.Network
+
+	rules := make([]libol.FilterRule, 0, len(c.FireWall))
+	for _, rule := range c.FireWall {
+		rules = append(rules, newFilterRule(rule))
+	}
+	older := make([]libol.FilterRule, 0, len(v.Conf.FireWall))
+	for _, rule := range v.Conf.FireWall {
+		older = append(older, newFilterRule(rule))
+	}
+	v.Fire.Del(diffRules(older, rules)...)
+	v.Fire.Add(diffRules(rules, older)...)
+	v.Conf.FireWall = c.FireWall
+
+	v.Conf.Cert = c.Cert
+	for _, l := range v.listeners {
+		for _, lc := range c.Listeners {
+			if lc.Protocol != l.Conf.Protocol || lc.Listen != l.Conf.Listen {
+				continue
+			}
+			if err := l.ReloadCert(lc, &v.Conf); err != nil {
+				libol.Error("Switch.Reload: %s", err)
+			}
+		}
+	}
+	if !reflect.DeepEqual(v.Conf.Listeners, c.Listeners) {
+		libol.Warn("Switch.Reload: listeners changed, and need restart")
+	}
+	return nil
+}
+
+// startNetwork creates and starts the network, and it is locked by caller.
+func (v *Switch) startNetwork(c *config.Network) {
+	libol.Info("Switch.startNetwork: %s", c.Name)
+	c.File = v.networkFile(c)
+	c.Alias = v.Conf.Alias
+	for _, link := range c.Links {
+		link.Default()
+	}
+	c.Right()
+	w := v.addNetwork(c)
+	v.updateApps(c)
+	if br, ok := v.bridge[c.Name]; ok {
+		br.Open(c.Bridge.Address)
+	}
+	w.Start(v)
+}
+
+// updateApps applies the network changed to the apps negotiated by it,
+// and nothing if not initialized.
+func (v *Switch) updateApps(c *config.Network) {
+	if v.Apps.Auth != nil {
+		v.Apps.Auth.Update(c)
+	}
+	if v.Apps.Hello != nil {
+		v.Apps.Hello.Update(c)
+	}
+}
+
+// networkFile returns the file of network, and it is in the configuration
+// directory if not loaded from a file.
+func (v *Switch) networkFile(c *config.Network) string {
+	if c.File != "" {
+		return c.File
+	}
+	return fmt.Sprintf("%s/network/%s.json", v.Conf.ConfDir, c.Name)
+}
+
+// stopNetwork disconnects the points, and destroys the worker, the bridge
+// and the rules of network. It is locked by caller.
+func (v *Switch) stopNetwork(name string) {
+	libol.Info("Switch.stopNetwork: %s", name)
+	v.offPoints(func(m *models.Point) bool {
+		return m.Network == name
+	})
+	if w, ok := v.worker[name]; ok {
+		w.Destroy()
+		v.Fire.Del(v.rules(&w.Conf)...)
+		delete(v.worker, name)
+	}
+	if br, ok := v.bridge[name]; ok {
+		_ = br.Close()
+		delete(v.bridge, name)
+	}
+	if v.Apps.Auth != nil {
+		v.Apps.Auth.Remove(name)
+	}
+	if v.Apps.Hello != nil {
+		v.Apps.Hello.Remove(name)
+	}
+}
+
+// offPoints disconnects the points matched, and all paths of bond.
+func (v *Switch) offPoints(match func(m *models.Point) bool) {
+	clients := make([]libol.SocketClient, 0, 32)
+	for m := range storage.Point.List() {
+		if m == nil {
+			break
+		}
+		if !match(m) {
+			continue
+		}
+		if m.Bond != nil {
+			clients = append(clients, m.Bond.Clients()...)
+		} else {
+			clients = append(clients, m.Client)
+		}
+	}
+	for _, client := range clients {
+		v.OffClient(client)
+	}
+}
+
+func (v *Switch) AddLink(tenant string, c *config.Point) error {
+	v.lock.RLock()
+	defer v.lock.RUnlock()
+
+	w, ok := v.worker[tenant]
+	if !ok {
+		return libol.NewErr("network %s not found", tenant)
+	}
+	libol.Info("Switch.AddLink: %s on %s", c.Addr, tenant)
+	return w.AddLink(c)
+}
+
+// DelLink deletes the link on the network, and finds it in all networks
+// if the tenant is empty.
+func (v *Switch) DelLink(tenant, addr string) error {
+	v.lock.RLock()
+	defer v.lock.RUnlock()
+
+	if tenant != "" {
+		w, ok := v.worker[tenant]
+		if !ok {
+			return libol.NewErr("network %s not found", tenant)
+		}
+		return w.DelLink(addr)
+	}
+	for _, w := range v.worker {
+		if w.HasLink(addr) {
+			libol.Info("Switch.DelLink: %s on %s", addr, w.Conf.Name)
+			return w.DelLink(addr)
+		}
+	}
+	return libol.NewErr("link %s not found", addr)
 }
 
 func (v *Switch) ReadTap(dev network.Taper, readAt func(p []byte) error) {
@@ -357,8 +756,8 @@ func (v *Switch) ReadTap(dev network.Taper, readAt func(p []byte) error) {
 
 func (v *Switch) OffClient(client libol.SocketClient) {
 	libol.Info("Switch.OffClient: %s", client)
-	if v.server != nil {
-		v.server.OffClient(client)
+	if l := v.listener(client); l != nil {
+		l.Server.OffClient(client)
 	}
 }
 
@@ -0,0 +1,203 @@
+package _switch
+
+import (
+	"github.com/danieldin95/openlan-go/libol"
+	"github.com/danieldin95/openlan-go/main/config"
+	"github.com/danieldin95/openlan-go/switch/app"
+	"github.com/danieldin95/openlan-go/switch/storage"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestNewSwitch_WebPath(t *testing.T) {
+	c := config.Switch{
+		Listeners: []config.Listener{
+			{Protocol: "ws", Listen: "127.0.0.1:0"},
+			{Protocol: "ws", Listen: "127.0.0.1:0"},
+		},
+	}
+	v, err := NewSwitch(c)
+	assert.NotNil(t, err, "same path.")
+	assert.Nil(t, v, "refused.")
+
+	c.Listeners[1].Path = "/olan/ws2"
+	v, err = NewSwitch(c)
+	assert.Nil(t, err, "other path.")
+	for _, l := range v.listeners {
+		l.Server.Close()
+	}
+}
+
+func TestNewSwitch_ProxyProtocol(t *testing.T) {
+	c := config.Switch{
+		Listeners: []config.Listener{
+			{Protocol: "tcp", Listen: "127.0.0.1:0", ProxyProtocol: &config.ProxyProtocol{}},
+		},
+	}
+	v, err := NewSwitch(c)
+	assert.NotNil(t, err, "none trusted.")
+	assert.Nil(t, v, "refused.")
+
+	c.Listeners[0].ProxyProtocol.Trusted = []string{"10.0.0.0/33"}
+	_, err = NewSwitch(c)
+	assert.NotNil(t, err, "invalid trusted.")
+}
+
+func TestNewSwitch_Filter(t *testing.T) {
+	c := config.Switch{
+		Listeners: []config.Listener{
+			{Protocol: "tcp", Listen: "127.0.0.1:0", Allow: []string{"10.0.0.0/8", "bad"}},
+		},
+	}
+	v, err := NewSwitch(c)
+	assert.NotNil(t, err, "invalid allow.")
+	assert.Nil(t, v, "refused.")
+
+	c.Listeners[0].Allow = nil
+	c.Listeners[0].Deny = []string{"10.0.0.0/40"}
+	_, err = NewSwitch(c)
+	assert.NotNil(t, err, "invalid deny.")
+}
+
+func newTestSwitch(t *testing.T) (*Switch, string) {
+	dir, err := ioutil.TempDir("", "switch")
+	assert.Nil(t, err, "temp dir.")
+	c := config.Switch{
+		ConfDir:  dir,
+		SaveFile: filepath.Join(dir, "switch.json"),
+	}
+	v, err := NewSwitch(c)
+	assert.Nil(t, err, "new switch.")
+	return v, dir
+}
+
+func newTestNetwork(name string) *config.Network {
+	return &config.Network{
+		Name:   name,
+		Bridge: config.Bridge{Provider: "virtual"},
+		Subnet: config.IpSubnet{Start: "172.32.0.10", End: "172.32.0.20", Netmask: "255.255.255.0"},
+	}
+}
+
+func TestSwitch_Network(t *testing.T) {
+	v, dir := newTestSwitch(t)
+	defer os.RemoveAll(dir)
+
+	c := newTestNetwork("example")
+	assert.Nil(t, v.AddNetwork(c), "add network.")
+	assert.NotNil(t, v.AddNetwork(newTestNetwork("example")), "already existed.")
+	assert.NotNil(t, storage.Network.Get("example"), "started.")
+	file := filepath.Join(dir, "network", "example.json")
+	saved := &config.Network{}
+	assert.Nil(t, libol.UnmarshalLoad(saved, file), "saved.")
+	assert.Equal(t, "172.32.0.10", saved.Subnet.Start, "saved.")
+
+	c = newTestNetwork("example")
+	c.Subnet.Start = "172.32.0.11"
+	assert.Nil(t, v.ModNetwork(c), "modify network.")
+	assert.Equal(t, "172.32.0.11", storage.Network.Get("example").IpStart, "restarted.")
+	assert.Nil(t, libol.UnmarshalLoad(saved, file), "saved.")
+	assert.Equal(t, "172.32.0.11", saved.Subnet.Start, "saved.")
+	assert.NotNil(t, v.ModNetwork(newTestNetwork("not-existed")), "not found.")
+
+	assert.Nil(t, v.DelNetwork("example"), "delete network.")
+	assert.Nil(t, storage.Network.Get("example"), "stopped.")
+	_, err := os.Stat(file)
+	assert.True(t, os.IsNotExist(err), "removed.")
+	assert.NotNil(t, v.DelNetwork("example"), "not found.")
+}
+
+func TestSwitch_NetworkSaveFailed(t *testing.T) {
+	v, dir := newTestSwitch(t)
+	defer os.RemoveAll(dir)
+
+	c := newTestNetwork("example")
+	assert.Nil(t, v.AddNetwork(c), "add network.")
+	file := c.File
+	// the directory of network is not writable as a file.
+	assert.Nil(t, os.RemoveAll(filepath.Join(dir, "network")), "remove.")
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(dir, "network"), nil, 0600), "write.")
+
+	assert.NotNil(t, v.AddNetwork(newTestNetwork("other")), "not saved.")
+	assert.Nil(t, storage.Network.Get("other"), "not started.")
+	assert.Equal(t, 1, len(v.Conf.Network), "not added.")
+
+	c = newTestNetwork("example")
+	c.Subnet.Start = "172.32.0.11"
+	assert.NotNil(t, v.ModNetwork(c), "not saved.")
+	assert.Equal(t, "172.32.0.10", storage.Network.Get("example").IpStart, "not restarted.")
+	assert.Equal(t, file, v.worker["example"].Conf.File, "kept.")
+	v.stopNetwork("example")
+}
+
+func TestSwitch_Reload(t *testing.T) {
+	v, dir := newTestSwitch(t)
+	defer os.RemoveAll(dir)
+
+	c := newTestNetwork("reload")
+	c.Password = []config.Password{{Username: "hi", Password: "1"}}
+	c.Links = []*config.Point{{Addr: "127.0.0.1:6", Protocol: "tcp"}}
+	assert.Nil(t, v.AddNetwork(c), "add network.")
+	p := v.worker["reload"].links["127.0.0.1:6"]
+	assert.NotNil(t, p, "link started.")
+
+	assert.Nil(t, v.Reload(), "reload.")
+	assert.True(t, p == v.worker["reload"].links["127.0.0.1:6"], "link kept.")
+	assert.NotNil(t, storage.User.Get("hi@reload"), "user kept.")
+
+	c = newTestNetwork("reload")
+	c.Links = []*config.Point{{Addr: "127.0.0.1:6", Protocol: "tcp"}}
+	c.File = filepath.Join(dir, "network", "reload.json")
+	assert.Nil(t, c.Save(), "save.")
+	assert.Nil(t, v.Reload(), "reload.")
+	assert.True(t, p == v.worker["reload"].links["127.0.0.1:6"], "link kept.")
+	assert.Nil(t, storage.User.Get("hi@reload"), "user removed.")
+
+	assert.Nil(t, os.Remove(c.File), "remove.")
+	assert.Nil(t, v.Reload(), "reload.")
+	_, ok := v.worker["reload"]
+	assert.False(t, ok, "network removed.")
+	assert.Nil(t, storage.Network.Get("reload"), "network removed.")
+}
+
+func TestSwitch_ReloadCrypt(t *testing.T) {
+	v, dir := newTestSwitch(t)
+	defer os.RemoveAll(dir)
+	v.Apps.Auth = app.NewPointAuth(v, v.Conf)
+	login := func() error {
+		local, remote := net.Pipe()
+		defer remote.Close()
+		go func() {
+			_, _ = io.Copy(ioutil.Discard, remote)
+		}()
+		client := libol.NewTcpClientFromConn(local)
+		defer client.Close()
+		body := `{"name": "hi", "network": "crypt", "password": "1"}`
+		frame := libol.NewFrameMessage(libol.NewControlMessage("login", "= ", body).Encode())
+		return v.Apps.Auth.OnFrame(client, frame)
+	}
+
+	c := newTestNetwork("crypt")
+	c.Password = []config.Password{{Username: "hi", Password: "1"}}
+	c.Crypt = &config.Crypt{Algo: libol.CRYPT_AESGCM, Secret: "secret"}
+	assert.Nil(t, v.AddNetwork(c), "add network.")
+	assert.NotNil(t, login(), "crypt required by network added.")
+
+	c = newTestNetwork("crypt")
+	c.Password = []config.Password{{Username: "hi", Password: "1"}}
+	c.Crypt = &config.Crypt{Algo: libol.CRYPT_AESGCM, Secret: "changed"}
+	c.File = filepath.Join(dir, "network", "crypt.json")
+	assert.Nil(t, c.Save(), "save.")
+	assert.Nil(t, v.Reload(), "reload.")
+	assert.Equal(t, "changed", v.worker["crypt"].Conf.Crypt.Secret, "crypt changed.")
+	assert.NotNil(t, login(), "crypt required still.")
+
+	assert.Nil(t, os.Remove(c.File), "remove.")
+	assert.Nil(t, v.Reload(), "reload.")
+	assert.NotNil(t, login(), "network removed.")
+}
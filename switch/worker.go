@@ -1,12 +1,16 @@
 package _switch
 
 import (
+	"encoding/binary"
 	"github.com/danieldin95/openlan-go/libol"
 	"github.com/danieldin95/openlan-go/main/config"
 	"github.com/danieldin95/openlan-go/models"
 	"github.com/danieldin95/openlan-go/point"
 	"github.com/danieldin95/openlan-go/switch/api"
 	"github.com/danieldin95/openlan-go/switch/storage"
+	"net"
+	"reflect"
+	"strings"
 	"sync"
 	"time"
 )
@@ -19,6 +23,7 @@ type Worker struct {
 	startTime   int64
 	linksLock   sync.RWMutex
 	links       map[string]*point.Point
+	users       map[string]*models.User // added from configuration.
 	uuid        string
 	initialized bool
 }
@@ -30,6 +35,7 @@ func NewWorker(c config.Network) *Worker {
 		newTime:     time.Now().Unix(),
 		startTime:   0,
 		links:       make(map[string]*point.Point),
+		users:       make(map[string]*models.User),
 		initialized: false,
 	}
 
@@ -40,32 +46,156 @@ func (w *Worker) Initialize() {
 	w.initialized = true
 
 	for _, pass := range w.Conf.Password {
-		user := models.User{
-			Name:     pass.Username + "@" + w.Conf.Name,
-			Password: pass.Password,
+		w.addUser(pass)
+	}
+	if met := w.newNetwork(); met != nil {
+		storage.Network.Add(met)
+	}
+}
+
+// addUser adds the user of configuration, and it is not saved to state.
+func (w *Worker) addUser(pass config.Password) {
+	user := &models.User{
+		Name:     pass.Username + "@" + w.Conf.Name,
+		Password: pass.Password,
+	}
+	storage.User.AddConf(user)
+	w.users[user.Name] = user
+}
+
+// delUser deletes the user added by addUser, and returns false if not
+// added from configuration or replaced by others.
+func (w *Worker) delUser(name string) bool {
+	user, ok := w.users[name]
+	if !ok {
+		return false
+	}
+	delete(w.users, name)
+	return storage.User.DelConf(user)
+}
+
+// newNetwork returns the subnet and the routes pushed to points, and nil
+// if no subnet.
+func (w *Worker) newNetwork() *models.Network {
+	if w.Conf.Subnet.Netmask == "" {
+		return nil
+	}
+	met := models.Network{
+		Name:    w.Conf.Name,
+		IpStart: w.Conf.Subnet.Start,
+		IpEnd:   w.Conf.Subnet.End,
+		Netmask: w.Conf.Subnet.Netmask,
+		Routes:  make([]*models.Route, 0, 2),
+		// lease
+		LeaseTime: int64(w.Conf.Subnet.LeaseTime),
+		Grace:     int64(w.Conf.Subnet.Grace),
+		Exclude:   make([]models.IpRange, 0, len(w.Conf.Subnet.Exclude)),
+		Reserved:  make(map[string]string, len(w.Conf.Subnet.Reserved)),
+	}
+	for _, ex := range w.Conf.Subnet.Exclude {
+		values := strings.SplitN(ex, "-", 2)
+		start := net.ParseIP(strings.TrimSpace(values[0])).To4()
+		end := start
+		if len(values) == 2 {
+			end = net.ParseIP(strings.TrimSpace(values[1])).To4()
+		}
+		if start == nil || end == nil {
+			libol.Warn("Worker.newNetwork invalid exclude %s", ex)
+			continue
+		}
+		met.Exclude = append(met.Exclude, models.IpRange{
+			Start: binary.BigEndian.Uint32(start),
+			End:   binary.BigEndian.Uint32(end),
+		})
+	}
+	for _, rv := range w.Conf.Subnet.Reserved {
+		key := rv.UUID
+		if key == "" {
+			key = storage.UserName(rv.Username, w.Conf.Name)
+		}
+		if key == "" || net.ParseIP(rv.Address) == nil {
+			libol.Warn("Worker.newNetwork invalid reserved %v", rv)
+			continue
 		}
-		storage.User.Add(&user)
-	}
-	if w.Conf.Subnet.Netmask != "" {
-		met := models.Network{
-			Name:    w.Conf.Name,
-			IpStart: w.Conf.Subnet.Start,
-			IpEnd:   w.Conf.Subnet.End,
-			Netmask: w.Conf.Subnet.Netmask,
-			Routes:  make([]*models.Route, 0, 2),
+		met.Reserved[key] = rv.Address
+	}
+	for _, rt := range w.Conf.Routes {
+		if rt.NextHop == "" {
+			libol.Warn("Worker.newNetwork %s no nexthop", rt.Prefix)
+			continue
 		}
-		for _, rt := range w.Conf.Routes {
-			if rt.NextHop == "" {
-				libol.Warn("Worker.Initialize %s no nexthop", rt.Prefix)
-				continue
+		met.Routes = append(met.Routes, &models.Route{
+			Prefix:  rt.Prefix,
+			Nexthop: rt.NextHop,
+		})
+	}
+	return &met
+}
+
+// Reload applies the users, the routes and the links changed, and the
+// points online are kept. The bridge and the subnet are not changed. It
+// returns the users removed or changed, and their points should be
+// disconnected by caller.
+func (w *Worker) Reload(c config.Network) map[string]bool {
+	libol.Info("Worker.Reload: %s", c.Name)
+	old := w.Conf
+
+	users := make(map[string]bool, 4)
+	passwords := make(map[string]string, len(c.Password))
+	for _, pass := range c.Password {
+		passwords[pass.Username] = pass.Password
+	}
+	for _, pass := range old.Password {
+		if _, ok := passwords[pass.Username]; !ok {
+			name := pass.Username + "@" + c.Name
+			if w.delUser(name) {
+				users[name] = true
 			}
-			met.Routes = append(met.Routes, &models.Route{
-				Prefix:  rt.Prefix,
-				Nexthop: rt.NextHop,
-			})
 		}
-		storage.Network.Add(&met)
 	}
+	for _, pass := range c.Password {
+		name := pass.Username + "@" + c.Name
+		u := storage.User.Get(name)
+		if u != nil && u.Password == pass.Password {
+			continue
+		}
+		if u != nil {
+			users[name] = true
+		}
+		w.addUser(pass)
+	}
+
+	w.linksLock.Lock()
+	defer w.linksLock.Unlock()
+
+	links := make(map[string]*config.Point, len(old.Links))
+	for _, lc := range old.Links {
+		links[lc.Addr] = lc
+	}
+	w.Conf = c
+	for i, lc := range c.Links {
+		lc.Default()
+		w.linkConf(lc)
+		if o, ok := links[lc.Addr]; ok && reflect.DeepEqual(o, lc) {
+			c.Links[i] = o
+			delete(links, lc.Addr)
+			continue
+		}
+		w.delLink(lc.Addr) // changed.
+		delete(links, lc.Addr)
+		w.addLink(lc)
+	}
+	for addr := range links { // removed.
+		w.delLink(addr)
+	}
+
+	if w.initialized {
+		storage.Network.Del(c.Name)
+		if met := w.newNetwork(); met != nil {
+			storage.Network.Add(met)
+		}
+	}
+	return users
 }
 
 func (w *Worker) ID() string {
@@ -77,11 +207,12 @@ func (w *Worker) String() string {
 }
 
 func (w *Worker) LoadLinks() {
-	if w.Conf.Links != nil {
-		for _, lc := range w.Conf.Links {
-			lc.Default()
-			w.AddLink(lc)
-		}
+	w.linksLock.Lock()
+	defer w.linksLock.Unlock()
+
+	for _, lc := range w.Conf.Links {
+		lc.Default()
+		w.addLink(lc)
 	}
 }
 
@@ -97,9 +228,11 @@ func (w *Worker) Start(v api.Switcher) {
 
 func (w *Worker) Stop() {
 	libol.Info("Worker.Close: %s", w.Conf.Name)
+	w.linksLock.RLock()
 	for _, p := range w.links {
 		p.Stop()
 	}
+	w.linksLock.RUnlock()
 	w.startTime = 0
 }
 
@@ -110,31 +243,102 @@ func (w *Worker) UpTime() int64 {
 	return 0
 }
 
-func (w *Worker) AddLink(c *config.Point) {
+// AddLink starts a link to other switch, and saves it to the file of
+// network so that started again after restart.
+func (w *Worker) AddLink(c *config.Point) error {
+	w.linksLock.Lock()
+	defer w.linksLock.Unlock()
+
+	if _, ok := w.links[c.Addr]; ok {
+		return libol.NewErr("link %s already existed", c.Addr)
+	}
+	if err := c.Validate(); err != nil {
+		return libol.NewErr("link %s: %s", c.Addr, err)
+	}
+	w.addLink(c)
+	links := w.Conf.Links
+	w.Conf.Links = append(w.Conf.Links, c)
+	if err := w.save(); err != nil {
+		w.Conf.Links = links
+		w.delLink(c.Addr)
+		return err
+	}
+	return nil
+}
+
+// linkConf resets the config of link by the network, so the same config
+// is compared equal again when reloaded.
+func (w *Worker) linkConf(c *config.Point) {
 	c.Alias = w.Alias
 	c.If.Bridge = w.Conf.Bridge.Name //Reset bridge name.
 	c.Allowed = false
 	c.Network = w.Conf.Name
-	go func() {
-		p := point.NewPoint(c)
-		p.Initialize()
+}
+
+func (w *Worker) addLink(c *config.Point) {
+	w.linkConf(c)
+	p := point.NewPoint(c)
+	p.Initialize()
+	w.links[c.Addr] = p
+	storage.Link.Add(c.Addr, p)
+	go p.Start()
+}
 
-		w.linksLock.Lock()
-		w.links[c.Addr] = p
-		w.linksLock.Unlock()
+func (w *Worker) HasLink(addr string) bool {
+	w.linksLock.RLock()
+	defer w.linksLock.RUnlock()
 
-		storage.Link.Add(p)
-		p.Start()
-	}()
+	_, ok := w.links[addr]
+	return ok
 }
 
-func (w *Worker) DelLink(addr string) {
+// DelLink stops the link, and removes it from the file of network.
+func (w *Worker) DelLink(addr string) error {
 	w.linksLock.Lock()
 	defer w.linksLock.Unlock()
 
+	if _, ok := w.links[addr]; !ok {
+		return libol.NewErr("link %s not found", addr)
+	}
+	w.delLink(addr)
+	links := make([]*config.Point, 0, len(w.Conf.Links))
+	for _, lc := range w.Conf.Links {
+		if lc.Addr != addr {
+			links = append(links, lc)
+		}
+	}
+	w.Conf.Links = links
+	return w.save()
+}
+
+func (w *Worker) delLink(addr string) {
 	if p, ok := w.links[addr]; ok {
 		p.Stop()
-		storage.Link.Del(p.Addr())
+		storage.Link.Del(addr)
 		delete(w.links, addr)
 	}
 }
+
+// save writes the configuration of network, and it is locked by caller.
+func (w *Worker) save() error {
+	libol.Info("Worker.save: %s", w.Conf.File)
+	return w.Conf.Save()
+}
+
+// Destroy stops the links, and clears the users and the network added by
+// Initialize.
+func (w *Worker) Destroy() {
+	libol.Info("Worker.Destroy: %s", w.Conf.Name)
+	w.Stop()
+	w.linksLock.Lock()
+	for addr := range w.links {
+		storage.Link.Del(addr)
+		delete(w.links, addr)
+	}
+	w.linksLock.Unlock()
+	for name := range w.users {
+		w.delUser(name)
+	}
+	storage.Network.Del(w.Conf.Name)
+	w.initialized = false
+}
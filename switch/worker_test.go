@@ -0,0 +1,143 @@
+package _switch
+
+import (
+	"github.com/danieldin95/openlan-go/libol"
+	"github.com/danieldin95/openlan-go/main/config"
+	"github.com/danieldin95/openlan-go/models"
+	"github.com/danieldin95/openlan-go/switch/storage"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func newTestWorker(t *testing.T) (*Worker, string) {
+	dir, err := ioutil.TempDir("", "worker")
+	assert.Nil(t, err, "temp dir.")
+	c := config.Network{
+		Name: "example",
+		File: filepath.Join(dir, "network", "example.json"),
+	}
+	return NewWorker(c), dir
+}
+
+func loadNetwork(t *testing.T, file string) *config.Network {
+	n := &config.Network{}
+	assert.Nil(t, libol.UnmarshalLoad(n, file), "load network.")
+	return n
+}
+
+func TestWorker_Link(t *testing.T) {
+	w, dir := newTestWorker(t)
+	defer os.RemoveAll(dir)
+
+	c := &config.Point{
+		Addr:     "127.0.0.1:1",
+		Protocol: "tcp",
+		Network:  "example",
+		Crypt:    &config.Crypt{Algo: "aes-cbc", Secret: "x"},
+	}
+	c.Default()
+	assert.NotNil(t, w.AddLink(c), "crypt not supported.")
+	c.Crypt = nil
+	c.Protocol = "sctp"
+	assert.NotNil(t, w.AddLink(c), "protocol not supported.")
+	assert.False(t, w.HasLink(c.Addr), "not added.")
+	_, err := os.Stat(w.Conf.File)
+	assert.True(t, os.IsNotExist(err), "not saved.")
+
+	c.Protocol = "tcp"
+	assert.Nil(t, w.AddLink(c), "add link.")
+	assert.True(t, w.HasLink(c.Addr), "added.")
+	assert.NotNil(t, w.AddLink(c), "already existed.")
+	link := storage.Link.Get(c.Addr)
+	assert.NotNil(t, link, "stored.")
+	assert.Equal(t, c.Addr, models.NewLinkSchema(link).Address, "keyed by configured.")
+	n := loadNetwork(t, w.Conf.File)
+	assert.Equal(t, 1, len(n.Links), "saved.")
+	assert.Equal(t, c.Addr, n.Links[0].Addr, "saved.")
+
+	assert.Nil(t, w.DelLink(c.Addr), "delete link.")
+	assert.False(t, w.HasLink(c.Addr), "deleted.")
+	assert.Nil(t, storage.Link.Get(c.Addr), "not stored.")
+	assert.NotNil(t, w.DelLink(c.Addr), "not found.")
+	n = loadNetwork(t, w.Conf.File)
+	assert.Equal(t, 0, len(n.Links), "saved.")
+}
+
+func TestWorker_LinkSaveFailed(t *testing.T) {
+	w, dir := newTestWorker(t)
+	defer os.RemoveAll(dir)
+
+	// the directory of network is a file, so not saved.
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(dir, "network"), nil, 0600), "write.")
+	c := &config.Point{Addr: "127.0.0.1:2", Protocol: "tcp", Network: "example"}
+	c.Default()
+	assert.NotNil(t, w.AddLink(c), "save failed.")
+	assert.False(t, w.HasLink(c.Addr), "rolled back.")
+	assert.Nil(t, storage.Link.Get(c.Addr), "rolled back.")
+	assert.Equal(t, 0, len(w.Conf.Links), "rolled back.")
+}
+
+func TestWorker_Reload(t *testing.T) {
+	w, dir := newTestWorker(t)
+	defer os.RemoveAll(dir)
+
+	w.Conf.Password = []config.Password{
+		{Username: "hi", Password: "1"},
+		{Username: "kept", Password: "2"},
+		{Username: "removed", Password: "3"},
+	}
+	w.Conf.Links = []*config.Point{
+		{Addr: "127.0.0.1:3", Protocol: "tcp"},
+		{Addr: "127.0.0.1:4", Protocol: "tcp"},
+		{Addr: "127.0.0.1:5", Protocol: "tcp"},
+	}
+	w.Initialize()
+	w.LoadLinks()
+	defer w.Destroy()
+	points := make(map[string]interface{}, 3)
+	for addr, p := range w.links {
+		points[addr] = p
+	}
+
+	// the same config loaded again from file.
+	c := config.Network{Name: "example", File: w.Conf.File}
+	c.Password = []config.Password{
+		{Username: "hi", Password: "changed"},
+		{Username: "kept", Password: "2"},
+		{Username: "added", Password: "4"},
+	}
+	c.Links = []*config.Point{
+		{Addr: "127.0.0.1:3", Protocol: "tcp"},
+		{Addr: "127.0.0.1:4", Protocol: "udp"},
+	}
+	users := w.Reload(c)
+	assert.Equal(t, map[string]bool{"hi@example": true, "removed@example": true}, users, "users.")
+	assert.Nil(t, storage.User.Get("removed@example"), "removed.")
+	assert.Equal(t, "changed", storage.User.Get("hi@example").Password, "changed.")
+	assert.NotNil(t, storage.User.Get("added@example"), "added.")
+
+	assert.Equal(t, 2, len(w.links), "links.")
+	assert.True(t, points["127.0.0.1:3"] == w.links["127.0.0.1:3"], "not changed, and kept.")
+	assert.False(t, points["127.0.0.1:4"] == w.links["127.0.0.1:4"], "changed, and started again.")
+	assert.False(t, w.HasLink("127.0.0.1:5"), "removed.")
+	assert.Nil(t, storage.Link.Get("127.0.0.1:5"), "removed.")
+}
+
+func TestWorker_ReloadApiUser(t *testing.T) {
+	w, dir := newTestWorker(t)
+	defer os.RemoveAll(dir)
+
+	w.Conf.Password = []config.Password{{Username: "hi", Password: "1"}}
+	w.Initialize()
+	defer w.Destroy()
+	// replaced by api later.
+	storage.User.Add(&models.User{Name: "hi@example", Password: "api"})
+	defer storage.User.Del("hi@example")
+
+	users := w.Reload(config.Network{Name: "example", File: w.Conf.File})
+	assert.Equal(t, 0, len(users), "users.")
+	assert.Equal(t, "api", storage.User.Get("hi@example").Password, "api user kept.")
+}